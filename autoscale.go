@@ -0,0 +1,333 @@
+package pces
+
+// file autoscale.go holds structs, methods, and event handlers that periodically
+// sample the load on a comp pattern function and add or remove replicas of it
+// according to an AutoscalePolicy
+
+import (
+	"fmt"
+	"github.com/iti/evt/evtm"
+	"github.com/iti/evt/vrtime"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ScaleEvent records one change in the number of replicas of a function
+type ScaleEvent struct {
+	Time     float64 // simulation time of the change
+	PtnName  string  // comp pattern holding the function
+	Label    string  // label of the function
+	Action   string  // "up" or "down"
+	Host     string  // host on which the replica was added or from which it was removed
+	Replicas int     // number of instances after the change
+	Metric   float64 // value of the sampled metric that triggered the change
+}
+
+// ReplicaSample records the number of instances of a function and the sampled metric
+// at one sampling epoch
+type ReplicaSample struct {
+	Time     float64
+	PtnName  string
+	Label    string
+	Replicas int
+	Metric   float64
+}
+
+// ScaleEvents lists every scale event, in order of occurrence
+var ScaleEvents []*ScaleEvent = make([]*ScaleEvent, 0)
+
+// ReplicaSamples lists every sample taken by every autoscaler, in order of time
+var ReplicaSamples []*ReplicaSample = make([]*ReplicaSample, 0)
+
+// Autoscalers holds the autoscalers created for the experiment, indexed by function global name
+var Autoscalers map[string]*Autoscaler = make(map[string]*Autoscaler)
+
+// An Autoscaler applies an AutoscalePolicy to one function
+type Autoscaler struct {
+	Policy    AutoscalePolicy
+	cpfi      *CmpPtnFuncInst // primary instance of the scaled function
+	lastScale float64         // time of the most recent scale event
+	lastBusy  float64         // busy time summed over the replicas at the previous sample
+	lastTime  float64         // time of the previous sample
+	running   bool
+	dormant   bool // true when sampling is suspended until the next arrival
+}
+
+// CreateAutoscaler is a constructor.  It checks the policy and the function it names,
+// and remembers the autoscaler in Autoscalers
+func CreateAutoscaler(policy *AutoscalePolicy) (*Autoscaler, error) {
+	err := policy.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	cpfi, err := FuncInstByName(policy.PtnName, policy.Label)
+	if err != nil {
+		return nil, err
+	}
+
+	if !replicable(cpfi.Class) {
+		return nil, fmt.Errorf("autoscale policy names function %s of class %s, which cannot be replicated",
+			cpfi.GlobalName(), cpfi.Class)
+	}
+
+	_, present := Autoscalers[cpfi.GlobalName()]
+	if present {
+		return nil, fmt.Errorf("function %s given more than one autoscaler", cpfi.GlobalName())
+	}
+
+	as := &Autoscaler{Policy: *policy, cpfi: cpfi, lastScale: -policy.Cooldown}
+	Autoscalers[cpfi.GlobalName()] = as
+	cpfi.autoscaler = as
+	return as, nil
+}
+
+// Start brings the function up to the policy's minimum number of replicas and
+// schedules the first sampling event
+func (as *Autoscaler) Start(evtMgr *evtm.EventManager) error {
+	if as.running {
+		return fmt.Errorf("autoscaler for %s already started", as.cpfi.GlobalName())
+	}
+	as.running = true
+
+	now := evtMgr.CurrentSeconds()
+	for as.cpfi.NumReplicas() < as.Policy.MinReplicas {
+		err := as.scaleUp(evtMgr, now, 0.0)
+		if err != nil {
+			return err
+		}
+	}
+
+	as.lastTime = now
+	as.lastBusy = as.busyTime(now)
+	evtMgr.Schedule(as, nil, autoscaleSample, vrtime.SecondsToTime(as.Policy.Interval))
+	return nil
+}
+
+// Stop ends sampling at the next epoch.  Replicas in place remain
+func (as *Autoscaler) Stop() {
+	as.running = false
+}
+
+// StartAutoscalers creates and starts an autoscaler for every policy in the list
+func StartAutoscalers(evtMgr *evtm.EventManager, aspl *AutoscalePolicyList) error {
+	errs := []error{}
+	for idx := range aspl.Policies {
+		as, err := CreateAutoscaler(&aspl.Policies[idx])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = as.Start(evtMgr)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return ReportErrs(errs)
+}
+
+// wake resumes sampling of a dormant autoscaler
+func (as *Autoscaler) wake(evtMgr *evtm.EventManager) {
+	if !as.dormant || !as.running {
+		return
+	}
+	as.dormant = false
+	now := evtMgr.CurrentSeconds()
+	as.lastTime = now
+	as.lastBusy = as.busyTime(now)
+	evtMgr.Schedule(as, nil, autoscaleSample, vrtime.SecondsToTime(as.Policy.Interval))
+}
+
+// inFlight sums the work in flight over all active instances of the function
+func (as *Autoscaler) inFlight() int {
+	inFlight := 0
+	for _, rep := range as.cpfi.replicaSet() {
+		inFlight += rep.InFlight
+	}
+	return inFlight
+}
+
+// busyTime sums the busy time of all active instances of the function
+func (as *Autoscaler) busyTime(now float64) float64 {
+	var busy float64
+	for _, rep := range as.cpfi.replicaSet() {
+		busy += rep.busyTimeAt(now)
+	}
+	return busy
+}
+
+// sample computes the policy's metric over the active instances of the function
+func (as *Autoscaler) sample(now float64) float64 {
+	n := float64(as.cpfi.NumReplicas())
+
+	if as.Policy.Metric == "queue" {
+		return float64(as.inFlight()) / n
+	}
+
+	// "util".  Replicas removed during the interval take their busy time with them,
+	// which can make the difference negative; that is read as an idle interval
+	busy := as.busyTime(now)
+	elapsed := now - as.lastTime
+	util := 0.0
+	if elapsed > 0.0 && busy > as.lastBusy {
+		util = (busy - as.lastBusy) / (elapsed * n)
+	}
+	as.lastBusy = busy
+	as.lastTime = now
+	return util
+}
+
+// autoscaleSample is an event handler that samples the load on the function,
+// applies the policy, and schedules the next sample
+func autoscaleSample(evtMgr *evtm.EventManager, context any, data any) any {
+	as := context.(*Autoscaler)
+	if !as.running {
+		return nil
+	}
+
+	now := evtMgr.CurrentSeconds()
+	metric := as.sample(now)
+
+	if now-as.lastScale >= as.Policy.Cooldown {
+		if metric >= as.Policy.ScaleUp {
+			for step := 0; step < as.Policy.Step && as.cpfi.NumReplicas() < as.Policy.MaxReplicas; step++ {
+				err := as.scaleUp(evtMgr, now, metric)
+				if err != nil {
+					fmt.Println(err)
+					break
+				}
+			}
+		} else if metric <= as.Policy.ScaleDown {
+			for step := 0; step < as.Policy.Step && as.cpfi.NumReplicas() > as.Policy.MinReplicas; step++ {
+				err := as.scaleDown(now, metric)
+				if err != nil {
+					fmt.Println(err)
+					break
+				}
+			}
+		}
+	}
+
+	ReplicaSamples = append(ReplicaSamples, &ReplicaSample{Time: now, PtnName: as.Policy.PtnName,
+		Label: as.Policy.Label, Replicas: as.cpfi.NumReplicas(), Metric: metric})
+
+	// an idle function at its minimum size stops sampling, otherwise the sampling
+	// events alone would keep a simulation with no stop time from ever ending.
+	// The next arrival at the function resumes sampling
+	if metric == 0.0 && as.inFlight() == 0 && as.cpfi.NumReplicas() <= as.Policy.MinReplicas {
+		as.dormant = true
+		return nil
+	}
+
+	evtMgr.Schedule(as, nil, autoscaleSample, vrtime.SecondsToTime(as.Policy.Interval))
+	return nil
+}
+
+// scaleUp adds a replica on the candidate host currently running the fewest instances of the function,
+// ties broken by order in the policy's host list
+func (as *Autoscaler) scaleUp(evtMgr *evtm.EventManager, now, metric float64) error {
+	if len(as.Policy.Hosts) == 0 {
+		return fmt.Errorf("autoscaler for %s has no candidate hosts", as.cpfi.GlobalName())
+	}
+
+	onHost := make(map[string]int)
+	for _, rep := range as.cpfi.replicaSet() {
+		onHost[rep.Host] += 1
+	}
+
+	host := as.Policy.Hosts[0]
+	for _, candidate := range as.Policy.Hosts[1:] {
+		if onHost[candidate] < onHost[host] {
+			host = candidate
+		}
+	}
+
+	_, err := as.cpfi.AddReplica(evtMgr, host)
+	if err != nil {
+		return err
+	}
+	as.lastScale = now
+	ScaleEvents = append(ScaleEvents, &ScaleEvent{Time: now, PtnName: as.Policy.PtnName, Label: as.Policy.Label,
+		Action: "up", Host: host, Replicas: as.cpfi.NumReplicas(), Metric: metric})
+	return nil
+}
+
+// scaleDown removes the most recently added replica
+func (as *Autoscaler) scaleDown(now, metric float64) error {
+	rep, err := as.cpfi.RemoveReplica()
+	if err != nil {
+		return err
+	}
+	as.lastScale = now
+	ScaleEvents = append(ScaleEvents, &ScaleEvent{Time: now, PtnName: as.Policy.PtnName, Label: as.Policy.Label,
+		Action: "down", Host: rep.Host, Replicas: as.cpfi.NumReplicas(), Metric: metric})
+	return nil
+}
+
+// ReportAutoscale prints the scale events of the run, and the
+// time-weighted average number of instances of each autoscaled function
+func ReportAutoscale() {
+	for _, se := range ScaleEvents {
+		fmt.Printf("Scale %s of %s:%s at %f on %s, metric %f, now %d instances\n",
+			se.Action, se.PtnName, se.Label, se.Time, se.Host, se.Metric, se.Replicas)
+	}
+
+	type accum struct {
+		first, last, area float64
+		n                 int
+	}
+	acc := make(map[string]*accum)
+	names := make([]string, 0)
+	for _, rs := range ReplicaSamples {
+		name := rs.PtnName + ":" + rs.Label
+		a, present := acc[name]
+		if !present {
+			a = &accum{first: rs.Time, last: rs.Time, n: rs.Replicas}
+			acc[name] = a
+			names = append(names, name)
+			continue
+		}
+		a.area += float64(a.n) * (rs.Time - a.last)
+		a.last = rs.Time
+		a.n = rs.Replicas
+	}
+	for _, name := range names {
+		a := acc[name]
+		if a.last > a.first {
+			fmt.Printf("Autoscaled %s averaged %f instances\n", name, a.area/(a.last-a.first))
+		}
+	}
+}
+
+// checkAutoscaleCSVFile returns an error if the named file is not one the replica samples can be written to
+func checkAutoscaleCSVFile(filename string) error {
+	if strings.ToLower(path.Ext(filename)) != ".csv" {
+		return fmt.Errorf("autoscale data file %s is not .csv", filename)
+	}
+	return nil
+}
+
+// SaveAutoscaleCSV writes the replica samples of the run to the named csv file, one row per sample
+func SaveAutoscaleCSV(dataFile string) error {
+	f, err := os.Create(dataFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString("time,ptnname,label,replicas,metric\n")
+	if err != nil {
+		return err
+	}
+	for _, rs := range ReplicaSamples {
+		row := []string{strconv.FormatFloat(rs.Time, 'g', -1, 64), rs.PtnName, rs.Label,
+			strconv.Itoa(rs.Replicas), strconv.FormatFloat(rs.Metric, 'g', -1, 64)}
+		_, err = f.WriteString(strings.Join(row, ",") + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
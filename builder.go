@@ -0,0 +1,314 @@
+package pces
+
+// file builder.go holds a fluent interface for building a model in Go.  A ModelBuilder creates
+// the comp patterns, their messages, the cfgs of their functions, their mappings to hosts, and
+// function timings together, checking each addition as it is made, and emits the four
+// dictionaries the simulator reads.  For example,
+//
+//	mb := CreateModelBuilder("demo")
+//	mb.Pattern("chain", "chain1").
+//		Msg("req", true).
+//		Func("start", "src", &StartCfg{PcktLen: 1000, MsgLen: 1000, MsgType: "req"}).
+//		Func("finish", "sink", &FinishCfg{}).
+//		Edge("src", "req", "sink").
+//		MapAll("hostA", 1)
+//	mb.Timing("noop", "", "x86", 1000, 1e-6)
+//	syn, err := mb.WriteToFiles("input", "yaml")
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+)
+
+// A ModelBuilder gathers the descriptions of a model as it is built.  Problems found
+// while building are recorded rather than raised, and are reported by Err and Build
+type ModelBuilder struct {
+	Name     string
+	patterns []*PatternBuilder
+	fel      *FuncExecList
+	errs     []error
+}
+
+// CreateModelBuilder is a constructor
+func CreateModelBuilder(name string) *ModelBuilder {
+	mb := new(ModelBuilder)
+	mb.Name = name
+	mb.patterns = []*PatternBuilder{}
+	mb.fel = CreateFuncExecList(name)
+	mb.errs = []error{}
+	return mb
+}
+
+// A PatternBuilder builds one comp pattern of a model, together with its initialization list and map
+type PatternBuilder struct {
+	mb   *ModelBuilder
+	cpt  *CompPattern
+	cpil *CPInitList
+	cpm  *CompPatternMap
+}
+
+// Pattern starts a comp pattern of the given type and name.  Methods of the PatternBuilder it returns
+// add to the pattern, and Done returns to the ModelBuilder
+func (mb *ModelBuilder) Pattern(cptype, name string) *PatternBuilder {
+	for _, pb := range mb.patterns {
+		if pb.cpt.Name == name {
+			mb.errs = append(mb.errs, fmt.Errorf("model %s has a second comp pattern named %s", mb.Name, name))
+		}
+	}
+
+	cpt := CreateCompPattern(cptype)
+	cpt.SetName(name)
+	pb := &PatternBuilder{mb: mb, cpt: cpt, cpil: CreateCPInitList(name, cptype, true), cpm: CreateCompPatternMap(name)}
+	mb.patterns = append(mb.patterns, pb)
+	return pb
+}
+
+// Timing adds the execution time of an operation on a CPU model for packets of the given length
+func (mb *ModelBuilder) Timing(op, param, cpumodel string, pcktLen int, execTime float64) *ModelBuilder {
+	if execTime < 0.0 {
+		mb.errs = append(mb.errs, fmt.Errorf("timing of %s on %s has negative execution time", op, cpumodel))
+		return mb
+	}
+	if findTiming(mb.fel.Times[op], timingKey{param, cpumodel, pcktLen}) > -1 {
+		mb.errs = append(mb.errs, fmt.Errorf("timing of %s on %s for packet length %d is given twice", op, cpumodel, pcktLen))
+		return mb
+	}
+	mb.fel.AddTiming(op, param, cpumodel, pcktLen, execTime)
+	return mb
+}
+
+// TimingModel selects the timing model fitted to the timings of an operation, see TimingModelDesc
+func (mb *ModelBuilder) TimingModel(op, kind string, degree int) *ModelBuilder {
+	err := mb.fel.SetTimingModel(op, kind, degree)
+	if err != nil {
+		mb.errs = append(mb.errs, err)
+	}
+	return mb
+}
+
+// DeriveCPUModel declares a CPU model whose missing timings are those of the reference model scaled, see DerivedCPUModel
+func (mb *ModelBuilder) DeriveCPUModel(cpumodel, reference string, scale float64, opScale map[string]float64) *ModelBuilder {
+	err := mb.fel.DeriveCPUModel(cpumodel, reference, scale, opScale)
+	if err != nil {
+		mb.errs = append(mb.errs, err)
+	}
+	return mb
+}
+
+// fail records a problem found while building the pattern
+func (pb *PatternBuilder) fail(format string, args ...any) *PatternBuilder {
+	pb.mb.errs = append(pb.mb.errs, fmt.Errorf("comp pattern %s: %s", pb.cpt.Name, fmt.Sprintf(format, args...)))
+	return pb
+}
+
+// hasFunc is true if the pattern has a function with the given label
+func (pb *PatternBuilder) hasFunc(label string) bool {
+	for _, fnc := range pb.cpt.Funcs {
+		if fnc.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMsg is true if the pattern has declared the given message type
+func (pb *PatternBuilder) hasMsg(msgType string) bool {
+	for _, msg := range pb.cpil.Msgs {
+		if msg.MsgType == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+// Msg declares a message type used on the edges of the pattern
+func (pb *PatternBuilder) Msg(msgType string, isPckt bool) *PatternBuilder {
+	err := pb.cpil.AddMsg(CreateCompPatternMsg(msgType, isPckt))
+	if err != nil {
+		return pb.fail("%s", err.Error())
+	}
+	return pb
+}
+
+// Func adds a function of the given class to the pattern, with its cfg.  The cfg is either the cfg
+// struct of the class (e.g. a *ProcessPcktCfg), any value that serializes to it, a cfg already
+// serialized as a string, or nil for no cfg.  The cfg is checked against the schema of the class
+func (pb *PatternBuilder) Func(class, label string, cfg any) *PatternBuilder {
+	_, present := ClassMethods[class]
+	if !present {
+		return pb.fail("function %s has unrecognized class %s", label, class)
+	}
+	if pb.hasFunc(label) {
+		return pb.fail("function label %s is used twice", label)
+	}
+	fnc := CreateFunc(class, label)
+	pb.cpt.AddFunc(fnc)
+	if cfg == nil {
+		return pb
+	}
+
+	cfgStr, serialized := cfg.(string)
+	if !serialized {
+		bytes, err := yaml.Marshal(cfg)
+		if err != nil {
+			return pb.fail("function %s cfg: %s", label, err.Error())
+		}
+		cfgStr = string(bytes)
+	}
+	cfgErrs := ValidateCfgString(class, cfgStr, pb.cpt.Name+"."+label)
+	if len(cfgErrs) > 0 {
+		pb.mb.errs = append(pb.mb.errs, cfgErrs...)
+		return pb
+	}
+	if serialized {
+		pb.cpil.AddCfg(pb.cpt, fnc, cfgStr)
+		return pb
+	}
+	err := pb.cpil.AddCfgObject(pb.cpt, fnc, cfg)
+	if err != nil {
+		return pb.fail("function %s cfg: %s", label, err.Error())
+	}
+	return pb
+}
+
+// Edge adds an edge carrying messages of the given type from one function of the pattern to another.
+// Both functions and the message type must already have been added
+func (pb *PatternBuilder) Edge(srcLabel, msgType, dstLabel string) *PatternBuilder {
+	if !pb.hasFunc(srcLabel) {
+		return pb.fail("edge from undeclared function %s", srcLabel)
+	}
+	if !pb.hasFunc(dstLabel) {
+		return pb.fail("edge to undeclared function %s", dstLabel)
+	}
+	if !pb.hasMsg(msgType) {
+		return pb.fail("edge from %s to %s carries undeclared message type %s", srcLabel, dstLabel, msgType)
+	}
+	pb.cpt.AddEdge(srcLabel, dstLabel, msgType, &pb.cpil.Msgs)
+	return pb
+}
+
+// ExtEdge adds an edge from a function of the pattern to a function of another pattern.
+// The other pattern need not have been built yet; the edge is checked by Build
+func (pb *PatternBuilder) ExtEdge(srcLabel, msgType, dstCP, dstLabel string) *PatternBuilder {
+	if !pb.hasFunc(srcLabel) {
+		return pb.fail("external edge from undeclared function %s", srcLabel)
+	}
+	pb.cpt.AddExtEdge(pb.cpt.Name, dstCP, srcLabel, dstLabel, msgType, &pb.cpil.Msgs, nil)
+	return pb
+}
+
+// Service declares that the function with the given label offers the service srvOp
+func (pb *PatternBuilder) Service(srvOp, label string) *PatternBuilder {
+	if !pb.hasFunc(label) {
+		return pb.fail("service %s offered by undeclared function %s", srvOp, label)
+	}
+	pb.cpt.AddService(srvOp, label)
+	return pb
+}
+
+// Map places the function with the given label on a host, with the given priority
+func (pb *PatternBuilder) Map(label, host string, priority int) *PatternBuilder {
+	if !pb.hasFunc(label) {
+		return pb.fail("mapping of undeclared function %s", label)
+	}
+	err := pb.cpm.AddMapping(label, host, float64(priority), false)
+	if err != nil {
+		return pb.fail("%s", err.Error())
+	}
+	return pb
+}
+
+// MapAll places every function of the pattern not already mapped on a host, with the given priority
+func (pb *PatternBuilder) MapAll(host string, priority int) *PatternBuilder {
+	for _, fnc := range pb.cpt.Funcs {
+		_, present := pb.cpm.FuncMap[fnc.Label]
+		if !present {
+			pb.Map(fnc.Label, host, priority)
+		}
+	}
+	return pb
+}
+
+// Done returns to the ModelBuilder, to start another pattern or to build
+func (pb *PatternBuilder) Done() *ModelBuilder {
+	return pb.mb
+}
+
+// Err returns the problems found so far, nil if there are none
+func (mb *ModelBuilder) Err() error {
+	return ReportErrs(mb.errs)
+}
+
+// Build checks the model as a whole, that every external edge reaches a function that exists and
+// every function is mapped to a host, and returns the comp pattern, initialization, timing, and map
+// dictionaries of the model.  An error reports every problem found while building
+func (mb *ModelBuilder) Build() (*CompPatternDict, *CPInitListDict, *FuncExecList, *CompPatternMapDict, error) {
+	errs := append([]error{}, mb.errs...)
+	funcs := make(map[string]bool)
+	for _, pb := range mb.patterns {
+		for _, fnc := range pb.cpt.Funcs {
+			funcs[pb.cpt.Name+":"+fnc.Label] = true
+		}
+	}
+
+	cpd := CreateCompPatternDict(mb.Name)
+	cpid := CreateCPInitListDict(mb.Name)
+	cpmd := CreateCompPatternMapDict(mb.Name)
+	for _, pb := range mb.patterns {
+		for _, xedge := range pb.cpt.ExtEdges {
+			if !funcs[xedge.DstCP+":"+xedge.DstLabel] {
+				errs = append(errs, fmt.Errorf("comp pattern %s has external edge from %s to %s:%s, which does not exist",
+					pb.cpt.Name, xedge.SrcLabel, xedge.DstCP, xedge.DstLabel))
+			}
+		}
+		for _, fnc := range pb.cpt.Funcs {
+			_, present := pb.cpm.FuncMap[fnc.Label]
+			if !present {
+				errs = append(errs, fmt.Errorf("comp pattern %s function %s is not mapped to a host", pb.cpt.Name, fnc.Label))
+			}
+		}
+
+		// duplicate names have already been reported
+		if cpd.AddCompPattern(pb.cpt) != nil {
+			continue
+		}
+		cpid.AddCPInitList(pb.cpil)
+		cpmd.AddCompPatternMap(pb.cpm, false)
+	}
+
+	err := ReportErrs(errs)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return cpd, cpid, mb.fel, cpmd, nil
+}
+
+// WriteToFiles builds the model and writes its dictionaries to files named cp, cpInit, funcExec, and map
+// in dir, with the extension (yaml or json) given.  It returns the map from input flag to file name
+// that GetExperimentCPDicts reads
+func (mb *ModelBuilder) WriteToFiles(dir, ext string) (map[string]string, error) {
+	if !(ext == "yaml" || ext == "json") {
+		return nil, errors.New("model files are written as yaml or json")
+	}
+	cpd, cpid, fel, cpmd, err := mb.Build()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	syn := make(map[string]string)
+	for _, key := range []string{"cp", "cpInit", "funcExec", "map"} {
+		syn[key] = filepath.Join(dir, key+"."+ext)
+	}
+	cpd.WriteToFile(syn["cp"])
+	cpid.WriteToFile(syn["cpInit"])
+	fel.WriteToFile(syn["funcExec"])
+	cpmd.WriteToFile(syn["map"])
+	return syn, nil
+}
@@ -0,0 +1,101 @@
+package pces
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModelBuilderFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(mb *ModelBuilder)
+		errStr []string
+	}{
+		{
+			name:   "pattern name used twice",
+			setup:  func(mb *ModelBuilder) { mb.Pattern("chain", "chain1") },
+			errStr: []string{"model test has a second comp pattern named chain1"},
+		},
+		{
+			name: "timings",
+			setup: func(mb *ModelBuilder) {
+				mb.Timing("crypt", "", "x86", 2000, -1.0e-3).
+					Timing("crypt", "", "x86", 1000, 1.0e-3).
+					TimingModel("crypt", "cubic", 0).
+					DeriveCPUModel("x86", "x86", 0.5, nil)
+			},
+			errStr: []string{"timing of crypt on x86 has negative execution time",
+				"timing of crypt on x86 for packet length 1000 is given twice",
+				"timing model of crypt has unrecognized kind cubic",
+				"derived CPU model x86 is its own reference"},
+		},
+		{
+			name: "functions",
+			setup: func(mb *ModelBuilder) {
+				mb.Pattern("chain", "chain2").
+					Msg("req", true).
+					Msg("req", false).
+					Func("nosuch", "src", nil).
+					Func("finish", "sink", nil).
+					Func("finish", "sink", nil).
+					Func("processPckt", "proc", &StartCfg{}).
+					Func("processPckt", "hash", "timingcodes: {req: hash}").
+					MapAll("hostA", 1)
+			},
+			errStr: []string{"message type req for CP label chain2 has duplicate definition",
+				"comp pattern chain2: function src has unrecognized class nosuch",
+				"comp pattern chain2: function label sink is used twice",
+				"chain2.proc.pcktlen: unknown field",
+				"chain2.hash.timingcodes: unknown field"},
+		},
+		{
+			name: "edges, services, and mappings",
+			setup: func(mb *ModelBuilder) {
+				mb.Pattern("chain", "chain2").
+					Msg("req", true).
+					Func("start", "src", nil).
+					Func("finish", "sink", nil).
+					Edge("tap", "req", "sink").
+					Edge("src", "req", "tap").
+					Edge("src", "rsp", "sink").
+					ExtEdge("tap", "req", "chain1", "proc").
+					ExtEdge("src", "req", "chain1", "nosuch").
+					Service("lookup", "tap").
+					Map("tap", "hostA", 1).
+					Map("src", "hostA", 1).
+					Map("src", "hostB", 1)
+			},
+			errStr: []string{"comp pattern chain2: edge from undeclared function tap",
+				"comp pattern chain2: edge to undeclared function tap",
+				"comp pattern chain2: edge from src to sink carries undeclared message type rsp",
+				"comp pattern chain2: external edge from undeclared function tap",
+				"comp pattern chain2 has external edge from src to chain1:nosuch, which does not exist",
+				"comp pattern chain2: service lookup offered by undeclared function tap",
+				"comp pattern chain2: mapping of undeclared function tap",
+				"comp pattern chain2: attempt to overwrite mapping of func label src in chain2",
+				"comp pattern chain2 function sink is not mapped to a host"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mb := testModelBuilder()
+			tc.setup(mb)
+			cpd, cpid, fel, cpmd, err := mb.Build()
+			if err == nil {
+				t.Fatalf("Build gave no error, want %q", tc.errStr)
+			}
+			if cpd != nil || cpid != nil || fel != nil || cpmd != nil {
+				t.Errorf("Build returned dictionaries along with its error")
+			}
+			for _, errStr := range tc.errStr {
+				if !strings.Contains(err.Error(), errStr) {
+					t.Errorf("Build error = %v, want one containing %q", err, errStr)
+				}
+			}
+			if mb.Err() == nil {
+				t.Errorf("Err gave no error after building failed")
+			}
+		})
+	}
+}
@@ -220,13 +220,22 @@ var processPcktLoaded bool = RegisterFuncClass(ppVar)
 type ProcessPcktCfg struct {
 	// map method code to an operation for the timing lookup
 	TimingCode map[string]string `yaml:"timingcode" json:"timingcode"`
-	Msg2MC     map[string]string `yaml:"msg2mc" json:"msg2mc"`
-	Msg2Msg    map[string]string `yaml:"msg2msg" json:"msg2msg"`
+
+	// map method code to the param selecting among the timings of the operation, e.g. a key length
+	TimingParam map[string]string `yaml:"timingparam,omitempty" json:"timingparam,omitempty"`
+	Msg2MC      map[string]string `yaml:"msg2mc" json:"msg2mc"`
+	Msg2Msg     map[string]string `yaml:"msg2msg" json:"msg2msg"`
 
 	// if the packet is processed through an accelerator, its name in the destination endpoint
-	AccelName string   `yaml:"accelname" json:"accelname"`
-	Groups    []string `yaml:"groups" json:"groups"`
-	Trace     int      `yaml:"trace" json:"trace"`
+	AccelName string `yaml:"accelname" json:"accelname"`
+
+	// an operation may run on several cores at once, as Threads tasks that divide the fraction
+	// ParallelFrac of its execution time among them (Amdahl's law).  Given only ParallelFrac,
+	// Threads is the number of cores of the host; given only Threads, the whole time is divided
+	Threads      int      `yaml:"threads,omitempty" json:"threads,omitempty"`
+	ParallelFrac float64  `yaml:"parallelfrac,omitempty" json:"parallelfrac,omitempty"`
+	Groups       []string `yaml:"groups" json:"groups"`
+	Trace        int      `yaml:"trace" json:"trace"`
 }
 
 type ProcessPcktState struct {
@@ -260,7 +269,7 @@ func (pp *ProcessPcktCfg) CreateCfg(cfgStr string) any {
 	useYAML := (cfgStr[0] != '{')
 	ppVarAny, err := pp.Deserialize(cfgStr, useYAML)
 	if err != nil {
-		panic(fmt.Errorf("processPckt.InitCfg sees deserialization error"))
+		panic(cfgDecodeError(pp, cfgStr, err))
 	}
 	return ppVarAny
 }
@@ -277,6 +286,16 @@ func (pp *ProcessPcktCfg) InitCfg(evtMgr *evtm.EventManager, cpfi *CmpPtnFuncIns
 }
 
 func (pp *ProcessPcktCfg) ValidateCfg(cpfi *CmpPtnFuncInst) error {
+	ppc := cpfi.Cfg.(*ProcessPcktCfg)
+	if ppc.Threads < 0 {
+		return fmt.Errorf("function %s has negative threads", cpfi.GlobalName())
+	}
+	if ppc.ParallelFrac < 0.0 || ppc.ParallelFrac > 1.0 {
+		return fmt.Errorf("function %s has parallelfrac %g, not in [0,1]", cpfi.GlobalName(), ppc.ParallelFrac)
+	}
+	if ppc.Threads == 0 && ppc.ParallelFrac > 0.0 && len(ppc.AccelName) > 0 {
+		return fmt.Errorf("function %s gives parallelfrac on accelerator %s without threads", cpfi.GlobalName(), ppc.AccelName)
+	}
 	return nil
 }
 
@@ -340,26 +359,37 @@ func processPcktEnter(evtMgr *evtm.EventManager, cpfi *CmpPtnFuncInst, methodCod
 	// determine whether an accelerator call is part of this cpfi and if so get the right time and scheduler
 	var genTime float64
 	var scheduler *mrnes.TaskScheduler
+	var acct *CPUAccount
 
 	pps.MsgTypeIn = msg.MsgType
 	opCode := msg.MsgType
 
 	if len(ppc.AccelName) > 0 {
 		// look up the model associated with this name
-		genTime = AccelFuncExecTime(cpfi, ppc.AccelName, ppc.TimingCode[opCode], msg)
+		genTime = AccelFuncParamExecTime(cpfi, ppc.AccelName, ppc.TimingCode[opCode], ppc.TimingParam[opCode], msg)
 		scheduler = mrnes.AccelSchedulersByHostName[cpfi.Host][ppc.AccelName]
+		acct = cpuAccount(cpfi, ppc.AccelName)
 	} else {
 		// not an accelerator call. look up the generation service requirement.
-		genTime = HostFuncExecTime(cpfi, ppc.TimingCode[opCode], msg)
+		genTime = HostFuncParamExecTime(cpfi, ppc.TimingCode[opCode], ppc.TimingParam[opCode], msg)
 		scheduler = mrnes.TaskSchedulerByHostName[cpfi.Host]
+		acct = cpuAccount(cpfi, hostCPU)
 	}
+	acct.Executions += 1
 
 	endPtID := mrnes.EndptDevByName[cpfi.Host].DevID()
 	execID := msg.ExecID
 	AddCPTrace(TraceMgr, cpfi.Trace, evtMgr.CurrentTime(), execID, endPtID, FullFuncName(cpfi, "processPcktEnter"), msg)
 
-	// call the scheduler.
-	scheduler.Schedule(evtMgr, methodCode, genTime, cpfi.Priority, math.MaxFloat64, cpfi, msg, execID, endPtID, processPcktExit)
+	// an operation running on several cores is scheduled as a serial part and its threads
+	threads, frac := ppc.parallelism(cpfi.Host)
+	if threads > 1 {
+		scheduleParallel(evtMgr, cpfi, scheduler, acct, methodCode, genTime, threads, frac, msg, execID, endPtID)
+		return
+	}
+
+	// call the scheduler, charging the task to the function's account
+	acct.schedule(evtMgr, scheduler, methodCode, genTime, cpfi.Priority, cpfi, msg, execID, endPtID, processPcktExit)
 }
 
 // processPcktExit executes when the associated message did not get served immediately on being scheduled,
@@ -392,6 +422,7 @@ type StartState struct {
 	MsgLen    int
 	MsgType   string
 	StartTime float64
+	Param     string
 	Calls     int
 	Bespoke   any
 }
@@ -402,6 +433,7 @@ type StartCfg struct {
 	MsgType   string            `yaml:"msgtype" json:"msgtype"`
 	Data      string            `yaml:"data" json:"data"`
 	StartTime float64           `yaml:"starttime" json:"starttime"`
+	Param     string            `yaml:"param,omitempty" json:"param,omitempty"` // timing param carried by the messages started
 	Msg2MC    map[string]string `yaml:"msg2mc" json:"msg2mc"`
 	Groups    []string          `yaml:"groups" json:"groups"`
 	Trace     int               `yaml:"trace" json:"trace"`
@@ -420,6 +452,7 @@ func createStartState(scfg *StartCfg) *StartState {
 	srt.PcktLen = scfg.PcktLen
 	srt.MsgType = scfg.MsgType
 	srt.StartTime = scfg.StartTime
+	srt.Param = scfg.Param
 	return srt
 }
 
@@ -431,7 +464,7 @@ func (srt *StartCfg) CreateCfg(cfgStr string) any {
 	useYAML := cfgStr[0] != '{'
 	srtVarAny, err := srt.Deserialize(cfgStr, useYAML)
 	if err != nil {
-		panic(fmt.Errorf("start.InitCfg sees deserialization error with %s", cfgStr))
+		panic(cfgDecodeError(srt, cfgStr, err))
 	}
 	return srtVarAny
 }
@@ -514,6 +547,9 @@ func startEnter(evtMgr *evtm.EventManager, cpfi *CmpPtnFuncInst, methodCode stri
 	cpm.PcktLen = srts.PcktLen
 	cpm.MsgLen = srts.MsgLen
 	cpm.MsgType = srts.MsgType
+	if len(srts.Param) > 0 {
+		cpm.Param = srts.Param
+	}
 
 	cpm.ExecID = NewExecID(cpfi.PtnName, cpfi.Label)
 
@@ -569,7 +605,7 @@ func (fnsh *FinishCfg) CreateCfg(cfgStr string) any {
 	useYAML := cfgStr[0] != '{'
 	fnshVarAny, err := fnsh.Deserialize(cfgStr, useYAML)
 	if err != nil {
-		panic(fmt.Errorf("finish.InitCfg sees deserialization error"))
+		panic(cfgDecodeError(fnsh, cfgStr, err))
 	}
 	return fnshVarAny
 }
@@ -646,6 +682,9 @@ func finishEnter(evtMgr *evtm.EventManager, cpfi *CmpPtnFuncInst, methodCode str
 	endpt := mrnes.EndptDevByName[endptName]
 	AddCPTrace(TraceMgr, cpfi.Trace, evtMgr.CurrentTime(), msg.ExecID,
 		endpt.DevID(), FullFuncName(cpfi, "finishEnter"), msg)
+
+	// the execution thread ends here, there is no ExitFunc to note the departure
+	cpfi.noteDeparture(evtMgr.CurrentSeconds())
 }
 
 // -------- methods and state for function class srvRsp
@@ -665,6 +704,7 @@ type SrvRspState struct {
 type SrvRspCfg struct {
 	// chosen op, for timing
 	TimingCode   map[string]string `yaml:"timingcode" json:"timingcode"`
+	TimingParam  map[string]string `yaml:"timingparam,omitempty" json:"timingparam,omitempty"`
 	Msg2MC       map[string]string `yaml:"msg2mc" json:"msg2mc"`
 	DirectPrefix []string          `yaml:"directprefix" json:"directprefix"`
 	Groups       []string          `yaml:"groups" json:"groups"`
@@ -693,7 +733,7 @@ func (srvRsp *SrvRspCfg) CreateCfg(cfgStr string) any {
 	useYAML := (cfgStr[0] != '{')
 	srvRspVarAny, err := srvRsp.Deserialize(cfgStr, useYAML)
 	if err != nil {
-		panic(fmt.Errorf("srvRsp.InitCfg sees deserialization error"))
+		panic(cfgDecodeError(srvRsp, cfgStr, err))
 	}
 	return srvRspVarAny
 }
@@ -802,7 +842,7 @@ func srvRspEnter(evtMgr *evtm.EventManager, cpfi *CmpPtnFuncInst, methodCode str
 	} else {
 		tcCode = arpc.TimingCode[msg.MsgType]
 	}
-	genTime := HostFuncExecTime(cpfi, tcCode, msg)
+	genTime := HostFuncParamExecTime(cpfi, tcCode, arpc.TimingParam[msg.MsgType], msg)
 
 	msg.CPID = msg.RtnCPID
 	msg.Label = msg.RtnLabel
@@ -832,6 +872,7 @@ type SrvReqCfg struct {
 	SrvCP    string            `yaml:"srvcp" json:"srvcp"`
 	SrvOp    string            `yaml:"srvop" json:"srvop"`
 	RspOp    string            `yaml:"rspop" json:"rspop"`
+	RspParam string            `yaml:"rspparam,omitempty" json:"rspparam,omitempty"`
 	SrvLabel string            `yaml:"srvlabel" json:"srvlabel"`
 	Msg2MC   map[string]string `yaml:"msg2mc" json:"msg2mc"`
 	Msg2Msg  map[string]string `yaml:"op2msg" json:"op2msg"`
@@ -860,7 +901,7 @@ func (srvReq *SrvReqCfg) CreateCfg(cfgStr string) any {
 	useYAML := (cfgStr[0] != '{')
 	srvReqVarAny, err := srvReq.Deserialize(cfgStr, useYAML)
 	if err != nil {
-		panic(fmt.Errorf("srvReq.InitCfg sees deserialization error"))
+		panic(cfgDecodeError(srvReq, cfgStr, err))
 	}
 	return srvReqVarAny
 }
@@ -1044,7 +1085,7 @@ func srvReqRtn(evtMgr *evtm.EventManager, cpfi *CmpPtnFuncInst, methodCode strin
 	// add response return processing delay, if indicated
 	var rspTime float64
 	if len(srqc.RspOp) > 0 {
-		rspTime = HostFuncExecTime(cpfi, srqc.RspOp, msg)
+		rspTime = HostFuncParamExecTime(cpfi, srqc.RspOp, srqc.RspParam, msg)
 	}
 
 	outMsgType := srqc.Msg2Msg[srqs.MsgTypeIn]
@@ -1098,7 +1139,7 @@ func (trnsfr *TransferCfg) CreateCfg(cfgStr string) any {
 	useYAML := (cfgStr[0] != '{')
 	transferVarAny, err := trnsfr.Deserialize(cfgStr, useYAML)
 	if err != nil {
-		panic(fmt.Errorf("transfer.InitCfg sees deserialization error"))
+		panic(cfgDecodeError(trnsfr, cfgStr, err))
 	}
 	return transferVarAny
 }
@@ -1249,7 +1290,7 @@ func (bgld *BckgrndLdCfg) CreateCfg(cfgStr string) any {
 	useYAML := (cfgStr[0] != '{')
 	bgldVarAny, err := bgld.Deserialize(cfgStr, useYAML)
 	if err != nil {
-		panic(fmt.Errorf("bckgrndLd.InitCfg sees deserialization error"))
+		panic(cfgDecodeError(bgld, cfgStr, err))
 	}
 	return bgldVarAny
 }
@@ -1391,7 +1432,7 @@ func (measure *MeasureCfg) CreateCfg(cfgStr string) any {
 	useYAML := (cfgStr[0] != '{')
 	measureVarAny, err := measure.Deserialize(cfgStr, useYAML)
 	if err != nil {
-		panic(fmt.Errorf("measure.InitCfg sees deserialization error"))
+		panic(cfgDecodeError(measure, cfgStr, err))
 	}
 	return measureVarAny
 }
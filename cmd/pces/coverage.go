@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/mrnes"
+	"github.com/iti/pces"
+	"strconv"
+	"strings"
+)
+
+// runCoverage reads a model, its map, timings, and topology, and reports the timings the mapped functions
+// can look up that are missing, derived, or extrapolated beyond the packet lengths timed, and the timing
+// tables whose values are suspicious.  With -json the report is also written as json (or yaml)
+func runCoverage(args []string) error {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "inputLib", false)  // directory holding the input files
+	cp.AddFlag(cmdline.StringFlag, "cp", true)         // comp pattern dictionary
+	cp.AddFlag(cmdline.StringFlag, "cpInit", true)     // comp pattern initialization dictionary
+	cp.AddFlag(cmdline.StringFlag, "funcExec", true)   // function timings
+	cp.AddFlag(cmdline.StringFlag, "map", true)        // map of functions to hosts
+	cp.AddFlag(cmdline.StringFlag, "topo", true)       // mrnes topology
+	cp.AddFlag(cmdline.StringFlag, "sharedCfg", false) // shared cfg groups
+	cp.AddFlag(cmdline.StringFlag, "pcktlens", false)  // comma-separated packet lengths sent, besides those of start cfgs
+	cp.AddFlag(cmdline.StringFlag, "json", false)      // file where the report is written
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	inputDir := ""
+	if cp.IsLoaded("inputLib") {
+		inputDir = cp.GetVar("inputLib").(string)
+	}
+
+	pcktLens := []int{}
+	if cp.IsLoaded("pcktlens") {
+		for _, plStr := range strings.Split(cp.GetVar("pcktlens").(string), ",") {
+			pl, err := strconv.Atoi(strings.TrimSpace(plStr))
+			if err != nil {
+				return fmt.Errorf("packet length %s is not an integer", plStr)
+			}
+			pcktLens = append(pcktLens, pl)
+		}
+	}
+
+	cpd, err := pces.ReadCompPatternDictLayers(inDirLayers(inputDir, cp.GetVar("cp").(string)))
+	if err != nil {
+		return err
+	}
+	cpid, err := pces.ReadCPInitListDictLayers(inDirLayers(inputDir, cp.GetVar("cpInit").(string)))
+	if err != nil {
+		return err
+	}
+	fel, err := pces.ReadFuncExecListLayers(inDirLayers(inputDir, cp.GetVar("funcExec").(string)))
+	if err != nil {
+		return err
+	}
+	mapFile := inDir(inputDir, cp.GetVar("map").(string))
+	cpmd, err := pces.ReadCompPatternMapDict(mapFile, isYAML(mapFile), []byte{})
+	if err != nil {
+		return err
+	}
+	var ssgl *pces.SharedCfgGroupList
+	if cp.IsLoaded("sharedCfg") {
+		sharedFile := inDir(inputDir, cp.GetVar("sharedCfg").(string))
+		ssgl, err = pces.ReadSharedCfgGroupList(sharedFile, isYAML(sharedFile), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	topoFile := inDir(inputDir, cp.GetVar("topo").(string))
+	topo, err := mrnes.ReadTopoCfg(topoFile, isYAML(topoFile), []byte{})
+	if err != nil {
+		return err
+	}
+
+	tc := pces.CheckTimingCoverage(cpd, cpid, ssgl, fel, cpmd, topo, pcktLens)
+	fmt.Print(tc.Report())
+	if cp.IsLoaded("json") {
+		err = tc.WriteToFile(cp.GetVar("json").(string))
+		if err != nil {
+			return err
+		}
+	}
+	if tc.Missing() > 0 {
+		return fmt.Errorf("%d timings missing", tc.Missing())
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/pces"
+)
+
+// runDiff compares two versions of a model, held in the -old and -new directories under the same
+// file names, and reports the patterns, functions, edges, cfg fields, mappings, and timings that differ.
+// Only the kinds of file named are compared.  With -json the differences are also written as json (or yaml)
+func runDiff(args []string) error {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "old", true)       // directory holding the earlier version
+	cp.AddFlag(cmdline.StringFlag, "new", true)       // directory holding the later version
+	cp.AddFlag(cmdline.StringFlag, "cp", false)       // comp pattern dictionary
+	cp.AddFlag(cmdline.StringFlag, "cpInit", false)   // comp pattern initialization dictionary
+	cp.AddFlag(cmdline.StringFlag, "funcExec", false) // function timings
+	cp.AddFlag(cmdline.StringFlag, "map", false)      // map of functions to hosts
+	cp.AddFlag(cmdline.StringFlag, "json", false)     // file where the differences are written
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	if !(cp.IsLoaded("cp") || cp.IsLoaded("cpInit") || cp.IsLoaded("funcExec") || cp.IsLoaded("map")) {
+		return fmt.Errorf("no input files named")
+	}
+
+	oldDescs, err := readModelDescs(cp, cp.GetVar("old").(string))
+	if err != nil {
+		return err
+	}
+	newDescs, err := readModelDescs(cp, cp.GetVar("new").(string))
+	if err != nil {
+		return err
+	}
+
+	md := pces.DiffModels(oldDescs, newDescs)
+	fmt.Print(md.Report())
+	if cp.IsLoaded("json") {
+		return md.WriteToFile(cp.GetVar("json").(string))
+	}
+	return nil
+}
+
+// readModelDescs reads from a directory the model files named on the command line
+func readModelDescs(cp *cmdline.CmdParser, dir string) (*pces.ModelDescs, error) {
+	descs := new(pces.ModelDescs)
+	var err error
+	if cp.IsLoaded("cp") {
+		descs.CPD, err = pces.ReadCompPatternDictLayers(inDirLayers(dir, cp.GetVar("cp").(string)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cp.IsLoaded("cpInit") {
+		descs.CPID, err = pces.ReadCPInitListDictLayers(inDirLayers(dir, cp.GetVar("cpInit").(string)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cp.IsLoaded("funcExec") {
+		descs.FEL, err = pces.ReadFuncExecListLayers(inDirLayers(dir, cp.GetVar("funcExec").(string)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cp.IsLoaded("map") {
+		mapFile := inDir(dir, cp.GetVar("map").(string))
+		descs.CPMD, err = pces.ReadCompPatternMapDict(mapFile, isYAML(mapFile), []byte{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return descs, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/pces"
+)
+
+// runFit fits the timing model selected for each operation in a timing file to its timings, and reports
+// how closely each fit reproduces them.  With -kind every operation is fitted with that kind of model
+// instead, so that estimators may be compared before one is chosen
+func runFit(args []string) error {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "inputLib", false) // directory holding the input files
+	cp.AddFlag(cmdline.StringFlag, "funcExec", true)  // function timings
+	cp.AddFlag(cmdline.StringFlag, "kind", false)     // timing model fitted to every operation
+	cp.AddFlag(cmdline.IntFlag, "degree", false)      // degree of a polynomial timing model
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	inputDir := ""
+	if cp.IsLoaded("inputLib") {
+		inputDir = cp.GetVar("inputLib").(string)
+	}
+	fel, err := pces.ReadFuncExecListLayers(inDirLayers(inputDir, cp.GetVar("funcExec").(string)))
+	if err != nil {
+		return err
+	}
+
+	if cp.IsLoaded("kind") {
+		degree := 0
+		if cp.IsLoaded("degree") {
+			degree = cp.GetVar("degree").(int)
+		}
+		for op := range fel.Times {
+			err = fel.SetTimingModel(op, cp.GetVar("kind").(string), degree)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	fits, err := pces.FitTimings(fel)
+	if len(fits) == 0 {
+		return err
+	}
+	fmt.Printf("%-20s %-12s %-10s %-12s %6s %12s %10s %8s\n", "op", "cpumodel", "param", "model", "points", "rmse", "maxrelerr", "r2")
+	for _, fit := range fits {
+		fmt.Printf("%-20s %-12s %-10s %-12s %6d %12.4g %10.4f %8.4f\n",
+			fit.Op, fit.CPUModel, fit.Param, fit.Kind, fit.Points, fit.RMSE, fit.MaxRelErr, fit.R2)
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/pces"
+)
+
+// runGraph reads a comp pattern dictionary (and optionally a map) and writes
+// a diagram of it as Graphviz DOT, Mermaid, or GraphML
+func runGraph(args []string) error {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "inputLib", false) // directory holding the input files
+	cp.AddFlag(cmdline.StringFlag, "cp", true)        // comp pattern dictionary
+	cp.AddFlag(cmdline.StringFlag, "map", false)      // map of functions to hosts, to annotate the functions
+	cp.AddFlag(cmdline.StringFlag, "format", false)   // dot, mermaid, or graphml.  Default from the output extension
+	cp.AddFlag(cmdline.StringFlag, "out", true)       // output file
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	inputDir := ""
+	if cp.IsLoaded("inputLib") {
+		inputDir = cp.GetVar("inputLib").(string)
+	}
+
+	cpd, err := pces.ReadCompPatternDictLayers(inDirLayers(inputDir, cp.GetVar("cp").(string)))
+	if err != nil {
+		return err
+	}
+
+	var cpmd *pces.CompPatternMapDict
+	if cp.IsLoaded("map") {
+		mapFile := inDir(inputDir, cp.GetVar("map").(string))
+		cpmd, err = pces.ReadCompPatternMapDict(mapFile, isYAML(mapFile), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+
+	outFile := cp.GetVar("out").(string)
+	format := pces.GraphFormatByExt(outFile)
+	if cp.IsLoaded("format") {
+		format = cp.GetVar("format").(string)
+	}
+	if len(format) == 0 {
+		return fmt.Errorf("graph format not given and not implied by the extension of %s", outFile)
+	}
+	return pces.WriteGraphToFile(cpd, cpmd, format, outFile)
+}
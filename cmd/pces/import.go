@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/pces"
+	"os"
+	"strings"
+)
+
+// runImport reads benchmark output (-format gobench, csv, or json) and writes the timings found in it
+// as a funcExec file.  With -merge the timings are merged into those of an existing file, replacing
+// timings of the same operation, param, CPU model, and packet length, and written back to it unless -out is given.
+// The merge keeps the include list of the existing file, and is refused if a timing merged differs from one it includes
+func runImport(args []string) error {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "in", true)        // file holding the benchmark output
+	cp.AddFlag(cmdline.StringFlag, "format", true)    // gobench, csv, or json
+	cp.AddFlag(cmdline.StringFlag, "out", false)      // funcExec file written
+	cp.AddFlag(cmdline.StringFlag, "merge", false)    // existing funcExec file the timings are merged into
+	cp.AddFlag(cmdline.StringFlag, "cpumodel", false) // CPU model of timings the input does not give one for
+	cp.AddFlag(cmdline.IntFlag, "pcktlen", false)     // packet length of timings the input does not give one for
+	cp.AddFlag(cmdline.StringFlag, "pattern", false)  // regular expression mapping benchmark names to op, param, and pcktlen
+	cp.AddFlag(cmdline.StringFlag, "columns", false)  // comma-separated field=column pairs, e.g. identifier=Op,exectime=Mean
+	cp.AddFlag(cmdline.StringFlag, "units", false)    // unit of csv and json times: s, ms, us, ns
+	cp.AddFlag(cmdline.StringFlag, "listname", false) // name of the timing list written
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	if !(cp.IsLoaded("out") || cp.IsLoaded("merge")) {
+		return fmt.Errorf("import needs -out or -merge to name the file written")
+	}
+
+	opts := pces.ImportOptions{Columns: make(map[string]string)}
+	if cp.IsLoaded("cpumodel") {
+		opts.CPUModel = cp.GetVar("cpumodel").(string)
+	}
+	if cp.IsLoaded("pcktlen") {
+		opts.PcktLen = cp.GetVar("pcktlen").(int)
+	}
+	if cp.IsLoaded("pattern") {
+		opts.NamePattern = cp.GetVar("pattern").(string)
+	}
+	if cp.IsLoaded("units") {
+		opts.TimeUnit = cp.GetVar("units").(string)
+	}
+	if cp.IsLoaded("listname") {
+		opts.ListName = cp.GetVar("listname").(string)
+	}
+	if cp.IsLoaded("columns") {
+		for _, pair := range strings.Split(cp.GetVar("columns").(string), ",") {
+			field, column, found := strings.Cut(pair, "=")
+			if !found {
+				return fmt.Errorf("column mapping %s is not of the form field=column", pair)
+			}
+			opts.Columns[field] = column
+		}
+	}
+
+	dict, err := os.ReadFile(cp.GetVar("in").(string))
+	if err != nil {
+		return err
+	}
+	var fel *pces.FuncExecList
+	switch cp.GetVar("format").(string) {
+	case "gobench":
+		fel, err = pces.ImportGoBench(dict, opts)
+	case "csv":
+		fel, err = pces.ImportCSV(dict, opts)
+	case "json":
+		fel, err = pces.ImportJSON(dict, opts)
+	default:
+		return fmt.Errorf("import format %s is not one of gobench, csv, json", cp.GetVar("format").(string))
+	}
+	if err != nil {
+		return err
+	}
+
+	outFile := ""
+	if cp.IsLoaded("merge") {
+		mergeFile := cp.GetVar("merge").(string)
+		fel, err = pces.MergeImported(mergeFile, isYAML(mergeFile), fel)
+		if err != nil {
+			return err
+		}
+		outFile = mergeFile
+	}
+	if cp.IsLoaded("out") {
+		outFile = cp.GetVar("out").(string)
+	}
+
+	count := 0
+	for _, fedList := range fel.Times {
+		count += len(fedList)
+	}
+	fmt.Printf("writing %d timings of %d operations to %s\n", count, len(fel.Times), outFile)
+	return fel.WriteToFile(outFile)
+}
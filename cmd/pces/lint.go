@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/pces"
+	"strings"
+)
+
+// runLint reads the comp pattern, initialization, timing, and map files of a model
+// and reports the structural problems found in them, without building the network or running
+func runLint(args []string) (err error) {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "inputLib", false)  // directory holding the input files
+	cp.AddFlag(cmdline.StringFlag, "cp", true)         // comp pattern dictionary
+	cp.AddFlag(cmdline.StringFlag, "cpInit", true)     // comp pattern initialization dictionary
+	cp.AddFlag(cmdline.StringFlag, "funcExec", true)   // function timings
+	cp.AddFlag(cmdline.StringFlag, "map", true)        // map of functions to hosts
+	cp.AddFlag(cmdline.StringFlag, "sharedCfg", false) // shared cfg groups
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	inputDir := ""
+	if cp.IsLoaded("inputLib") {
+		inputDir = cp.GetVar("inputLib").(string)
+	}
+
+	syn := make(map[string]string)
+	for _, key := range []string{"cp", "cpInit", "funcExec", "map"} {
+		syn[key] = strings.Join(inDirLayers(inputDir, cp.GetVar(key).(string)), ",")
+	}
+
+	// the readers panic on files that cannot be read or parsed
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	cpd, cpid, fel, cpmd := pces.GetExperimentCPDicts(syn)
+
+	var ssgl *pces.SharedCfgGroupList
+	if cp.IsLoaded("sharedCfg") {
+		sharedFile := inDir(inputDir, cp.GetVar("sharedCfg").(string))
+		ssgl, err = pces.ReadSharedCfgGroupList(sharedFile, isYAML(sharedFile), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+
+	errs := pces.LintModel(cpd, cpid, ssgl, fel, cpmd)
+	for _, lintErr := range errs {
+		fmt.Println(lintErr)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d problems found", len(errs))
+	}
+	fmt.Println("no problems found")
+	return nil
+}
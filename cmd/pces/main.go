@@ -0,0 +1,58 @@
+// Command pces gathers tools that operate on pces model files outside of a simulation run.
+// The first argument names the tool, the remaining arguments are flags for it, e.g.
+//
+//	pces place -cp cp.yaml -cpInit cpInit.yaml -funcExec funcExec.yaml -topo topo.yaml -map map.yaml
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// a tool is given the flags that follow its name on the command line, and returns an error on failure
+type tool struct {
+	run   func(args []string) error
+	usage string
+}
+
+var tools map[string]tool = map[string]tool{
+	"coverage": {run: runCoverage, usage: "report timings the mapped model needs that are missing, extrapolated, or suspicious"},
+	"diff":     {run: runDiff, usage: "report the structural differences between two versions of a model"},
+	"fit":      {run: runFit, usage: "report how closely the timing model of each operation fits its timings"},
+	"graph":    {run: runGraph, usage: "write a diagram of the comp patterns as DOT, Mermaid, or GraphML"},
+	"import":   {run: runImport, usage: "build or extend a funcExec file from go test -bench, CSV, or JSON output"},
+	"lint":     {run: runLint, usage: "report structural problems in the model files"},
+	"migrate":  {run: runMigrate, usage: "upgrade model files to the current format version"},
+	"place":    {run: runPlace, usage: "choose a host for every function and write the map file"},
+	"schema":   {run: runSchema, usage: "write JSON Schema files for the input formats and class cfgs"},
+	"validate": {run: runValidate, usage: "check input files against their schemas, reporting field paths"},
+}
+
+func usage() {
+	fmt.Println("usage: pces <tool> [flags]")
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	for _, name := range sortedStrings(names) {
+		fmt.Printf("  %-10s %s\n", name, tools[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	t, present := tools[os.Args[1]]
+	if !present {
+		fmt.Printf("unrecognized tool %s\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	err := t.run(os.Args[2:])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
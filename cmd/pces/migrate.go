@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/pces"
+	"os"
+	"path/filepath"
+)
+
+// migrateKinds lists the kinds of file migrate upgrades, cp first so that the classes
+// of functions it gives are known when the cpInit file is upgraded
+var migrateKinds []string = []string{"cp", "cpInit", "funcExec", "map"}
+
+// runMigrate upgrades each model file named to the current format version, reporting every
+// transformation applied.  Upgraded files are written to the -out directory under their own names,
+// or replace the originals when no -out directory is given
+func runMigrate(args []string) error {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "inputLib", false) // directory holding the input files
+	cp.AddFlag(cmdline.StringFlag, "out", false)      // directory where upgraded files are written
+	for _, kind := range migrateKinds {
+		cp.AddFlag(cmdline.StringFlag, kind, false)
+	}
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	inputDir := ""
+	if cp.IsLoaded("inputLib") {
+		inputDir = cp.GetVar("inputLib").(string)
+	}
+	outDir := ""
+	if cp.IsLoaded("out") {
+		outDir = cp.GetVar("out").(string)
+		err := os.MkdirAll(outDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	var cpd *pces.CompPatternDict
+	migrated := 0
+	for _, kind := range migrateKinds {
+		if !cp.IsLoaded(kind) {
+			continue
+		}
+		filename := inDir(inputDir, cp.GetVar(kind).(string))
+		dict, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		upgraded, notes, err := pces.UpgradeDocument(kind, dict, isYAML(filename), cpd)
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err.Error())
+		}
+		migrated += 1
+
+		// the upgraded cp file gives the classes the cpInit upgrade needs
+		if kind == "cp" {
+			cpd, err = pces.ReadCompPatternDict(filename, isYAML(filename), upgraded)
+			if err != nil {
+				return fmt.Errorf("%s: %s", filename, err.Error())
+			}
+		}
+
+		if len(notes) == 0 {
+			fmt.Printf("%s: already at format version %d\n", filename, pces.ModelFormatVersion)
+			continue
+		}
+		for _, note := range notes {
+			fmt.Printf("%s: %s\n", filename, note)
+		}
+
+		outFile := filename
+		if len(outDir) > 0 {
+			outFile = filepath.Join(outDir, filepath.Base(filename))
+		}
+		err = os.WriteFile(outFile, upgraded, 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Println("wrote", outFile)
+	}
+	if migrated == 0 {
+		return fmt.Errorf("no input files named")
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/mrnes"
+	"github.com/iti/pces"
+)
+
+// runPlace reads a model, its timings, and a topology, runs the placement optimizer,
+// and writes the resulting CompPatternMapDict
+func runPlace(args []string) error {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "inputLib", false)  // directory holding the input files
+	cp.AddFlag(cmdline.StringFlag, "cp", true)         // comp pattern dictionary
+	cp.AddFlag(cmdline.StringFlag, "cpInit", true)     // comp pattern initialization dictionary
+	cp.AddFlag(cmdline.StringFlag, "funcExec", true)   // function timings
+	cp.AddFlag(cmdline.StringFlag, "topo", true)       // mrnes topology
+	cp.AddFlag(cmdline.StringFlag, "spec", false)      // placement constraints and objective
+	cp.AddFlag(cmdline.StringFlag, "objective", false) // objective, overriding that of the spec
+	cp.AddFlag(cmdline.StringFlag, "map", true)        // output map file
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	inputDir := ""
+	if cp.IsLoaded("inputLib") {
+		inputDir = cp.GetVar("inputLib").(string)
+	}
+
+	cpd, err := pces.ReadCompPatternDictLayers(inDirLayers(inputDir, cp.GetVar("cp").(string)))
+	if err != nil {
+		return err
+	}
+
+	cpid, err := pces.ReadCPInitListDictLayers(inDirLayers(inputDir, cp.GetVar("cpInit").(string)))
+	if err != nil {
+		return err
+	}
+
+	fel, err := pces.ReadFuncExecListLayers(inDirLayers(inputDir, cp.GetVar("funcExec").(string)))
+	if err != nil {
+		return err
+	}
+
+	topoFile := inDir(inputDir, cp.GetVar("topo").(string))
+	topo, err := mrnes.ReadTopoCfg(topoFile, isYAML(topoFile), []byte{})
+	if err != nil {
+		return err
+	}
+
+	spec := pces.CreatePlacementSpec("placement", "latency")
+	if cp.IsLoaded("spec") {
+		specFile := inDir(inputDir, cp.GetVar("spec").(string))
+		spec, err = pces.ReadPlacementSpec(specFile, isYAML(specFile), []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	if cp.IsLoaded("objective") {
+		spec.Objective = cp.GetVar("objective").(string)
+	}
+
+	cpmd, pe, err := pces.PlaceFuncs(cpd, cpid, fel, topo, spec)
+	if err != nil {
+		return err
+	}
+
+	mapFile := cp.GetVar("map").(string)
+	err = cpmd.WriteToFile(mapFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("estimated latency %g, maximum host load %g, %d edges between hosts\n", pe.Latency, pe.MaxLoad, pe.Cut)
+	for _, host := range sortedKeys(pe.HostLoad) {
+		fmt.Printf("  %-16s load %g\n", host, pe.HostLoad[host])
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map, sorted
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return sortedStrings(keys)
+}
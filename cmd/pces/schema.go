@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/pces"
+	"os"
+)
+
+// runSchema writes JSON Schema files for the pces input formats and function class cfgs,
+// for use by editors and external validators
+func runSchema(args []string) error {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "out", true) // directory where schema files are written
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	outDir := cp.GetVar("out").(string)
+	err := os.MkdirAll(outDir, 0755)
+	if err != nil {
+		return err
+	}
+	written, err := pces.WriteSchemaFiles(outDir)
+	for _, filename := range written {
+		fmt.Println("wrote", filename)
+	}
+	return err
+}
+
+// runValidate checks each input file named against the schema of its kind, and the cfg of every
+// function against the schema of its class when both the cp and cpInit files are named
+func runValidate(args []string) error {
+	cp := cmdline.NewCmdParser()
+	cp.AddFlag(cmdline.StringFlag, "inputLib", false) // directory holding the input files
+	for _, kind := range pces.SchemaKinds() {
+		cp.AddFlag(cmdline.StringFlag, kind, false)
+	}
+	if err := parseArgs(cp, args); err != nil {
+		return err
+	}
+
+	inputDir := ""
+	if cp.IsLoaded("inputLib") {
+		inputDir = cp.GetVar("inputLib").(string)
+	}
+
+	files := make(map[string]string)
+	problems := 0
+	for _, kind := range pces.SchemaKinds() {
+		if !cp.IsLoaded(kind) {
+			continue
+		}
+		filename := inDir(inputDir, cp.GetVar(kind).(string))
+		files[kind] = filename
+		dict, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		for _, verr := range pces.ValidateDocument(kind, dict, isYAML(filename)) {
+			fmt.Printf("%s: %s\n", filename, verr)
+			problems += 1
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no input files named")
+	}
+
+	// cfgs can be checked only when the class of every function is known
+	if problems == 0 && len(files["cp"]) > 0 && len(files["cpInit"]) > 0 {
+		cpd, err := pces.ReadCompPatternDict(files["cp"], isYAML(files["cp"]), []byte{})
+		if err != nil {
+			return err
+		}
+		cpid, err := pces.ReadCPInitListDict(files["cpInit"], isYAML(files["cpInit"]), []byte{})
+		if err != nil {
+			return err
+		}
+		for _, verr := range pces.ValidateModelCfgs(cpd, cpid) {
+			fmt.Printf("%s: %s\n", files["cpInit"], verr)
+			problems += 1
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problems found", problems)
+	}
+	fmt.Println("no problems found")
+	return nil
+}
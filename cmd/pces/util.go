@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iti/cmdline"
+	"github.com/iti/pces"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sortedStrings returns a sorted copy of its argument
+func sortedStrings(strs []string) []string {
+	rtn := make([]string, len(strs))
+	copy(rtn, strs)
+	sort.Strings(rtn)
+	return rtn
+}
+
+// isYAML reports whether a file name has a yaml extension.  Anything else is taken to be json
+func isYAML(filename string) bool {
+	ext := path.Ext(filename)
+	return ext == ".yaml" || ext == ".YAML" || ext == ".yml"
+}
+
+// inDir joins a directory and file name, unless the directory is empty or the name is absolute
+func inDir(dir, filename string) string {
+	if len(dir) == 0 || filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(dir, filename)
+}
+
+// inDirLayers applies inDir to each file of a comma-separated base file and overlays
+func inDirLayers(dir, files string) []string {
+	layers := pces.LayerFiles(files)
+	for idx := range layers {
+		layers[idx] = inDir(dir, layers[idx])
+	}
+	return layers
+}
+
+// parseArgs sets the flags of the parser from the arguments as the shell split them, so that
+// a value holding spaces (a path, say) stays whole.  A flag followed by another flag, or by nothing,
+// is a bool set true.  Required flags left unset are reported as an error
+func parseArgs(cp *cmdline.CmdParser, args []string) (err error) {
+	// cmdline panics on required flags that are missing
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	idx := 0
+	for idx < len(args) {
+		if !strings.HasPrefix(args[idx], "-") {
+			return fmt.Errorf("expected a flag at %s", args[idx])
+		}
+		flag := strings.TrimPrefix(args[idx], "-")
+		if !cp.IsFlag(flag) {
+			return fmt.Errorf("unrecognized flag -%s", flag)
+		}
+		value := "true"
+		idx += 1
+		if idx < len(args) && !isFlagArg(args[idx]) {
+			value = args[idx]
+			idx += 1
+		}
+		cp.SetVar(flag, value)
+	}
+
+	// parsing nothing leaves the flags set and checks for required ones missing
+	cp.ParseFromString("")
+	return nil
+}
+
+// isFlagArg reports whether an argument is a flag rather than a value, negative numbers being values
+func isFlagArg(arg string) bool {
+	if !strings.HasPrefix(arg, "-") {
+		return false
+	}
+	_, err := strconv.ParseFloat(arg, 64)
+	return err != nil
+}
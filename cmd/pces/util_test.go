@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/iti/cmdline"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		errStr string
+		check  func(t *testing.T, cp *cmdline.CmdParser)
+	}{
+		{
+			name: "values kept whole",
+			args: []string{"-cp", "my model/cp.yaml", "-shift", "-2.5", "-json"},
+			check: func(t *testing.T, cp *cmdline.CmdParser) {
+				if cp.GetVar("cp").(string) != "my model/cp.yaml" {
+					t.Errorf("cp is %q", cp.GetVar("cp"))
+				}
+				if cp.GetVar("shift").(float64) != -2.5 {
+					t.Errorf("shift is %v, want -2.5", cp.GetVar("shift"))
+				}
+				if !cp.GetVar("json").(bool) {
+					t.Errorf("json flag given without a value not set")
+				}
+			},
+		},
+		{
+			name: "bool followed by a flag",
+			args: []string{"-json", "-cp", "cp.yaml"},
+			check: func(t *testing.T, cp *cmdline.CmdParser) {
+				if !cp.GetVar("json").(bool) || cp.GetVar("cp").(string) != "cp.yaml" {
+					t.Errorf("json %v cp %q", cp.GetVar("json"), cp.GetVar("cp"))
+				}
+			},
+		},
+		{name: "required flag missing", args: []string{"-json"}, errStr: "required but missing: -cp"},
+		{name: "unrecognized flag", args: []string{"-cp", "cp.yaml", "-map", "map.yaml"}, errStr: "unrecognized flag -map"},
+		{name: "value without a flag", args: []string{"cp.yaml"}, errStr: "expected a flag at cp.yaml"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cp := cmdline.NewCmdParser()
+			cp.AddFlag(cmdline.StringFlag, "cp", true)
+			cp.AddFlag(cmdline.FloatFlag, "shift", false)
+			cp.AddFlag(cmdline.BoolFlag, "json", false)
+			err := parseArgs(cp, tc.args)
+			if len(tc.errStr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+					t.Errorf("parseArgs error = %v, want one containing %q", err, tc.errStr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.check(t, cp)
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package pces
+
+// file coverage.go holds a report, made before a run, of how well the function timings cover what
+// the mapped model can ask of them: every (op code, CPU or accelerator model, param) a mapped function
+// can look up, whether its timings were measured, derived, or are missing, and how far the packet
+// lengths the model sends lie outside the range measured.  The report also flags timing tables whose
+// measured or estimated times are negative or fall as packet length grows
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/iti/mrnes"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A TimingUse describes the timings of one op code on one model, with one param, that the mapped model can look up.
+//
+//	Funcs      - the functions that can look it up, as pattern:label@host
+//	Status     - measured, derived (see DerivedCPUModel), or missing
+//	MinPcktLen - the shortest packet length timed
+//	MaxPcktLen - the longest packet length timed
+//	Below      - the shortest packet length the model can send below the range timed, zero if none
+//	Above      - the longest packet length the model can send above the range timed, zero if none
+type TimingUse struct {
+	Op         string   `json:"op" yaml:"op"`
+	Model      string   `json:"model" yaml:"model"`
+	Param      string   `json:"param,omitempty" yaml:"param,omitempty"`
+	Accel      bool     `json:"accel,omitempty" yaml:"accel,omitempty"`
+	Funcs      []string `json:"funcs" yaml:"funcs"`
+	Status     string   `json:"status" yaml:"status"`
+	MinPcktLen int      `json:"minpcktlen" yaml:"minpcktlen"`
+	MaxPcktLen int      `json:"maxpcktlen" yaml:"maxpcktlen"`
+	Below      int      `json:"below,omitempty" yaml:"below,omitempty"`
+	Above      int      `json:"above,omitempty" yaml:"above,omitempty"`
+}
+
+// A TimingIssue describes a suspicious entry of the timing table of an op code on a model with a param
+type TimingIssue struct {
+	Op      string `json:"op" yaml:"op"`
+	Model   string `json:"model" yaml:"model"`
+	Param   string `json:"param,omitempty" yaml:"param,omitempty"`
+	Problem string `json:"problem" yaml:"problem"`
+}
+
+// A TimingCoverage reports the timings a mapped model can use and the suspicious timing tables.
+// PcktLens are the packet lengths the model can send
+type TimingCoverage struct {
+	PcktLens []int         `json:"pcktlens" yaml:"pcktlens"`
+	Uses     []TimingUse   `json:"uses" yaml:"uses"`
+	Issues   []TimingIssue `json:"issues" yaml:"issues"`
+}
+
+// CheckTimingCoverage cross-references the map, the cfgs of the mapped functions, the endpoints of the
+// topology, and the timings.  The packet lengths a model can send are taken to be those of its start
+// functions' cfgs together with any given as pcktLens; any of them may reach any function.  Members of
+// the shared cfg groups of ssgl (which may be nil) use the cfg of their group
+func CheckTimingCoverage(cpd *CompPatternDict, cpid *CPInitListDict, ssgl *SharedCfgGroupList, fel *FuncExecList,
+	cpmd *CompPatternMapDict, topo *mrnes.TopoCfg, pcktLens []int) *TimingCoverage {
+
+	tc := new(TimingCoverage)
+	tc.Uses = []TimingUse{}
+	tc.Issues = []TimingIssue{}
+
+	endpts := make(map[string]mrnes.EndptDesc)
+	for _, endpt := range topo.Endpts {
+		endpts[endpt.Name] = endpt
+	}
+
+	// the packet lengths start functions send
+	tc.PcktLens = append([]int{}, pcktLens...)
+	for _, ptnName := range sortedPtnNames(cpd) {
+		for _, fnc := range cpd.Patterns[ptnName].Funcs {
+			if fnc.Class != "start" {
+				continue
+			}
+			pcktLen := toInt(decodeCfg(funcCfgStr(cpid, ssgl, ptnName, fnc.Label))["pcktlen"])
+			if pcktLen > 0 {
+				tc.PcktLens = append(tc.PcktLens, pcktLen)
+			}
+		}
+	}
+	sort.Ints(tc.PcktLens)
+	tc.PcktLens = slices.Compact(tc.PcktLens)
+
+	// the op codes each mapped function looks up, by the model they run on
+	uses := make(map[string]*TimingUse)
+	addUse := func(funcName, op, model, param string, accel bool) {
+		key := op + "|" + model + "|" + param
+		tu, present := uses[key]
+		if !present {
+			tu = &TimingUse{Op: op, Model: model, Param: param, Accel: accel, Funcs: []string{}}
+			uses[key] = tu
+		}
+		tu.Funcs = append(tu.Funcs, funcName)
+	}
+	for _, ptnName := range sortedPtnNames(cpd) {
+		cpm, present := cpmd.Map[ptnName]
+		if !present {
+			continue
+		}
+		for _, fnc := range cpd.Patterns[ptnName].Funcs {
+			host, err := parseHostPri(cpm.FuncMap[fnc.Label])
+			if err != nil {
+				continue
+			}
+			endpt, present := endpts[host]
+			if !present {
+				continue
+			}
+			funcName := ptnName + ":" + fnc.Label + "@" + host
+			fo := cfgOpCodes(funcCfgStr(cpid, ssgl, ptnName, fnc.Label))
+			for _, op := range fo.hostOps {
+				for _, param := range fo.opParams(op) {
+					addUse(funcName, op, endpt.Model, param, false)
+				}
+			}
+			accelModel, present := endpt.Accel[fo.accel]
+			if !present {
+				continue
+			}
+			for _, op := range fo.accelOps {
+				for _, param := range fo.opParams(op) {
+					addUse(funcName, op, accelModel, param, true)
+				}
+			}
+		}
+	}
+
+	// where each use finds its timings
+	etTbl := buildFuncExecTimeTbl(fel)
+	derived := make(map[string]bool)
+	for _, dt := range DerivedTimings(fel) {
+		derived[dt.Op+"|"+dt.CPUModel] = true
+	}
+	for _, key := range sortedKeys(uses) {
+		tu := uses[key]
+		fmap, present := etTbl.lookup(tu.Op, tu.Model, tu.Param)
+		if !present || len(fmap) == 0 {
+			tu.Status = "missing"
+			tc.Uses = append(tc.Uses, *tu)
+			continue
+		}
+		tu.Status = "measured"
+		if derived[tu.Op+"|"+tu.Model] {
+			tu.Status = "derived"
+		}
+		pls := sortedPcktLens(fmap)
+		tu.MinPcktLen, tu.MaxPcktLen = pls[0], pls[len(pls)-1]
+		for _, pl := range tc.PcktLens {
+			if pl < tu.MinPcktLen && tu.Below == 0 {
+				tu.Below = pl
+			}
+			if pl > tu.MaxPcktLen {
+				tu.Above = pl
+			}
+		}
+		tc.Uses = append(tc.Uses, *tu)
+	}
+
+	tc.Issues = checkTimingTables(fel, etTbl, tc.PcktLens)
+	return tc
+}
+
+// sortedPcktLens returns the packet lengths of a table of execution times, sorted
+func sortedPcktLens(fmap map[int]float64) []int {
+	pls := make([]int, 0, len(fmap))
+	for pl := range fmap {
+		pls = append(pls, pl)
+	}
+	sort.Ints(pls)
+	return pls
+}
+
+// checkTimingTables flags the timing tables whose measured times are not positive or fall as packet length
+// grows, whose timing model cannot be fitted, or whose timing model estimates negative or falling times at
+// the packet lengths measured, those given, and points between them
+func checkTimingTables(fel *FuncExecList, etTbl execTimeTbl, pcktLens []int) []TimingIssue {
+	issues := []TimingIssue{}
+	tmTbl, _, err := fitTimingModels(fel, etTbl)
+	if err != nil {
+		issues = append(issues, TimingIssue{Problem: err.Error()})
+	}
+
+	for _, op := range sortedKeys(etTbl) {
+		for _, model := range sortedKeys(etTbl[op]) {
+			for _, param := range sortedKeys(etTbl[op][model]) {
+				flag := func(format string, args ...any) {
+					issues = append(issues, TimingIssue{Op: op, Model: model, Param: param, Problem: fmt.Sprintf(format, args...)})
+				}
+				fmap := etTbl[op][model][param]
+				pls := sortedPcktLens(fmap)
+
+				monotonic := true
+				for idx, pl := range pls {
+					if fmap[pl] <= 0.0 {
+						flag("measured time %g at packet length %d is not positive", fmap[pl], pl)
+					}
+					if idx > 0 && fmap[pl] < fmap[pls[idx-1]] {
+						flag("measured time falls from %g at packet length %d to %g at %d",
+							fmap[pls[idx-1]], pls[idx-1], fmap[pl], pl)
+						monotonic = false
+					}
+				}
+
+				ft := tmTbl[op][model][param]
+				if ft == nil {
+					continue
+				}
+				grid := append(append([]int{}, pls...), pcktLens...)
+				sort.Ints(grid)
+				grid = slices.Compact(grid)
+				for idx := len(grid) - 1; idx > 0; idx-- {
+					grid = slices.Insert(grid, idx, (grid[idx-1]+grid[idx])/2)
+				}
+				grid = slices.Compact(grid)
+
+				kind := fel.timingModelDesc(op).Kind
+				for idx, pl := range grid {
+					if pl < 1 {
+						continue
+					}
+					value := ft.model.Estimate(pl)
+					if value < 0.0 {
+						flag("%s timing model estimates negative time %g at packet length %d", kind, value, pl)
+						break
+					}
+					if monotonic && idx > 0 && grid[idx-1] > 0 && value < ft.model.Estimate(grid[idx-1]) {
+						flag("%s timing model estimate falls from %g at packet length %d to %g at %d",
+							kind, ft.model.Estimate(grid[idx-1]), grid[idx-1], value, pl)
+						break
+					}
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// Missing returns the number of timings the mapped model can look up that do not exist
+func (tc *TimingCoverage) Missing() int {
+	missing := 0
+	for _, tu := range tc.Uses {
+		if tu.Status == "missing" {
+			missing += 1
+		}
+	}
+	return missing
+}
+
+// Report returns the coverage as readable text: missing timings, then those the model extrapolates, then the
+// issues found in the timing tables, and a summary line
+func (tc *TimingCoverage) Report() string {
+	var sb strings.Builder
+	modelStr := func(tu TimingUse) string {
+		str := tu.Op + " on "
+		if tu.Accel {
+			str += "accelerator "
+		}
+		str += tu.Model
+		if len(tu.Param) > 0 {
+			str += fmt.Sprintf(" param %q", tu.Param)
+		}
+		return str
+	}
+
+	extrapolated := 0
+	for _, tu := range tc.Uses {
+		if tu.Status == "missing" {
+			fmt.Fprintf(&sb, "missing: %s, used by %s\n", modelStr(tu), strings.Join(tu.Funcs, ", "))
+		}
+	}
+	for _, tu := range tc.Uses {
+		if tu.Status == "missing" || (tu.Below == 0 && tu.Above == 0) {
+			continue
+		}
+		extrapolated += 1
+		fmt.Fprintf(&sb, "extrapolated: %s (%s) timed for packet lengths %d to %d,", modelStr(tu), tu.Status, tu.MinPcktLen, tu.MaxPcktLen)
+		if tu.Below > 0 {
+			fmt.Fprintf(&sb, " sent %d (%.2gx below)", tu.Below, float64(tu.MinPcktLen)/float64(tu.Below))
+		}
+		if tu.Above > 0 {
+			fmt.Fprintf(&sb, " sent %d (%.2gx above)", tu.Above, float64(tu.Above)/float64(max(tu.MaxPcktLen, 1)))
+		}
+		sb.WriteString("\n")
+	}
+	for _, ti := range tc.Issues {
+		if len(ti.Op) == 0 {
+			fmt.Fprintf(&sb, "suspicious: %s\n", ti.Problem)
+			continue
+		}
+		param := ""
+		if len(ti.Param) > 0 {
+			param = fmt.Sprintf(" param %q", ti.Param)
+		}
+		fmt.Fprintf(&sb, "suspicious: %s on %s%s: %s\n", ti.Op, ti.Model, param, ti.Problem)
+	}
+
+	derived := 0
+	for _, tu := range tc.Uses {
+		if tu.Status == "derived" {
+			derived += 1
+		}
+	}
+	fmt.Fprintf(&sb, "%d timings used, %d missing, %d derived, %d extrapolated; %d suspicious entries\n",
+		len(tc.Uses), tc.Missing(), derived, extrapolated, len(tc.Issues))
+	return sb.String()
+}
+
+// WriteToFile stores the TimingCoverage struct to the file whose name is given.
+// Serialization to json or to yaml is selected based on the extension of this name.
+func (tc *TimingCoverage) WriteToFile(filename string) error {
+	pathExt := path.Ext(filename)
+	var bytes []byte
+	var merr error = nil
+
+	if pathExt == ".yaml" || pathExt == ".YAML" || pathExt == ".yml" {
+		bytes, merr = yaml.Marshal(*tc)
+	} else if pathExt == ".json" || pathExt == ".JSON" {
+		bytes, merr = json.MarshalIndent(*tc, "", "\t")
+	}
+
+	if merr != nil {
+		panic(merr)
+	}
+
+	f, cerr := os.Create(filename)
+	if cerr != nil {
+		panic(cerr)
+	}
+	_, werr := f.WriteString(string(bytes[:]))
+	if werr != nil {
+		panic(werr)
+	}
+	f.Close()
+	return werr
+}
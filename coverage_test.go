@@ -0,0 +1,115 @@
+package pces
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckTimingCoverage(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(fel *FuncExecList, cpmd *CompPatternMapDict)
+		pcktLens []int
+		uses     []string
+		issues   []string
+		summary  string
+	}{
+		{
+			name:    "all measured",
+			setup:   func(fel *FuncExecList, cpmd *CompPatternMapDict) {},
+			uses:    []string{"crypt x86 measured 1000-1000 [chain1:proc@hostA]", "hash x86 measured 1000-1000 [chain1:hash@hostA]"},
+			issues:  []string{},
+			summary: "2 timings used, 0 missing, 0 derived, 0 extrapolated; 0 suspicious entries",
+		},
+		{
+			name: "missing on the model a function is mapped to",
+			setup: func(fel *FuncExecList, cpmd *CompPatternMapDict) {
+				cpmd.Map["chain1"].FuncMap["proc"] = "hostC,1"
+				cpmd.Map["chain1"].FuncMap["hash"] = "hostC,1"
+			},
+			uses:    []string{"crypt arm measured 1000-1000 [chain1:proc@hostC]", "hash arm missing 0-0 [chain1:hash@hostC]"},
+			issues:  []string{},
+			summary: "2 timings used, 1 missing, 0 derived, 0 extrapolated; 0 suspicious entries",
+		},
+		{
+			name: "derived from a reference model",
+			setup: func(fel *FuncExecList, cpmd *CompPatternMapDict) {
+				cpmd.Map["chain1"].FuncMap["hash"] = "hostC,1"
+				fel.Derived = map[string]DerivedCPUModel{"arm": {Reference: "x86", Scale: 2.0}}
+			},
+			uses:    []string{"crypt x86 measured 1000-1000 [chain1:proc@hostA]", "hash arm derived 1000-1000 [chain1:hash@hostC]"},
+			issues:  []string{},
+			summary: "2 timings used, 0 missing, 1 derived, 0 extrapolated; 0 suspicious entries",
+		},
+		{
+			name:     "packet lengths sent outside the range timed",
+			setup:    func(fel *FuncExecList, cpmd *CompPatternMapDict) { fel.AddTiming("hash", "", "x86", 4000, 2.0e-3) },
+			pcktLens: []int{100, 4000},
+			uses: []string{"crypt x86 measured 1000-1000 below 100 above 4000 [chain1:proc@hostA]",
+				"hash x86 measured 1000-4000 below 100 [chain1:hash@hostA]"},
+			issues:  []string{},
+			summary: "2 timings used, 0 missing, 0 derived, 2 extrapolated; 0 suspicious entries",
+		},
+		{
+			name: "suspicious tables",
+			setup: func(fel *FuncExecList, cpmd *CompPatternMapDict) {
+				fel.AddTiming("crypt", "", "x86", 2000, 0.5e-3)
+				fel.Times["hash"][0].ExecTime = 0.0
+			},
+			uses: []string{"crypt x86 measured 1000-2000 [chain1:proc@hostA]", "hash x86 measured 1000-1000 [chain1:hash@hostA]"},
+			issues: []string{"crypt x86: measured time falls from 0.001 at packet length 1000 to 0.0005 at 2000",
+				"hash x86: measured time 0 at packet length 1000 is not positive"},
+			summary: "2 timings used, 0 missing, 0 derived, 0 extrapolated; 2 suspicious entries",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpd, cpid, fel, cpmd := testModel(t)
+			tc.setup(fel, cpmd)
+			cov := CheckTimingCoverage(cpd, cpid, nil, fel, cpmd, testTopo(), tc.pcktLens)
+
+			uses := make([]string, len(cov.Uses))
+			for idx, tu := range cov.Uses {
+				uses[idx] = fmt.Sprintf("%s %s %s %d-%d", tu.Op, tu.Model, tu.Status, tu.MinPcktLen, tu.MaxPcktLen)
+				if tu.Below > 0 {
+					uses[idx] += fmt.Sprintf(" below %d", tu.Below)
+				}
+				if tu.Above > 0 {
+					uses[idx] += fmt.Sprintf(" above %d", tu.Above)
+				}
+				uses[idx] += fmt.Sprintf(" %v", tu.Funcs)
+			}
+			if strings.Join(uses, "\n") != strings.Join(tc.uses, "\n") {
+				t.Errorf("uses = %q, want %q", uses, tc.uses)
+			}
+
+			issues := make([]string, len(cov.Issues))
+			for idx, ti := range cov.Issues {
+				issues[idx] = fmt.Sprintf("%s %s: %s", ti.Op, ti.Model, ti.Problem)
+			}
+			if strings.Join(issues, "\n") != strings.Join(tc.issues, "\n") {
+				t.Errorf("issues = %q, want %q", issues, tc.issues)
+			}
+			if !strings.HasSuffix(cov.Report(), tc.summary+"\n") {
+				t.Errorf("report =\n%s\nwant it to end %q", cov.Report(), tc.summary)
+			}
+		})
+	}
+}
+
+func TestTimingCoverageReport(t *testing.T) {
+	cov := &TimingCoverage{PcktLens: []int{100, 1000, 4000}, Issues: []TimingIssue{},
+		Uses: []TimingUse{
+			{Op: "crypt", Model: "x86", Param: "aes", Funcs: []string{"chain1:proc@hostA"}, Status: "measured",
+				MinPcktLen: 1000, MaxPcktLen: 2000, Below: 100, Above: 4000},
+			{Op: "hash", Model: "tesla", Accel: true, Funcs: []string{"chain1:hash@hostA", "chain2:hash@hostA"}, Status: "missing"},
+		}}
+	want := "missing: hash on accelerator tesla, used by chain1:hash@hostA, chain2:hash@hostA\n" +
+		"extrapolated: crypt on x86 param \"aes\" (measured) timed for packet lengths 1000 to 2000, sent 100 (10x below) sent 4000 (2x above)\n" +
+		"2 timings used, 1 missing, 0 derived, 1 extrapolated; 0 suspicious entries\n"
+	if got := cov.Report(); got != want {
+		t.Errorf("Report =\n%s\nwant\n%s", got, want)
+	}
+}
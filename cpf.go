@@ -5,6 +5,7 @@ package pces
 import (
 	"fmt"
 	"github.com/iti/evt/evtm"
+	"github.com/iti/rngstream"
 	"strconv"
 	"strings"
 )
@@ -60,11 +61,53 @@ type CmpPtnFuncInst struct {
 
 	// MsgResp maps a thread's execID to a list of computation pattern messages
 	MsgResp map[int][]*CmpPtnMsg
+
+	// Migrating is true while the function is being moved to another host.
+	// Arrivals during that time are held in Held and re-delivered once the migration completes
+	Migrating bool
+	Held      []any
+
+	// InFlight counts arrivals that have entered but not yet exited the function.
+	// BusyTime accumulates the simulation time during which InFlight was positive
+	InFlight  int
+	BusyTime  float64
+	busySince float64
+
+	// Replica is zero for the function instance built from the model description, and
+	// otherwise the index of a replica created at run-time.  The primary instance holds
+	// the list of active replicas, each replica points back to its primary
+	Replica      int
+	Replicas     []*CmpPtnFuncInst
+	Primary      *CmpPtnFuncInst
+	replicasMade int
+
+	// autoscaler governing the replicas of a primary instance, if any
+	autoscaler *Autoscaler
+
+	// serialized cfg the instance was initialized from, used to create replicas
+	cfgStr  string
+	useYAML bool
+
+	// random number stream from which stochastic execution times are drawn, nil when they are not
+	rng *rngstream.RngStream
 }
 
 // createDestFuncInst is a constructor that builds an instance of CmpPtnFunctInst from a Func description and
 // a serialized representation of a StaticParameters struct.
 func createFuncInst(cpInstName string, cpID int, fnc *Func, cfgStr string, useYAML bool, evtMgr *evtm.EventManager) *CmpPtnFuncInst {
+	cpfi := newFuncInst(cpInstName, cpID, fnc)
+
+	// look up the func-to-host assignment, established earlier in the initialization sequence
+	cpfi.Host = CmpPtnFuncHost(cpfi)
+	cpfi.Priority = CmpPtnFuncPriority(cpfi)
+
+	cpfi.initFuncInst(evtMgr, cfgStr, useYAML)
+	return cpfi
+}
+
+// newFuncInst allocates an instance of the function in the comp pattern, with the event handlers
+// of its class, but with neither its host nor its cfg set
+func newFuncInst(cpInstName string, cpID int, fnc *Func) *CmpPtnFuncInst {
 	cpfi := new(CmpPtnFuncInst)
 	cpfi.ID = nxtID()         // get an integer id that is unique across all objects in the simulation model
 	cpfi.Label = fnc.Label    // remember a label given to this function instance as part of building a CompPattern graph
@@ -83,6 +126,8 @@ func createFuncInst(cpInstName string, cpID int, fnc *Func, cfgStr string, useYA
 	cpfi.RespMethods = make(map[string]*RespMethod) // prepare to be initialized
 
 	cpfi.Groups = make([]string, 0)
+	cpfi.Held = make([]any, 0)
+	cpfi.Replicas = make([]*CmpPtnFuncInst, 0)
 
 	// if the ClassMethods map for the cpfi's class exists,
 	// initialize respMethods to be that
@@ -99,26 +144,37 @@ func createFuncInst(cpInstName string, cpID int, fnc *Func, cfgStr string, useYA
 			cpfi.RespMethods[mc] = mcrcpy
 		}
 	}
+	return cpfi
+}
 
-	// look up the func-to-host assignment, established earlier in the initialization sequence
-	cpfi.Host = CmpPtnFuncHost(cpfi)
-	cpfi.Priority = CmpPtnFuncPriority(cpfi)
+// initFuncInst initializes the state of an instance whose host is set from the serialized cfg,
+// and registers the instance
+func (cpfi *CmpPtnFuncInst) initFuncInst(evtMgr *evtm.EventManager, cfgStr string, useYAML bool) {
+	// a member of a shared cfg group is initialized from the group's cfg
+	ssg, shared := funcInstToSharedGroup[GlobalFuncID{CmpPtnName: cpfi.PtnName, Label: cpfi.Label}]
+	if shared {
+		cpfi.SharedGroup = ssg.Name
+		cfgStr = ssg.CfgStr
+		useYAML = sharedCfgUseYAML
+	}
+	cpfi.cfgStr = cfgStr
+	cpfi.useYAML = useYAML
+	if StochasticExecTimes {
+		cpfi.rng = rngstream.New(cpfi.PtnName + ":" + cpfi.Label)
+	}
 
 	// get a pointer to the function's class
-	fc := FuncClasses[fnc.Class]
-
-	// if the function is not shared we initialize its state from the cfgStr string.
-	// otherwise we have already created the state and just recover it
-	// FINDME N.B. revisit notion/use of shared function
-	if len(cpfi.SharedGroup) == 0 {
-		fc.InitCfg(evtMgr, cpfi, cfgStr, useYAML)
-		cpi := CmpPtnInstByID[cpfi.CPID]
-		for _, grp := range cpfi.Groups {
-			cpi.AddFuncToGroup(cpfi, grp)
-		}
-	} else {
-		gfid := GlobalFuncID{CmpPtnName: cpfi.PtnName, Label: cpfi.Label}
-		cpfi.Cfg = funcInstToSharedCfg[gfid]
+	fc := FuncClasses[cpfi.Class]
+
+	// we initialize the function's state from the cfgStr string.  If the function is shared
+	// its state is its own but its cfg is the one created for the group, shared by all members
+	fc.InitCfg(evtMgr, cpfi, cfgStr, useYAML)
+	if shared {
+		cpfi.Cfg = funcInstToSharedCfg[GlobalFuncID{CmpPtnName: cpfi.PtnName, Label: cpfi.Label}]
+	}
+	cpi := CmpPtnInstByID[cpfi.CPID]
+	for _, grp := range cpfi.Groups {
+		cpi.AddFuncToGroup(cpfi, grp)
 	}
 
 	CmpPtnFuncInstByID[cpfi.ID] = cpfi
@@ -126,15 +182,52 @@ func createFuncInst(cpInstName string, cpID int, fnc *Func, cfgStr string, useYA
 	if cpfi.funcTrace() {
 		TraceMgr.AddName(cpfi.ID, cpfi.GlobalName(), "application")
 	}
-	return cpfi
 }
 
 
 // GlobalName returns a string for a CompPattern function instance that is globally unique
 func (cpfi *CmpPtnFuncInst) GlobalName() string {
+	if cpfi.Replica > 0 {
+		return cpfi.PtnName + ":" + cpfi.Label + "#" + strconv.Itoa(cpfi.Replica)
+	}
 	return cpfi.PtnName + ":" + cpfi.Label
 }
 
+// noteArrival records that work has entered the function, and resumes
+// sampling by the function's autoscaler if that had gone dormant
+func (cpfi *CmpPtnFuncInst) noteArrival(evtMgr *evtm.EventManager) {
+	now := evtMgr.CurrentSeconds()
+	primary := cpfi.primary()
+	if primary.autoscaler != nil && primary.autoscaler.dormant {
+		primary.autoscaler.wake(evtMgr)
+	}
+	wakeDVFS(evtMgr, cpfi.Host)
+	if cpfi.InFlight == 0 {
+		cpfi.busySince = now
+	}
+	cpfi.InFlight += 1
+}
+
+// noteDeparture records that work has left the function at time now
+func (cpfi *CmpPtnFuncInst) noteDeparture(now float64) {
+	if cpfi.InFlight == 0 {
+		return
+	}
+	cpfi.InFlight -= 1
+	if cpfi.InFlight == 0 {
+		cpfi.BusyTime += now - cpfi.busySince
+	}
+}
+
+// busyTimeAt returns the accumulated busy time of the function, including
+// the current busy period if there is one
+func (cpfi *CmpPtnFuncInst) busyTimeAt(now float64) float64 {
+	if cpfi.InFlight > 0 {
+		return cpfi.BusyTime + now - cpfi.busySince
+	}
+	return cpfi.BusyTime
+}
+
 // AddResponse stores the selected out message response from executing the function,
 // to be released later.  Saving through cpfi.Resp[execID] to account for concurrent overlapping executions
 func (cpfi *CmpPtnFuncInst) AddResponse(execID int, resp []*CmpPtnMsg) {
@@ -13,7 +13,6 @@ import (
 	"gopkg.in/yaml.v3"
 	"math"
 	"sort"
-	"strings"
 )
 
 // CompPattern functions, messages, and edges are described by structs in the desc package,
@@ -163,8 +162,9 @@ func createSrvFuncLinks(cpd CompPattern) {
 
 // buildAllEdgeTables goes through all the edges declared to the computational patterns
 // and extracts from these the information needed to populate function instance data
-// structures with what they need to recognize legimate messages and call the right methods
-func buildAllEdgeTables(cpd *CompPatternDict) {
+// structures with what they need to recognize legimate messages and call the right methods.
+// The cfgs of the functions are then validated, an error returned for every one that is not valid
+func buildAllEdgeTables(cpd *CompPatternDict) []error {
 	// organize edges by comp pattern, inEdge, and outEdge, and whether x-CP
 	cmpPtnEdges := make(map[string]map[string]map[string][]*ExtCmpPtnGraphEdge)
 	for cpName := range cpd.Patterns {
@@ -239,13 +239,18 @@ func buildAllEdgeTables(cpd *CompPatternDict) {
 	}
 
 	// validate the configurations (some of which depend on these edges)
-	for cpName := range cpd.Patterns {
+	errs := []error{}
+	for _, cpName := range sortedPtnNames(cpd) {
 		cpi := CmpPtnInstByName[cpName]
-		for _, cpfi := range cpi.Funcs {
-			fc := FuncClasses[cpfi.Class]
-			fc.ValidateCfg(cpfi)
+		for _, label := range sortedKeys(cpi.Funcs) {
+			cpfi := cpi.Funcs[label]
+			err := FuncClasses[cpfi.Class].ValidateCfg(cpfi)
+			if err != nil {
+				errs = append(errs, err)
+			}
 		}
 	}
+	return errs
 }
 
 // buildAllEdgeTables goes through all the edges declared to the computational patterns
@@ -479,6 +484,7 @@ type CmpPtnMsg struct {
 	RtnMsgType string
 
 	PcktLen    int     // parameter impacting execution time
+	Param      string  // selects among the timings of an operation (e.g. key length), ahead of a param given by the function's cfg
 	Rate       float64 // when non-zero, a rate limiting attribute that might used, e.g., in modeling IO
 	FlowState  string  // "srt", "end", "chg"
 	NetLatency float64
@@ -529,11 +535,9 @@ func (cpm *CmpPtnMsg) CarriesPckt() bool {
 }
 
 // CmpPtnFuncInstHost returns the name of the host to which the CmpPtnFuncInst given as argument is mapped.
+// The value is the run-time assignment, which may differ from the map file if the function has migrated
 func CmpPtnFuncInstHost(cpfi *CmpPtnFuncInst) string {
-	cpfLabel := cpfi.funcLabel()
-	cpfCmpPtn := cpfi.funcCmpPtn()
-
-	return CmpPtnMapDict.Map[cpfCmpPtn].FuncMap[cpfLabel]
+	return cpfi.funcDevice()
 }
 
 func isNOP(op string) bool {
@@ -541,28 +545,66 @@ func isNOP(op string) bool {
 }
 
 // HostFuncExecTime returns the execution time for the operation given
-// on the endpoint to which the cpfi is mapped
+// on the endpoint to which the cpfi is mapped.  The message may select among
+// the timings of the operation with its Param
 func HostFuncExecTime(cpfi *CmpPtnFuncInst, op string, msg *CmpPtnMsg) float64 {
-	hostLabel := CmpPtnFuncHost(cpfi)
+	return HostFuncParamExecTime(cpfi, op, "", msg)
+}
+
+// HostFuncParamExecTime returns the execution time for the operation given on the endpoint
+// to which the cpfi is mapped, for the timings of the operation with the given param.  A Param
+// carried by the message takes precedence.  The time is scaled by the current CPU frequency of
+// the endpoint when a DVFS policy governs it
+func HostFuncParamExecTime(cpfi *CmpPtnFuncInst, op, param string, msg *CmpPtnMsg) float64 {
+	hostLabel := cpfi.Host
 	cpumodel := netportal.EndptDevModel(hostLabel, "")
-	return funcExecTime(cpumodel, op, msg)
+	return funcExecTime(cpumodel, op, timingParam(param, msg), msg, cpfi.rng) * dvfsScale(hostLabel, op)
 }
 
 // AccelFuncExecTime returns the execution time for the operation given on
 // the accelerator model given as input
 func AccelFuncExecTime(cpfi *CmpPtnFuncInst, accelname, op string, msg *CmpPtnMsg) float64 {
-	hostLabel := CmpPtnFuncHost(cpfi)
+	return AccelFuncParamExecTime(cpfi, accelname, op, "", msg)
+}
+
+// AccelFuncParamExecTime returns the execution time for the operation given on the accelerator
+// model given as input, for the timings of the operation with the given param.  A Param
+// carried by the message takes precedence
+func AccelFuncParamExecTime(cpfi *CmpPtnFuncInst, accelname, op, param string, msg *CmpPtnMsg) float64 {
+	hostLabel := cpfi.Host
 	accelmodel := netportal.EndptDevModel(hostLabel, accelname)
-	return funcExecTime(accelmodel, op, msg)
+	return funcExecTime(accelmodel, op, timingParam(param, msg), msg, cpfi.rng)
+}
+
+// timingParam chooses the param used to select among the timings of an operation,
+// that of the message if it carries one, otherwise the one given
+func timingParam(param string, msg *CmpPtnMsg) string {
+	if msg != nil && len(msg.Param) > 0 {
+		return msg.Param
+	}
+	return param
+}
+
+// execTimeKey identifies a looked-up execution time in funcExecTimeCache
+type execTimeKey struct {
+	op      string
+	model   string
+	param   string
+	pcktLen int
 }
 
-var funcExecTimeCache map[string]map[string]map[int]float64 = make(map[string]map[string]map[int]float64)
+var funcExecTimeCache map[execTimeKey]execTimeLookup = make(map[execTimeKey]execTimeLookup)
 
 // funcExecTime returns the increase in execution time resulting from executing the
 // CmpPtnFuncInst offered as argument, to the message also offered as argument.
-// If the pcktlen of the message does not exactly match the pcktlen parameter of a func timing entry,
-// an interpolation or extrapolation of existing entries is performed.
-func funcExecTime(model string, op string, msg *CmpPtnMsg) float64 {
+// The timings of the operation on the model are those given for the param, or
+// if there are none, those given without a param.
+// The time for the pcktlen of the message is estimated by the timing model selected for the operation,
+// fitted to the entries with the same param; by default a linear interpolation or extrapolation.
+// Every lookup is recorded for ReportTimingLookups.  An estimate that is negative stops the
+// simulation if FailOnNegativeExecTime is set, and is taken as zero if ClampNegativeExecTime is.
+// When execution times are stochastic the time is drawn about that value using rng
+func funcExecTime(model string, op string, param string, msg *CmpPtnMsg, rng *rngstream.RngStream) float64 {
 	// get the parameters needed for the func execution time lookup
 	if isNOP(op) {
 		return 0.0
@@ -574,6 +616,13 @@ func funcExecTime(model string, op string, msg *CmpPtnMsg) float64 {
 		pcktLen = msg.PcktLen
 	}
 
+	key := execTimeKey{op: op, model: model, param: param, pcktLen: pcktLen}
+	etl, here := funcExecTimeCache[key]
+	if here {
+		recordTimingLookup(op, model, param, pcktLen, etl)
+		return sampleExecTime(model, op, param, pcktLen, clampExecTime(etl.value), rng)
+	}
+
 	_, present := funcExecTimeTbl[op]
 	if !present {
 		panic(fmt.Errorf("expected function execution timing for operation %s", op))
@@ -584,47 +633,71 @@ func funcExecTime(model string, op string, msg *CmpPtnMsg) float64 {
 		panic(fmt.Errorf("expected function execution timing for operation %s on model %s", op, model))
 	}
 
-	value, here := funcExecTimeCache[op][model][pcktLen]
-	if here {
+	ft, present := funcTimingModelTbl.lookup(op, model, param)
+	if !present {
+		panic(fmt.Errorf("expected function execution timing for operation %s on model %s with param %s", op, model, param))
+	}
+
+	etl = ft.lookup(pcktLen)
+	if etl.value < 0.0 && FailOnNegativeExecTime {
+		panic(fmt.Errorf("execution time of operation %s on model %s with param %q for packet length %d is estimated to be negative, %g",
+			op, model, param, pcktLen, etl.value))
+	}
+	funcExecTimeCache[key] = etl
+	recordTimingLookup(op, model, param, pcktLen, etl)
+	return sampleExecTime(model, op, param, pcktLen, clampExecTime(etl.value), rng)
+}
+
+// clampExecTime returns an estimated execution time, taken as zero if it is negative and ClampNegativeExecTime is set
+func clampExecTime(value float64) float64 {
+	if value < 0.0 && ClampNegativeExecTime {
+		return 0.0
+	}
+	return value
+}
+
+// sampleExecTime returns the mean execution time given, or when execution times are stochastic, a time drawn about it
+func sampleExecTime(model, op, param string, pcktLen int, mean float64, rng *rngstream.RngStream) float64 {
+	if !StochasticExecTimes {
+		return mean
+	}
+	return drawExecTime(model, op, param, pcktLen, mean, rng)
+}
+
+// interpolateExecTime estimates an execution time for the given packet length from a map
+// of measured execution times indexed by packet length
+func interpolateExecTime(fmap map[int]float64, pcktLen int) float64 {
+	value, present := fmap[pcktLen]
+	if present {
 		return value
 	}
 
-	// the packetlen is not in the map and not in the cache
-	//   if msg is nil find the smallest entry in the table
+	// the packetlen is not in the map.
+	//   if pcktLen is zero find the smallest entry in the table
 	// and call that the value for pcktlen 0.
 
 	pls := []int{}
-	for pl := range funcExecTimeTbl[op][model] {
+	for pl := range fmap {
 		pls = append(pls, pl)
 	}
 	sort.Ints(pls)
 
-	_, present = funcExecTimeCache[op]
-	if !present {
-		funcExecTimeCache[op] = make(map[string]map[int]float64)
-	}
-	_, present = funcExecTimeCache[op][model]
-	if !present {
-		funcExecTimeCache[op][model] = make(map[int]float64)
-	}
-
 	if pcktLen == 0 {
-		value := funcExecTimeTbl[op][model][pls[0]]
-		funcExecTimeCache[op][model][0] = value
-		return value
+		return fmap[pls[0]]
 	}
 
-	fmap := funcExecTimeTbl[op][model]
-	//   not in the cache, not in the table.  Estimate based on
+	//   not in the table.  Estimate based on
 	//     pcktLen relative to sorted list of known packet lengths
-	//   case len(pls) = 1 --- estimate based on straight line from origin to pls[0]
+	//   case len(pls) = 1 --- estimate based on straight line from origin to pls[0],
+	//     or if pls[0] is zero, the time there regardless of packet length
 	//   case: pcktLen < pls[0] and len(pls) > 1 --- use slope between pls[0] and pls[1]
 	//   case: pls[0] <= pcktLen < pls[len(pls)-1] --- do a linear interpolation
 	//   case: pls[len(pls)-1] < pcktLen and len(pls) > 1 --- use slope between last two points
 	if len(pls) == 1 {
-		value := float64(pcktLen) * fmap[pls[0]] / float64(pls[0])
-		funcExecTimeCache[op][model][pcktLen] = value
-		return value
+		if pls[0] == 0 {
+			return fmap[0]
+		}
+		return float64(pcktLen) * fmap[pls[0]] / float64(pls[0])
 	}
 
 	// there are at least two measurements, find the closest way to estimate
@@ -646,30 +719,7 @@ func funcExecTime(model string, op string, msg *CmpPtnMsg) float64 {
 	delx := float64(pls[rightIdx] - pls[leftIdx])
 	slope := dely / delx
 	intercept := fmap[pls[rightIdx]] - slope*float64(pls[rightIdx])
-	value = intercept + slope*float64(pcktLen)
-	funcExecTimeCache[op][model][pcktLen] = value
-	return value
-	/*
-		// do a linear regression on the others
-		sumX := float64(0.0)
-		sumX2 := float64(0.0)
-		sumY := float64(0.0)
-		sumY2 := float64(0.0)
-		sumXY := float64(0.0)
-
-		for _, point := range points {
-			sumX += point.x
-			sumX2 += point.x * point.x
-			sumY += point.y
-			sumY2 += point.y * point.y
-			sumXY += point.x * point.y
-		}
-		N := float64(len(points))
-		m := (N*sumXY - sumX*sumY) / (N*sumX2 - sumX*sumX)
-		b := (sumY - m*sumX) / N
-
-		return float64(msg.PcktLen)*m + b
-	*/
+	return intercept + slope*float64(pcktLen)
 }
 
 // EnterFunc is an event-handling routine, scheduled by an evtm.EventManager to execute and simulate the results of
@@ -679,6 +729,13 @@ func EnterFunc(evtMgr *evtm.EventManager, cpFunc any, cpMsg any) any {
 	// extract the CmpPtnFuncInst and CmpPtnMsg involved in this event
 	cpfi := cpFunc.(*CmpPtnFuncInst)
 
+	// a function being migrated accepts no work until it is running on its new host
+	if cpfi.Migrating {
+		cpfi.Held = append(cpfi.Held, cpMsg)
+		return nil
+	}
+	cpfi.noteArrival(evtMgr)
+
 	// the choice of cpfi was made in ExitFunc by looking up
 	// the function in the CmpPtnInst list of functions (selected by
 	// the CPID on the outbound message), indexed by
@@ -772,6 +829,7 @@ func ExitFunc(evtMgr *evtm.EventManager, cpFunc any, cpMsg any) any {
 
 	// get the response(s), if any.  Note that result is a slice of CmpPtnMsgs.
 	msgs := cpfi.funcResp(cpm.ExecID)
+	cpfi.noteDeparture(evtMgr.CurrentSeconds())
 
 	// note exit from function
 	AddCPTrace(TraceMgr, cpfi.Trace, evtMgr.CurrentTime(), cpm.ExecID, cpfi.ID, FullFuncName(cpfi, "ExitFunc"), cpm)
@@ -805,11 +863,11 @@ func ExitFunc(evtMgr *evtm.EventManager, cpFunc any, cpMsg any) any {
 		// determine whether destination is on processor or off processor
 		nxtf, present := xcpi.Funcs[msg.Label]
 		if present {
-			dstHost := CmpPtnMapDict.Map[xcpi.Name].FuncMap[nxtf.Label]
-			if strings.Contains(dstHost, ",") {
-				pieces := strings.Split(dstHost, ",")
-				dstHost = pieces[0]
-			}
+			// if the function is replicated choose the instance that receives the message
+			nxtf = nxtf.selectReplica(cpfi.Host)
+
+			// use the run-time host assignment, which reflects any migration
+			dstHost := nxtf.Host
 
 			// Staying on the host means scheduling w/o delay the arrival at the next func
 			// through EnterFunc
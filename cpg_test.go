@@ -0,0 +1,31 @@
+package pces
+
+import (
+	"testing"
+)
+
+func TestInterpolateExecTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		fmap    map[int]float64
+		pcktLen int
+		want    float64
+	}{
+		{"measured", map[int]float64{100: 1.0, 200: 2.0}, 200, 2.0},
+		{"zero takes the shortest", map[int]float64{100: 1.0, 200: 3.0}, 0, 1.0},
+		{"between", map[int]float64{100: 1.0, 200: 3.0}, 150, 2.0},
+		{"below, along the first segment", map[int]float64{100: 1.0, 200: 3.0, 400: 4.0}, 50, 0.0},
+		{"above, along the last segment", map[int]float64{100: 1.0, 200: 3.0, 400: 4.0}, 600, 5.0},
+		{"one timing, through the origin", map[int]float64{1000: 2.0}, 500, 1.0},
+		{"one timing at zero, constant", map[int]float64{0: 3.0}, 500, 3.0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := interpolateExecTime(tc.fmap, tc.pcktLen)
+			if !closeTo(got, tc.want) {
+				t.Errorf("interpolateExecTime(%v, %d) = %g, want %g", tc.fmap, tc.pcktLen, got, tc.want)
+			}
+		})
+	}
+}
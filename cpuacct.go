@@ -0,0 +1,213 @@
+package pces
+
+// file cpuacct.go holds the accounting, while the simulation runs, of the service that function
+// instances get from the task schedulers of their hosts' CPUs and accelerators: the executions
+// they start, the tasks they schedule, the time those tasks are served, and the time they wait
+// for a free core.  After the run the accounts are gathered by host and device into utilization
+// breakdowns, reported or written to a csv or json file
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/iti/evt/evtm"
+	"github.com/iti/mrnes"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hostCPU names the device of a host on which functions run when they use no accelerator
+const hostCPU = "cpu"
+
+// A CPUAccount accumulates the service a function instance got from the task scheduler of one device
+// of one host.  An execution that runs on several cores schedules several tasks
+type CPUAccount struct {
+	Func        string  // global name of the function instance
+	Host        string  // host of the device
+	Device      string  // "cpu", or the name of an accelerator
+	Executions  int     // executions started
+	Tasks       int     // tasks scheduled and completed
+	ServiceTime float64 // sum of the service times of the tasks
+	WaitTime    float64 // sum of the times tasks waited for a free core
+}
+
+// CPUAccounts holds an account for every function instance and device it has scheduled tasks on,
+// in the order of their first execution
+var CPUAccounts []*CPUAccount = make([]*CPUAccount, 0)
+
+var cpuAccountIdx map[[3]string]int = make(map[[3]string]int)
+
+// cpuAccount returns the account of the function instance on the named device of its current host,
+// creating it on the first execution there
+func cpuAccount(cpfi *CmpPtnFuncInst, device string) *CPUAccount {
+	key := [3]string{cpfi.GlobalName(), cpfi.Host, device}
+	idx, present := cpuAccountIdx[key]
+	if !present {
+		idx = len(CPUAccounts)
+		cpuAccountIdx[key] = idx
+		CPUAccounts = append(CPUAccounts, &CPUAccount{Func: key[0], Host: key[1], Device: key[2]})
+	}
+	return CPUAccounts[idx]
+}
+
+// schedule gives a task of the function to the scheduler, as mrnes.TaskScheduler.Schedule does, and
+// charges it to the account when it completes.  Tasks are never preempted, so the time from scheduling
+// to completion beyond the task's service time was spent waiting for a core
+func (acct *CPUAccount) schedule(evtMgr *evtm.EventManager, scheduler *mrnes.TaskScheduler, op string, req float64, pri int,
+	context any, msg *CmpPtnMsg, execID, endPtID int, complete evtm.EventHandlerFunction) bool {
+
+	scheduled := evtMgr.CurrentSeconds()
+	charged := func(evtMgr *evtm.EventManager, context any, data any) any {
+		acct.Tasks += 1
+		acct.ServiceTime += req
+		acct.WaitTime += max(evtMgr.CurrentSeconds()-scheduled-req, 0.0)
+		return complete(evtMgr, context, data)
+	}
+	return scheduler.Schedule(evtMgr, op, req, pri, math.MaxFloat64, context, msg, execID, endPtID, charged)
+}
+
+// A FuncUtilization is the share of one function instance in the service given by a device
+type FuncUtilization struct {
+	Func        string  `json:"func"`
+	Executions  int     `json:"executions"`
+	Tasks       int     `json:"tasks"`
+	ServiceTime float64 `json:"servicetime"`
+	WaitTime    float64 `json:"waittime"`
+	MeanWait    float64 `json:"meanwait"`    // mean wait of a task for a free core
+	Share       float64 `json:"share"`       // fraction of the service the device gave
+	Utilization float64 `json:"utilization"` // fraction of the capacity of the device used, zero if its cores are unknown
+}
+
+// A DeviceUtilization gathers the accounts of the function instances served by one device of a host,
+// in decreasing order of service time.  Load is the average number of its cores busy over the run.
+// The cores of accelerators are not known, so their Cores and Utilization are zero
+type DeviceUtilization struct {
+	Host        string            `json:"host"`
+	Device      string            `json:"device"`
+	Cores       int               `json:"cores"`
+	ServiceTime float64           `json:"servicetime"`
+	WaitTime    float64           `json:"waittime"`
+	Load        float64           `json:"load"`
+	Utilization float64           `json:"utilization"`
+	Funcs       []FuncUtilization `json:"funcs"`
+}
+
+// CPUUtilization gathers the accounts by host and device into utilization breakdowns over a run
+// lasting the given time, ordered by host and then device
+func CPUUtilization(elapsed float64) []*DeviceUtilization {
+	devices := make(map[[2]string]*DeviceUtilization)
+	for _, acct := range CPUAccounts {
+		key := [2]string{acct.Host, acct.Device}
+		du, present := devices[key]
+		if !present {
+			du = &DeviceUtilization{Host: acct.Host, Device: acct.Device, Funcs: []FuncUtilization{}}
+			if acct.Device == hostCPU {
+				du.Cores = mrnes.EndptDevByName[acct.Host].EndptCores
+			}
+			devices[key] = du
+		}
+		du.ServiceTime += acct.ServiceTime
+		du.WaitTime += acct.WaitTime
+		fu := FuncUtilization{Func: acct.Func, Executions: acct.Executions, Tasks: acct.Tasks,
+			ServiceTime: acct.ServiceTime, WaitTime: acct.WaitTime}
+		if acct.Tasks > 0 {
+			fu.MeanWait = acct.WaitTime / float64(acct.Tasks)
+		}
+		du.Funcs = append(du.Funcs, fu)
+	}
+
+	rtn := make([]*DeviceUtilization, 0, len(devices))
+	for _, du := range devices {
+		if elapsed > 0.0 {
+			du.Load = du.ServiceTime / elapsed
+			if du.Cores > 0 {
+				du.Utilization = du.Load / float64(du.Cores)
+			}
+		}
+		for idx := range du.Funcs {
+			fu := &du.Funcs[idx]
+			if du.ServiceTime > 0.0 {
+				fu.Share = fu.ServiceTime / du.ServiceTime
+			}
+			fu.Utilization = fu.Share * du.Utilization
+		}
+		sort.SliceStable(du.Funcs, func(i, j int) bool { return du.Funcs[i].ServiceTime > du.Funcs[j].ServiceTime })
+		rtn = append(rtn, du)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		if rtn[i].Host != rtn[j].Host {
+			return rtn[i].Host < rtn[j].Host
+		}
+		return rtn[i].Device < rtn[j].Device
+	})
+	return rtn
+}
+
+// ReportCPUAccounts prints, for every device that served functions over a run lasting the given time,
+// its load and utilization and the function instance that used it most
+func ReportCPUAccounts(elapsed float64) {
+	for _, du := range CPUUtilization(elapsed) {
+		if len(du.Funcs) == 0 || !(du.ServiceTime > 0.0) {
+			continue
+		}
+		top := du.Funcs[0]
+		utilStr := ""
+		if du.Cores > 0 {
+			utilStr = fmt.Sprintf(", utilization %f of %d cores", du.Utilization, du.Cores)
+		}
+		fmt.Printf("Device %s of %s: load %f%s, most used by %s (%f of service, mean wait %f)\n",
+			du.Device, du.Host, du.Load, utilStr, top.Func, top.Share, top.MeanWait)
+	}
+}
+
+// checkCPUAcctFile returns an error if the named file is not one the accounts can be written to
+func checkCPUAcctFile(filename string) error {
+	pathExt := strings.ToLower(path.Ext(filename))
+	if pathExt != ".csv" && pathExt != ".json" {
+		return fmt.Errorf("cpu accounting file %s is neither .csv nor .json", filename)
+	}
+	return nil
+}
+
+// SaveCPUAccounts writes the utilization breakdowns of a run lasting the given time to the named file.
+// The file's extension selects json, or csv with one row per function instance and device
+func SaveCPUAccounts(filename string, elapsed float64) error {
+	err := checkCPUAcctFile(filename)
+	if err != nil {
+		return err
+	}
+	breakdown := CPUUtilization(elapsed)
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.ToLower(path.Ext(filename)) == ".json" {
+		bytes, err := json.MarshalIndent(breakdown, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(bytes)
+		return err
+	}
+
+	fstr := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	f.WriteString("host,device,cores,func,executions,tasks,servicetime,waittime,meanwait,share,utilization\n")
+	for _, du := range breakdown {
+		for _, fu := range du.Funcs {
+			row := []string{du.Host, du.Device, strconv.Itoa(du.Cores), fu.Func, strconv.Itoa(fu.Executions),
+				strconv.Itoa(fu.Tasks), fstr(fu.ServiceTime), fstr(fu.WaitTime), fstr(fu.MeanWait),
+				fstr(fu.Share), fstr(fu.Utilization)}
+			_, err = f.WriteString(strings.Join(row, ",") + "\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package pces
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setCPUAccounts loads the test topology and replaces the accounts with those of two functions
+// on the CPU of its hostA, of two cores, and one on its accelerator, restoring them when the test ends
+func setCPUAccounts(t *testing.T) {
+	t.Helper()
+	loadTestTopo(t)
+
+	saved := CPUAccounts
+	t.Cleanup(func() { CPUAccounts = saved })
+	CPUAccounts = []*CPUAccount{
+		{Func: "chain1:proc", Host: "hostA", Device: hostCPU, Executions: 4, Tasks: 4, ServiceTime: 1.0, WaitTime: 0.2},
+		{Func: "chain1:hash", Host: "hostA", Device: hostCPU, Executions: 2, Tasks: 2, ServiceTime: 3.0, WaitTime: 0.0},
+		{Func: "chain1:proc", Host: "hostA", Device: "gpu", Executions: 1, Tasks: 1, ServiceTime: 0.5, WaitTime: 0.0},
+	}
+}
+
+func TestCPUUtilization(t *testing.T) {
+	setCPUAccounts(t)
+	breakdown := CPUUtilization(4.0)
+	if len(breakdown) != 2 {
+		t.Fatalf("got %d devices, want 2", len(breakdown))
+	}
+
+	cpu, gpu := breakdown[0], breakdown[1]
+	if cpu.Device != hostCPU || gpu.Device != "gpu" {
+		t.Fatalf("devices in order %s, %s, want cpu, gpu", cpu.Device, gpu.Device)
+	}
+	if cpu.Cores != 2 || !closeTo(cpu.Load, 1.0) || !closeTo(cpu.Utilization, 0.5) {
+		t.Errorf("cpu has cores %d load %g utilization %g, want 2 1 0.5", cpu.Cores, cpu.Load, cpu.Utilization)
+	}
+	if cpu.Funcs[0].Func != "chain1:hash" || !closeTo(cpu.Funcs[0].Share, 0.75) || !closeTo(cpu.Funcs[0].Utilization, 0.375) {
+		t.Errorf("cpu most used by %+v, want chain1:hash with share 0.75", cpu.Funcs[0])
+	}
+	if !closeTo(cpu.Funcs[1].MeanWait, 0.05) {
+		t.Errorf("chain1:proc has mean wait %g, want 0.05", cpu.Funcs[1].MeanWait)
+	}
+	if gpu.Cores != 0 || gpu.Utilization != 0.0 || !closeTo(gpu.Load, 0.125) {
+		t.Errorf("gpu has cores %d load %g utilization %g, want 0 0.125 0", gpu.Cores, gpu.Load, gpu.Utilization)
+	}
+}
+
+func TestSaveCPUAccounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		errStr string
+		check  func(t *testing.T, data []byte)
+	}{
+		{
+			name: "csv",
+			file: "acct.csv",
+			check: func(t *testing.T, data []byte) {
+				want := []string{
+					"host,device,cores,func,executions,tasks,servicetime,waittime,meanwait,share,utilization",
+					"hostA,cpu,2,chain1:hash,2,2,3,0,0,0.75,0.375",
+					"hostA,cpu,2,chain1:proc,4,4,1,0.2,0.05,0.25,0.125",
+					"hostA,gpu,0,chain1:proc,1,1,0.5,0,0,1,0",
+				}
+				lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+				if len(lines) != len(want) {
+					t.Fatalf("csv has %d lines, want %d:\n%s", len(lines), len(want), data)
+				}
+				for idx := range want {
+					if lines[idx] != want[idx] {
+						t.Errorf("csv line %d is %q, want %q", idx, lines[idx], want[idx])
+					}
+				}
+			},
+		},
+		{
+			name: "json",
+			file: "acct.JSON",
+			check: func(t *testing.T, data []byte) {
+				var breakdown []DeviceUtilization
+				err := json.Unmarshal(data, &breakdown)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(breakdown) != 2 || len(breakdown[0].Funcs) != 2 || len(breakdown[1].Funcs) != 1 {
+					t.Fatalf("json holds %+v", breakdown)
+				}
+				if breakdown[0].Host != "hostA" || breakdown[0].Cores != 2 || !closeTo(breakdown[0].Utilization, 0.5) {
+					t.Errorf("json cpu is %+v", breakdown[0])
+				}
+				if fu := breakdown[0].Funcs[1]; fu.Func != "chain1:proc" || fu.Tasks != 4 || !closeTo(fu.MeanWait, 0.05) {
+					t.Errorf("json cpu second func is %+v", fu)
+				}
+			},
+		},
+		{name: "other extension", file: "acct.txt", errStr: "neither .csv nor .json"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setCPUAccounts(t)
+			filename := filepath.Join(t.TempDir(), tc.file)
+			err := SaveCPUAccounts(filename, 4.0)
+			if len(tc.errStr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+					t.Errorf("SaveCPUAccounts error = %v, want one containing %q", err, tc.errStr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.check(t, data)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package pces
+
+// file derived.go holds the derivation of function timings for CPU models declared as scaled
+// versions of a reference model, so that a new CPU model need not have a full timing table.
+// Timings are derived operation by operation: an operation with any timing of its own on a
+// derived model uses only those measured timings there
+
+import (
+	"fmt"
+	"math"
+)
+
+// A DerivedTiming records that the timings of an operation on a CPU model were derived
+// from those on its reference model, rather than measured
+type DerivedTiming struct {
+	Op        string
+	CPUModel  string
+	Reference string
+	Scale     float64
+}
+
+// validate returns an error describing the first problem found with the description of a derived model
+func (dcm *DerivedCPUModel) validate(cpumodel string) error {
+	if len(dcm.Reference) == 0 {
+		return fmt.Errorf("derived CPU model %s names no reference", cpumodel)
+	}
+	if dcm.Reference == cpumodel {
+		return fmt.Errorf("derived CPU model %s is its own reference", cpumodel)
+	}
+	if dcm.Scale < 0.0 {
+		return fmt.Errorf("derived CPU model %s has negative scale", cpumodel)
+	}
+	for _, op := range sortedKeys(dcm.OpScale) {
+		if dcm.OpScale[op] <= 0.0 {
+			return fmt.Errorf("derived CPU model %s has non-positive scale for %s", cpumodel, op)
+		}
+	}
+	for _, bench := range sortedKeys(dcm.Benchmarks) {
+		if dcm.Benchmarks[bench] <= 0.0 {
+			return fmt.Errorf("derived CPU model %s has non-positive ratio for benchmark %s", cpumodel, bench)
+		}
+	}
+	if dcm.Scale == 0.0 && len(dcm.Benchmarks) == 0 && len(dcm.OpScale) == 0 {
+		return fmt.Errorf("derived CPU model %s has no scale, operation scales, or benchmarks", cpumodel)
+	}
+	return nil
+}
+
+// scaleFor returns the factor by which reference timings of an operation are scaled, and
+// false if the derived model gives none for it
+func (dcm *DerivedCPUModel) scaleFor(op string) (float64, bool) {
+	scale, present := dcm.OpScale[op]
+	if present {
+		return scale, true
+	}
+	if dcm.Scale > 0.0 {
+		return dcm.Scale, true
+	}
+	if len(dcm.Benchmarks) == 0 {
+		return 0.0, false
+	}
+
+	// geometric mean of the benchmark ratios
+	sumLog := 0.0
+	for _, ratio := range dcm.Benchmarks {
+		sumLog += math.Log(ratio)
+	}
+	return math.Exp(sumLog / float64(len(dcm.Benchmarks))), true
+}
+
+// measuredModels returns, by operation, the CPU models that have timings of their own for it
+func (fel *FuncExecList) measuredModels() map[string]map[string]bool {
+	measured := make(map[string]map[string]bool)
+	for op, fedList := range fel.Times {
+		measured[op] = make(map[string]bool)
+		for _, fed := range fedList {
+			measured[op][fed.CPUModel] = true
+		}
+	}
+	return measured
+}
+
+// derivedOrder returns the well-formed derived models in an order in which each follows
+// the derived model it references, leaving out those whose chain of references is circular
+func (fel *FuncExecList) derivedOrder() []string {
+	order := []string{}
+	placed := make(map[string]bool)
+	for {
+		added := false
+		for _, model := range sortedKeys(fel.Derived) {
+			dcm := fel.Derived[model]
+			if placed[model] || dcm.validate(model) != nil {
+				continue
+			}
+			_, refDerived := fel.Derived[dcm.Reference]
+			if refDerived && !placed[dcm.Reference] {
+				continue
+			}
+			order = append(order, model)
+			placed[model] = true
+			added = true
+		}
+		if !added {
+			return order
+		}
+	}
+}
+
+// CheckDerived returns an error for every derived CPU model that is malformed, whose reference
+// is neither a CPU model with timings nor another derived model, or whose references are circular
+func (fel *FuncExecList) CheckDerived() error {
+	errs := []error{}
+	withTimings := make(map[string]bool)
+	for _, models := range fel.measuredModels() {
+		for model := range models {
+			withTimings[model] = true
+		}
+	}
+	ordered := make(map[string]bool)
+	for _, model := range fel.derivedOrder() {
+		ordered[model] = true
+	}
+
+	for _, model := range sortedKeys(fel.Derived) {
+		dcm := fel.Derived[model]
+		err := dcm.validate(model)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		_, refDerived := fel.Derived[dcm.Reference]
+		if !refDerived && !withTimings[dcm.Reference] {
+			errs = append(errs, fmt.Errorf("derived CPU model %s has reference %s, which has no timings", model, dcm.Reference))
+			continue
+		}
+		if !ordered[model] {
+			errs = append(errs, fmt.Errorf("derived CPU model %s is derived, through its references, from itself", model))
+		}
+	}
+	return ReportErrs(errs)
+}
+
+// deriveModels adds to a table indexed by operation and then CPU model the entries of the derived
+// models, each the entry of its reference model scaled by the function given.  An entry is derived
+// only for an operation with no timings of its own on the derived model.  The entries derived are returned
+func deriveModels[V any](tbl map[string]map[string]V, fel *FuncExecList, scaled func(V, float64) V) []DerivedTiming {
+	derived := []DerivedTiming{}
+	measured := fel.measuredModels()
+	for _, model := range fel.derivedOrder() {
+		dcm := fel.Derived[model]
+		for _, op := range sortedKeys(tbl) {
+			if measured[op][model] {
+				continue
+			}
+			ref, present := tbl[op][dcm.Reference]
+			if !present {
+				continue
+			}
+			scale, present := dcm.scaleFor(op)
+			if !present {
+				continue
+			}
+			tbl[op][model] = scaled(ref, scale)
+			derived = append(derived, DerivedTiming{Op: op, CPUModel: model, Reference: dcm.Reference, Scale: scale})
+		}
+	}
+	return derived
+}
+
+// scaleExecTimes returns a copy of execution times by param and packet length, multiplied by scale
+func scaleExecTimes(params map[string]map[int]float64, scale float64) map[string]map[int]float64 {
+	rtn := make(map[string]map[int]float64)
+	for param, fmap := range params {
+		rtn[param] = make(map[int]float64)
+		for pl, execTime := range fmap {
+			rtn[param][pl] = scale * execTime
+		}
+	}
+	return rtn
+}
+
+// DerivedTimings returns the operations whose timings on a CPU model are derived from another, rather than measured
+func DerivedTimings(fel *FuncExecList) []DerivedTiming {
+	return deriveModels(fel.measuredModels(), fel, func(present bool, scale float64) bool { return present })
+}
+
+// reportDerivedTimings prints the timings that are derived rather than measured
+func reportDerivedTimings(derived []DerivedTiming) {
+	for _, dt := range derived {
+		fmt.Printf("note: timings of %s on CPU model %s are derived from %s, scaled by %g\n",
+			dt.Op, dt.CPUModel, dt.Reference, dt.Scale)
+	}
+}
@@ -0,0 +1,169 @@
+package pces
+
+// file desc-autoscale.go holds structs and methods used to describe the policies
+// that govern run-time scaling of the number of replicas of comp pattern functions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+)
+
+// An AutoscalePolicy describes how the replicas of one function are scaled.
+// Every Interval seconds the Metric is sampled over the replicas of the function.
+//
+//	Metric      - "queue" for the average number of arrivals in flight per replica,
+//	              "util" for the average fraction of the interval a replica had work in flight
+//	ScaleUp     - add Step replicas when the metric is at or above this value
+//	ScaleDown   - remove Step replicas when the metric is at or below this value
+//	Cooldown    - minimum time (seconds) between successive scale events
+//	Hosts       - pool of hosts on which replicas may be placed
+type AutoscalePolicy struct {
+	PtnName     string   `json:"ptnname" yaml:"ptnname"`
+	Label       string   `json:"label" yaml:"label"`
+	Metric      string   `json:"metric" yaml:"metric"`
+	Interval    float64  `json:"interval" yaml:"interval"`
+	ScaleUp     float64  `json:"scaleup" yaml:"scaleup"`
+	ScaleDown   float64  `json:"scaledown" yaml:"scaledown"`
+	Step        int      `json:"step" yaml:"step"`
+	MinReplicas int      `json:"minreplicas" yaml:"minreplicas"`
+	MaxReplicas int      `json:"maxreplicas" yaml:"maxreplicas"`
+	Cooldown    float64  `json:"cooldown" yaml:"cooldown"`
+	Hosts       []string `json:"hosts" yaml:"hosts"`
+}
+
+// CreateAutoscalePolicy is a constructor.  It gives the policy defaults
+// of one-at-a-time scaling between one and as many replicas as there are hosts in the pool
+func CreateAutoscalePolicy(ptnName, label, metric string, interval, scaleUp, scaleDown float64,
+	hosts []string) *AutoscalePolicy {
+	asp := new(AutoscalePolicy)
+	asp.PtnName = ptnName
+	asp.Label = label
+	asp.Metric = metric
+	asp.Interval = interval
+	asp.ScaleUp = scaleUp
+	asp.ScaleDown = scaleDown
+	asp.Step = 1
+	asp.MinReplicas = 1
+	asp.MaxReplicas = len(hosts) + 1
+	asp.Hosts = make([]string, len(hosts))
+	copy(asp.Hosts, hosts)
+	return asp
+}
+
+// Validate checks the internal consistency of the policy
+func (asp *AutoscalePolicy) Validate() error {
+	errs := []error{}
+	name := asp.PtnName + ":" + asp.Label
+	if asp.Metric != "queue" && asp.Metric != "util" {
+		errs = append(errs, fmt.Errorf("autoscale policy for %s has metric %s, not in {queue, util}", name, asp.Metric))
+	}
+	if !(asp.Interval > 0.0) {
+		errs = append(errs, fmt.Errorf("autoscale policy for %s needs positive interval", name))
+	}
+	if asp.ScaleDown >= asp.ScaleUp {
+		errs = append(errs, fmt.Errorf("autoscale policy for %s needs scaledown below scaleup", name))
+	}
+	if asp.Step < 1 {
+		errs = append(errs, fmt.Errorf("autoscale policy for %s needs step of at least 1", name))
+	}
+	if asp.MinReplicas < 1 || asp.MaxReplicas < asp.MinReplicas {
+		errs = append(errs, fmt.Errorf("autoscale policy for %s needs 1 <= minreplicas <= maxreplicas", name))
+	}
+	if len(asp.Hosts) == 0 && asp.MaxReplicas > 1 {
+		errs = append(errs, fmt.Errorf("autoscale policy for %s has no candidate hosts", name))
+	}
+	return ReportErrs(errs)
+}
+
+// AutoscalePolicyList holds all the autoscaling policies of an experiment
+type AutoscalePolicyList struct {
+	ListName string            `json:"listname" yaml:"listname"`
+	Policies []AutoscalePolicy `json:"policies" yaml:"policies"`
+}
+
+// CreateAutoscalePolicyList is a constructor
+func CreateAutoscalePolicyList(name string) *AutoscalePolicyList {
+	aspl := new(AutoscalePolicyList)
+	aspl.ListName = name
+	aspl.Policies = make([]AutoscalePolicy, 0)
+	return aspl
+}
+
+// AddPolicy includes a policy in the list, returning an error if the list
+// already holds a policy for the same function
+func (aspl *AutoscalePolicyList) AddPolicy(asp *AutoscalePolicy) error {
+	for _, xasp := range aspl.Policies {
+		if xasp.PtnName == asp.PtnName && xasp.Label == asp.Label {
+			return fmt.Errorf("duplicated autoscale policy for %s:%s", asp.PtnName, asp.Label)
+		}
+	}
+	aspl.Policies = append(aspl.Policies, *asp)
+	return nil
+}
+
+// ReadAutoscalePolicyList deserializes a slice of bytes into an AutoscalePolicyList.  Bytes are either provided, or are
+// read from a file whose name is given.
+func ReadAutoscalePolicyList(filename string, useYAML bool, dict []byte) (*AutoscalePolicyList, error) {
+	var err error
+
+	// empty slice of bytes means we get those bytes from the named file
+	if len(dict) == 0 {
+		// validate input file name
+		fileInfo, err := os.Stat(filename)
+		if os.IsNotExist(err) || fileInfo.IsDir() {
+			msg := fmt.Sprintf("autoscale policy list %s does not exist or cannot be read", filename)
+			fmt.Println(msg)
+			return nil, errors.New(msg)
+		}
+		dict, err = os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	example := AutoscalePolicyList{}
+
+	if useYAML {
+		err = yaml.Unmarshal(dict, &example)
+	} else {
+		err = json.Unmarshal(dict, &example)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &example, nil
+}
+
+// WriteToFile serializes the AutoscalePolicyList and writes it to a file.  Output file
+// extension identifies whether serialization is to json or to yaml
+func (aspl *AutoscalePolicyList) WriteToFile(filename string) error {
+	pathExt := path.Ext(filename)
+	var bytes []byte
+	var merr error = nil
+
+	if pathExt == ".yaml" || pathExt == ".YAML" || pathExt == ".yml" {
+		bytes, merr = yaml.Marshal(*aspl)
+	} else if pathExt == ".json" || pathExt == ".JSON" {
+		bytes, merr = json.MarshalIndent(*aspl, "", "\t")
+	}
+
+	if merr != nil {
+		panic(merr)
+	}
+
+	f, cerr := os.Create(filename)
+	if cerr != nil {
+		panic(cerr)
+	}
+	_, werr := f.WriteString(string(bytes[:]))
+	if werr != nil {
+		panic(werr)
+	}
+	f.Close()
+	return werr
+}
@@ -0,0 +1,316 @@
+package pces
+
+// file desc-bundle.go holds structs and methods that describe an experiment bundle, a single
+// document that references or inlines all of the model descriptions of an experiment together
+// with its run settings, and that builds from it the map of input files the loaders read
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BundleDocKeys lists the documents an experiment bundle may hold, by the names of the
+// command line flags they replace
+var BundleDocKeys []string = []string{"cp", "cpInit", "funcExec", "devExec", "map", "exp", "topo",
+	"experiments", "autoscale", "templates", "sharedCfg", "dvfs"}
+
+// bundleRequiredDocs lists the documents every experiment bundle must hold
+var bundleRequiredDocs []string = []string{"cp", "cpInit", "funcExec", "devExec", "map", "exp", "topo"}
+
+// A BundleDoc either names the file holding a document, or holds the document itself.
+// A file named by a relative path is found in the bundle's InputLib.  An inlined document
+// is any value that serializes to the document's format, e.g. a *CompPatternDict built by a
+// program, or the map read from the bundle file.  The cp, cpInit, and funcExec documents may
+// also name overlay files, applied in order to the document
+type BundleDoc struct {
+	File     string   `json:"file,omitempty" yaml:"file,omitempty"`
+	Inline   any      `json:"inline,omitempty" yaml:"inline,omitempty"`
+	Overlays []string `json:"overlays,omitempty" yaml:"overlays,omitempty"`
+}
+
+// bundleLayeredDocs lists the documents that may have overlays
+var bundleLayeredDocs []string = []string{"cp", "cpInit", "funcExec"}
+
+// ExperimentBundle gathers everything needed to run an experiment.
+//
+//	Stop          - run the simulation until this time (seconds), zero for no limit
+//	RngSeed       - seed for the random number streams, zero to leave the default
+//	TimeUnits     - units used in reporting time, in {sec, msec, musec, nsec}
+//	Trace         - output file of trace records, empty for no trace
+//	CSV           - output file where measurements are written
+//	Stochastic    - draw function execution times from the distributions given with their timings
+//	FailNegative  - stop the run when a function execution time is estimated to be negative
+//	ClampNegative - take a function execution time estimated to be negative as zero
+//	CPUAcct       - output file, csv or json, where the CPU used by each function is written, empty for none
+//	ScaleCSV      - output file, csv, where the replica counts of autoscaled functions are written, empty for none
+//
+// Output files named by relative paths are placed in OutputLib
+type ExperimentBundle struct {
+	Exprmnt       string               `json:"exprmnt" yaml:"exprmnt"`
+	InputLib      string               `json:"inputlib" yaml:"inputlib"`
+	OutputLib     string               `json:"outputlib" yaml:"outputlib"`
+	Docs          map[string]BundleDoc `json:"docs" yaml:"docs"`
+	Stop          float64              `json:"stop" yaml:"stop"`
+	RngSeed       int                  `json:"rngseed" yaml:"rngseed"`
+	TimeUnits     string               `json:"tunits" yaml:"tunits"`
+	Trace         string               `json:"trace" yaml:"trace"`
+	CSV           string               `json:"csv" yaml:"csv"`
+	Verbose       bool                 `json:"verbose" yaml:"verbose"`
+	Stochastic    bool                 `json:"stochastic" yaml:"stochastic"`
+	FailNegative  bool                 `json:"failnegative,omitempty" yaml:"failnegative,omitempty"`
+	ClampNegative bool                 `json:"clampnegative,omitempty" yaml:"clampnegative,omitempty"`
+	CPUAcct       string               `json:"cpuacct,omitempty" yaml:"cpuacct,omitempty"`
+	ScaleCSV      string               `json:"scalecsv,omitempty" yaml:"scalecsv,omitempty"`
+}
+
+// CreateExperimentBundle is a constructor
+func CreateExperimentBundle(exprmnt, inputLib, outputLib string) *ExperimentBundle {
+	eb := new(ExperimentBundle)
+	eb.Exprmnt = exprmnt
+	eb.InputLib = inputLib
+	eb.OutputLib = outputLib
+	eb.Docs = make(map[string]BundleDoc)
+	eb.TimeUnits = "sec"
+	return eb
+}
+
+// AddDocFile names the file that holds the document with the given key
+func (eb *ExperimentBundle) AddDocFile(key, filename string) error {
+	if !bundleDocKey(key) {
+		return fmt.Errorf("experiment bundle does not recognize document %s", key)
+	}
+	eb.Docs[key] = BundleDoc{File: filename}
+	return nil
+}
+
+// AddDoc includes the document with the given key in the bundle
+func (eb *ExperimentBundle) AddDoc(key string, doc any) error {
+	if !bundleDocKey(key) {
+		return fmt.Errorf("experiment bundle does not recognize document %s", key)
+	}
+	eb.Docs[key] = BundleDoc{Inline: doc}
+	return nil
+}
+
+// bundleDocKey is true if the key names a document a bundle may hold
+func bundleDocKey(key string) bool {
+	for _, docKey := range BundleDocKeys {
+		if key == docKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the bundle holds every required document, each either named or inlined but not both,
+// and that its run settings are well-formed
+func (eb *ExperimentBundle) Validate() error {
+	errs := []error{}
+	if len(eb.Exprmnt) == 0 {
+		errs = append(errs, errors.New("experiment bundle does not name the experiment"))
+	}
+	for _, key := range bundleRequiredDocs {
+		_, present := eb.Docs[key]
+		if !present {
+			errs = append(errs, fmt.Errorf("experiment bundle %s is missing document %s", eb.Exprmnt, key))
+		}
+	}
+
+	keys := make([]string, 0, len(eb.Docs))
+	for key := range eb.Docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		doc := eb.Docs[key]
+		if !bundleDocKey(key) {
+			errs = append(errs, fmt.Errorf("experiment bundle %s holds unrecognized document %s", eb.Exprmnt, key))
+		}
+		if len(doc.File) > 0 && doc.Inline != nil {
+			errs = append(errs, fmt.Errorf("experiment bundle %s both names and inlines document %s", eb.Exprmnt, key))
+		}
+		if len(doc.File) == 0 && doc.Inline == nil {
+			errs = append(errs, fmt.Errorf("experiment bundle %s gives neither a file nor a document for %s", eb.Exprmnt, key))
+		}
+		if len(doc.Overlays) > 0 && !slices.Contains(bundleLayeredDocs, key) {
+			errs = append(errs, fmt.Errorf("experiment bundle %s gives overlays for document %s, which does not take them", eb.Exprmnt, key))
+		}
+	}
+
+	if !(eb.TimeUnits == "sec" || eb.TimeUnits == "musec" || eb.TimeUnits == "msec" || eb.TimeUnits == "nsec") {
+		errs = append(errs, fmt.Errorf("experiment bundle %s time units must be in {sec, msec, musec, nsec}", eb.Exprmnt))
+	}
+	if eb.Stop < 0.0 {
+		errs = append(errs, fmt.Errorf("experiment bundle %s has negative stop time", eb.Exprmnt))
+	}
+	if len(eb.CSV) == 0 {
+		errs = append(errs, fmt.Errorf("experiment bundle %s names no csv file for measurements", eb.Exprmnt))
+	}
+	if len(eb.CPUAcct) > 0 {
+		err := checkCPUAcctFile(eb.CPUAcct)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(eb.ScaleCSV) > 0 {
+		err := checkAutoscaleCSVFile(eb.ScaleCSV)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return ReportErrs(errs)
+}
+
+// BuildSyn returns the map from document key to input file that GetExperimentCPDicts and
+// mrnes.BuildExperimentNet read.  Named files are resolved against InputLib and must be readable;
+// inlined documents are written as yaml to files in workDir, which is created if needed
+func (eb *ExperimentBundle) BuildSyn(workDir string) (map[string]string, error) {
+	err := eb.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	bsyn := make(map[string]string)
+	errs := []error{}
+	named := []string{}
+	for _, key := range BundleDocKeys {
+		doc, present := eb.Docs[key]
+		if !present {
+			bsyn[key] = ""
+			continue
+		}
+
+		// overlays follow the document in a comma-separated list
+		layers := []string{}
+		for _, overlay := range doc.Overlays {
+			if !filepath.IsAbs(overlay) {
+				overlay = filepath.Join(eb.InputLib, overlay)
+			}
+			layers = append(layers, overlay)
+			named = append(named, overlay)
+		}
+
+		if len(doc.File) > 0 {
+			filename := doc.File
+			if !filepath.IsAbs(filename) {
+				filename = filepath.Join(eb.InputLib, filename)
+			}
+			bsyn[key] = strings.Join(append([]string{filename}, layers...), ",")
+			named = append(named, filename)
+			continue
+		}
+
+		bytes, merr := yaml.Marshal(doc.Inline)
+		if merr != nil {
+			errs = append(errs, fmt.Errorf("experiment bundle %s document %s: %s", eb.Exprmnt, key, merr.Error()))
+			continue
+		}
+		merr = os.MkdirAll(workDir, 0755)
+		if merr != nil {
+			return nil, merr
+		}
+		filename := filepath.Join(workDir, eb.Exprmnt+"-"+key+".yaml")
+		merr = os.WriteFile(filename, bytes, 0644)
+		if merr != nil {
+			errs = append(errs, merr)
+			continue
+		}
+		bsyn[key] = strings.Join(append([]string{filename}, layers...), ",")
+	}
+
+	if len(named) > 0 {
+		ok, rerr := CheckReadableFiles(named)
+		if !ok {
+			errs = append(errs, rerr)
+		}
+	}
+
+	err = ReportErrs(errs)
+	if err != nil {
+		return nil, err
+	}
+	return bsyn, nil
+}
+
+// ReadExperimentBundle deserializes a slice of bytes into an ExperimentBundle.  Bytes are either provided, or are
+// read from a file whose name is given.  When read from a file whose InputLib is not given,
+// named documents are found in the directory holding the bundle file
+func ReadExperimentBundle(filename string, useYAML bool, dict []byte) (*ExperimentBundle, error) {
+	var err error
+	fromFile := false
+
+	// empty slice of bytes means we get those bytes from the named file
+	if len(dict) == 0 {
+		// validate input file name
+		fileInfo, err := os.Stat(filename)
+		if os.IsNotExist(err) || fileInfo.IsDir() {
+			msg := fmt.Sprintf("experiment bundle %s does not exist or cannot be read", filename)
+			fmt.Println(msg)
+			return nil, errors.New(msg)
+		}
+		dict, err = os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		fromFile = true
+	}
+
+	example := ExperimentBundle{}
+
+	if useYAML {
+		err = yaml.Unmarshal(dict, &example)
+	} else {
+		err = json.Unmarshal(dict, &example)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if example.Docs == nil {
+		example.Docs = make(map[string]BundleDoc)
+	}
+	if len(example.TimeUnits) == 0 {
+		example.TimeUnits = "sec"
+	}
+	if fromFile && len(example.InputLib) == 0 {
+		example.InputLib = filepath.Dir(filename)
+	}
+	return &example, nil
+}
+
+// WriteToFile serializes the ExperimentBundle and writes it to a file.  Output file
+// extension identifies whether serialization is to json or to yaml
+func (eb *ExperimentBundle) WriteToFile(filename string) error {
+	pathExt := path.Ext(filename)
+	var bytes []byte
+	var merr error = nil
+
+	if pathExt == ".yaml" || pathExt == ".YAML" || pathExt == ".yml" {
+		bytes, merr = yaml.Marshal(*eb)
+	} else if pathExt == ".json" || pathExt == ".JSON" {
+		bytes, merr = json.MarshalIndent(*eb, "", "\t")
+	}
+
+	if merr != nil {
+		panic(merr)
+	}
+
+	f, cerr := os.Create(filename)
+	if cerr != nil {
+		panic(cerr)
+	}
+	_, werr := f.WriteString(string(bytes[:]))
+	if werr != nil {
+		panic(werr)
+	}
+	f.Close()
+	return werr
+}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"strings"
 )
 
@@ -249,14 +250,20 @@ func (cpt *CompPattern) SetName(name string) {
 
 // CompPatternDict holds pattern descriptions, is serializable
 type CompPatternDict struct {
+	// Version is the format version of the file, see ModelFormatVersion
+	Version  int                    `json:"version,omitempty" yaml:"version,omitempty"`
 	DictName string                 `json:"dictname" yaml:"dictname"`
 	Patterns map[string]CompPattern `json:"patterns" yaml:"patterns"`
+
+	// Include names other files whose patterns are merged into this dictionary when it is read
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
 }
 
 // CreateCompPatternDict is an initialization constructor.
 // Its output struct has methods for integrating data.
 func CreateCompPatternDict(name string) *CompPatternDict {
 	cpd := new(CompPatternDict)
+	cpd.Version = ModelFormatVersion
 	cpd.DictName = name
 	cpd.Patterns = make(map[string]CompPattern)
 
@@ -320,6 +327,17 @@ func ReadCompPatternDict(filename string, useYAML bool, dict []byte) (*CompPatte
 		err = json.Unmarshal(dict, &example)
 	}
 
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkFormatVersion("comp pattern dictionary", filename, example.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	// merge in the patterns of included files
+	err = example.resolveIncludes(filename, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -418,15 +436,15 @@ func CreateSharedCfgGroupList(yaml bool) *SharedCfgGroupList {
 }
 
 // AddSharedCfgGroup includes an offered cfg group the the list,
-// but checks that there is not already one there with the same name and class
-func (scgl *SharedCfgGroupList) AddSharedCfgGroup(ssg *SharedCfgGroup) {
+// but returns an error if there is already one there with the same name
+func (scgl *SharedCfgGroupList) AddSharedCfgGroup(ssg *SharedCfgGroup) error {
 	for _, ssgrp := range scgl.Groups {
-		if ssgrp.Name == ssg.Name && ssgrp.Class == ssg.Class {
-			panic(fmt.Errorf("attempt to include shared cfg class with same name %s and class	%s as previously included",
-				ssg.Name, ssg.Class))
+		if ssgrp.Name == ssg.Name {
+			return fmt.Errorf("attempt to include shared cfg group with same name %s as previously included", ssg.Name)
 		}
 	}
 	scgl.Groups = append(scgl.Groups, *ssg)
+	return nil
 }
 
 // ReadSharedCfgGroupList returns a deserialized slice of bytes into a SharedCfgGroupList.  Bytes are either provided, or are
@@ -505,11 +523,161 @@ type CPInitList struct {
 	// UseYAML flags whether to interpret the seriaized initialization structure using json or yaml
 	UseYAML bool `json:"useyaml" yaml:"useyaml"`
 
-	// Cfg is indexed by Func label, mapping to a serialized representation of a struct
+	// Cfg is indexed by Func label, mapping to a serialized representation of a struct.
+	// In a file a cfg may be written either in that serialized form, or as a nested object
+	// that is serialized when read
 	Cfg map[string]string `json:"cfg" yaml:"cfg"`
 
 	// Msgs holds a list of CompPatternMsgs used between Funcs in a CompPattern
 	Msgs []CompPatternMsg `json:"msgs" yaml:"msgs"`
+
+	// NativeCfg holds the labels of the cfgs written to file as nested objects rather than as serialized strings,
+	// those read from file in that form or added by AddCfgObject.  Each cfg is written back in the form it was given
+	NativeCfg map[string]bool `json:"-" yaml:"-"`
+}
+
+// cpInitListFile is the form of a CPInitList in a file, where a cfg is either a serialized
+// string or a nested object
+type cpInitListFile struct {
+	Name    string           `json:"name" yaml:"name"`
+	CPType  string           `json:"cptype" yaml:"cptype"`
+	UseYAML bool             `json:"useyaml" yaml:"useyaml"`
+	Cfg     map[string]any   `json:"cfg" yaml:"cfg"`
+	Msgs    []CompPatternMsg `json:"msgs" yaml:"msgs"`
+}
+
+// fromFile fills in the CPInitList from its file form.  Cfgs written as objects are held serialized
+// as yaml until decodeNativeCfgs, knowing the class of each function, decodes them into the cfg types of their classes
+func (cpil *CPInitList) fromFile(cf *cpInitListFile) error {
+	cpil.Name = cf.Name
+	cpil.CPType = cf.CPType
+	cpil.UseYAML = cf.UseYAML
+	cpil.Msgs = cf.Msgs
+	cpil.Cfg = make(map[string]string)
+	cpil.NativeCfg = make(map[string]bool)
+	for label, cfg := range cf.Cfg {
+		switch cfgv := cfg.(type) {
+		case string:
+			cpil.Cfg[label] = cfgv
+		case nil:
+			cpil.Cfg[label] = ""
+		default:
+			bytes, err := yaml.Marshal(cfgv)
+			if err != nil {
+				return fmt.Errorf("initialization list %s cfg %s: %s", cf.Name, label, err.Error())
+			}
+			cpil.Cfg[label] = string(bytes)
+			cpil.NativeCfg[label] = true
+		}
+	}
+	return nil
+}
+
+// toFile returns the file form of the CPInitList, the cfgs named in NativeCfg as nested objects
+// and the others as serialized strings
+func (cpil CPInitList) toFile() (*cpInitListFile, error) {
+	cf := &cpInitListFile{Name: cpil.Name, CPType: cpil.CPType, UseYAML: cpil.UseYAML, Msgs: cpil.Msgs}
+	cf.Cfg = make(map[string]any)
+	for label, cfgStr := range cpil.Cfg {
+		if !cpil.NativeCfg[label] {
+			cf.Cfg[label] = cfgStr
+			continue
+		}
+		var cfg any
+		err := yaml.Unmarshal([]byte(cfgStr), &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("initialization list %s cfg %s: %s", cpil.Name, label, err.Error())
+		}
+		cf.Cfg[label] = cfg
+	}
+	return cf, nil
+}
+
+// UnmarshalYAML accepts each cfg as either a serialized string or a nested object
+func (cpil *CPInitList) UnmarshalYAML(value *yaml.Node) error {
+	cf := cpInitListFile{}
+	err := value.Decode(&cf)
+	if err != nil {
+		return err
+	}
+	return cpil.fromFile(&cf)
+}
+
+// UnmarshalJSON accepts each cfg as either a serialized string or a nested object
+func (cpil *CPInitList) UnmarshalJSON(data []byte) error {
+	cf := cpInitListFile{}
+	err := json.Unmarshal(data, &cf)
+	if err != nil {
+		return err
+	}
+	return cpil.fromFile(&cf)
+}
+
+// MarshalYAML writes the cfgs named in NativeCfg as nested objects, and the others as serialized strings
+func (cpil CPInitList) MarshalYAML() (any, error) {
+	return cpil.toFile()
+}
+
+// MarshalJSON writes the cfgs named in NativeCfg as nested objects, and the others as serialized strings
+func (cpil CPInitList) MarshalJSON() ([]byte, error) {
+	cf, err := cpil.toFile()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(cf)
+}
+
+// decodeClassCfg decodes a cfg serialized as yaml into the cfg type of the function class, found through
+// FuncClasses, and returns the yaml serialization of that typed cfg
+func decodeClassCfg(class, cfgStr string) (string, error) {
+	fc, present := FuncClasses[class]
+	if !present {
+		return "", fmt.Errorf("no registered function class %s", class)
+	}
+	cfg := reflect.New(reflect.TypeOf(fc).Elem()).Interface()
+	err := yaml.Unmarshal([]byte(cfgStr), cfg)
+	if err != nil {
+		return "", fmt.Errorf("%s cfg: %s", class, err.Error())
+	}
+	bytes, err := yaml.Marshal(cfg)
+	if err != nil {
+		return "", fmt.Errorf("%s cfg: %s", class, err.Error())
+	}
+	return string(bytes), nil
+}
+
+// decodeNativeCfgs decodes every cfg read from file as a nested object into the cfg type of its function's class,
+// so that the class creates its cfg from that type's own serialization
+func decodeNativeCfgs(cpd *CompPatternDict, cpid *CPInitListDict) error {
+	errs := []error{}
+	for _, ptnName := range sortedPtnNames(cpd) {
+		cpil, present := cpid.InitList[ptnName]
+		if !present {
+			continue
+		}
+		for _, fnc := range cpd.Patterns[ptnName].Funcs {
+			if !cpil.NativeCfg[fnc.Label] {
+				continue
+			}
+			cfgStr, err := decodeClassCfg(fnc.Class, cpil.Cfg[fnc.Label])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("initialization list %s cfg %s: %s", ptnName, fnc.Label, err.Error()))
+				continue
+			}
+			cpil.Cfg[fnc.Label] = cfgStr
+		}
+	}
+	return ReportErrs(errs)
+}
+
+// hasStringCfgs is true if any cfg of the list is written as a serialized string rather than as a nested object
+func (cpil *CPInitList) hasStringCfgs() bool {
+	for label := range cpil.Cfg {
+		if !cpil.NativeCfg[label] {
+			return true
+		}
+	}
+	return false
 }
 
 // CreateCPInitList constructs a CPInitList for an instance of a CompPattern
@@ -520,6 +688,7 @@ func CreateCPInitList(name string, cptype string, useYAML bool) *CPInitList {
 	cpil.CPType = cptype
 	cpil.UseYAML = useYAML
 	cpil.Cfg = make(map[string]string)
+	cpil.NativeCfg = make(map[string]bool)
 
 	cpil.Msgs = make([]CompPatternMsg, 0)
 	return cpil
@@ -535,6 +704,10 @@ func (cpil *CPInitList) DeepCopy() *CPInitList {
 	for k, v := range cpil.Cfg {
 		nl.Cfg[k] = v
 	}
+	nl.NativeCfg = make(map[string]bool)
+	for k, v := range cpil.NativeCfg {
+		nl.NativeCfg[k] = v
+	}
 	nl.Msgs = make([]CompPatternMsg, len(cpil.Msgs))
 	for idx, msg := range cpil.Msgs {
 		nl.Msgs[idx] = CompPatternMsg{MsgType: msg.MsgType,
@@ -543,7 +716,7 @@ func (cpil *CPInitList) DeepCopy() *CPInitList {
 	return nl
 }
 
-// AddCfg puts a serialized initialization struct in the dictionary indexed by Func label
+// AddCfg puts a serialized initialization struct in the dictionary indexed by Func label, to be written as a string
 func (cpil *CPInitList) AddCfg(cpt *CompPattern, fnc *Func, cfg string) {
 	// make sure that the function to which the cfg is attached has been defined for the given CmpPtn
 	foundFunc := false
@@ -557,6 +730,26 @@ func (cpil *CPInitList) AddCfg(cpt *CompPattern, fnc *Func, cfg string) {
 		panic(fmt.Errorf("attempt to add cfg to CmpPtn %s for a function %s not defined", cpt.Name, fnc.Label))
 	}
 	cpil.Cfg[fnc.Label] = cfg
+	delete(cpil.NativeCfg, fnc.Label)
+}
+
+// AddCfgObject puts the cfg struct of a function's class (e.g. a *ProcessPcktCfg) in the dictionary
+// indexed by Func label, to be written as a nested object
+func (cpil *CPInitList) AddCfgObject(cpt *CompPattern, fnc *Func, cfg any) error {
+	bytes, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	cfgStr, err := decodeClassCfg(fnc.Class, string(bytes))
+	if err != nil {
+		return err
+	}
+	cpil.AddCfg(cpt, fnc, cfgStr)
+	if cpil.NativeCfg == nil {
+		cpil.NativeCfg = make(map[string]bool)
+	}
+	cpil.NativeCfg[fnc.Label] = true
+	return nil
 }
 
 // AddMsg appends description of a ComPatternMsg to the CPInitList's slice of messages used by the CompPattern.
@@ -640,16 +833,22 @@ func (cpil *CPInitList) WriteToFile(filename string) error {
 // prebuilt versions (in which case InitList is indexed by CompPattern type) or
 // is holding init lists for CPs to be part of an experiment, so the CP name is known is used as the key
 type CPInitListDict struct {
+	// Version is the format version of the file, see ModelFormatVersion
+	Version  int    `json:"version,omitempty" yaml:"version,omitempty"`
 	DictName string `json:"dictname" yaml:"dictname"`
 
 	// indexed by name of comp pattern
 	InitList map[string]CPInitList `json:"initlist" yaml:"initlist"`
+
+	// Include names other files whose initialization lists are merged into this dictionary when it is read
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
 }
 
 // CreateCPInitListDict is an initialization constructor.
 // Its output struct has methods for integrating data.
 func CreateCPInitListDict(name string) *CPInitListDict {
 	cpild := new(CPInitListDict)
+	cpild.Version = ModelFormatVersion
 	cpild.DictName = name
 	cpild.InitList = make(map[string]CPInitList)
 	return cpild
@@ -735,6 +934,16 @@ func ReadCPInitListDict(filename string, useYAML bool, dict []byte) (*CPInitList
 		return nil, err
 	}
 
+	err = checkFormatVersion("initialization list dictionary", filename, example.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	// merge in the initialization lists of included files
+	err = example.resolveIncludes(filename, nil)
+	if err != nil {
+		return nil, err
+	}
 	return &example, nil
 }
 
@@ -0,0 +1,70 @@
+package pces
+
+import (
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+)
+
+func TestCPInitListCfgForms(t *testing.T) {
+	cpd, _, _, _ := testModel(t)
+	doc := "name: chain1\ncptype: chain\nuseyaml: true\ncfg:\n" +
+		"  src: \"pcktlen: 1000\\nmsglen: 1000\\nmsgtype: req\\n\"\n" +
+		"  proc: {timingcode: {req: crypt}}\n" +
+		"  hash: {}\n" +
+		"  sink: \"trace: 0\\n\"\n"
+	cpil := CPInitList{}
+	err := yaml.Unmarshal([]byte(doc), &cpil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		label  string
+		class  string
+		native bool
+	}{
+		{"src", "start", false},
+		{"proc", "processPckt", true},
+		{"hash", "processPckt", true},
+		{"sink", "finish", false},
+	}
+
+	// each cfg is written back in the form it was read
+	bytes, err := yaml.Marshal(cpil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := cpInitListFile{}
+	err = yaml.Unmarshal(bytes, &written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range tests {
+		_, isStr := written.Cfg[tc.label].(string)
+		if cpil.NativeCfg[tc.label] != tc.native || isStr == tc.native {
+			t.Errorf("cfg %s read as native %v, written as a string %v, want native %v",
+				tc.label, cpil.NativeCfg[tc.label], isStr, tc.native)
+		}
+	}
+
+	// native cfgs are decoded into the cfg types of their classes, the serialized cfgs left alone
+	cpid := CreateCPInitListDict("cpid")
+	cpid.InitList["chain1"] = cpil
+	err = decodeNativeCfgs(cpd, cpid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range tests {
+		cfgStr := cpil.Cfg[tc.label]
+		if tc.native && (strings.HasPrefix(cfgStr, "{") || !strings.Contains(cfgStr, "timingcode:")) {
+			t.Errorf("native cfg %s decoded to %q, not the processPckt cfg serialized as yaml", tc.label, cfgStr)
+		}
+		if FuncClasses[tc.class].CreateCfg(cfgStr) == nil {
+			t.Errorf("cfg %s not created by its class", tc.label)
+		}
+	}
+	if cpil.Cfg["src"] != "pcktlen: 1000\nmsglen: 1000\nmsgtype: req\n" {
+		t.Errorf("serialized cfg of src changed to %q", cpil.Cfg["src"])
+	}
+}
@@ -0,0 +1,260 @@
+package pces
+
+// file desc-dvfs.go holds structs and methods used to describe the policies that govern
+// the CPU frequency of hosts over time, and so the execution times of the functions they run
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"sort"
+)
+
+// A FreqStep sets the frequency of a host's CPU at a simulation time (seconds)
+type FreqStep struct {
+	Time float64 `json:"time" yaml:"time"`
+	Freq float64 `json:"freq" yaml:"freq"`
+}
+
+// A DVFSPolicy describes how the CPU frequency of one host changes over time.
+// The host's timings are taken to have been measured at its Nominal frequency.
+//
+//	Governor - "schedule" to change frequency at the times listed in Schedule,
+//	           "ondemand" to sample the host's utilization every Interval seconds and
+//	           move one of the States up when it is at or above Up, or down when at or below Down
+//	Initial  - frequency at the start of the run.  If zero, Nominal for a schedule
+//	           and the highest of the States for ondemand
+//	States   - frequencies the host may run at.  Required for ondemand; for a schedule,
+//	           when given, every frequency of the schedule must be one of them
+type DVFSPolicy struct {
+	Host     string     `json:"host" yaml:"host"`
+	Governor string     `json:"governor" yaml:"governor"`
+	Nominal  float64    `json:"nominal" yaml:"nominal"`
+	Initial  float64    `json:"initial,omitempty" yaml:"initial,omitempty"`
+	States   []float64  `json:"states,omitempty" yaml:"states,omitempty"`
+	Schedule []FreqStep `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	Interval float64    `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Up       float64    `json:"up,omitempty" yaml:"up,omitempty"`
+	Down     float64    `json:"down,omitempty" yaml:"down,omitempty"`
+}
+
+// CreateDVFSPolicy is a constructor of a policy that follows a schedule, to which steps are added with AddStep
+func CreateDVFSPolicy(host string, nominal float64) *DVFSPolicy {
+	dp := new(DVFSPolicy)
+	dp.Host = host
+	dp.Governor = "schedule"
+	dp.Nominal = nominal
+	dp.Schedule = make([]FreqStep, 0)
+	return dp
+}
+
+// CreateOndemandPolicy is a constructor of a policy that steps among the given frequency
+// states according to the utilization of the host, sampled every interval seconds
+func CreateOndemandPolicy(host string, nominal float64, states []float64, interval, up, down float64) *DVFSPolicy {
+	dp := new(DVFSPolicy)
+	dp.Host = host
+	dp.Governor = "ondemand"
+	dp.Nominal = nominal
+	dp.States = make([]float64, len(states))
+	copy(dp.States, states)
+	dp.Interval = interval
+	dp.Up = up
+	dp.Down = down
+	return dp
+}
+
+// AddStep includes in the schedule a change to the given frequency at the given time
+func (dp *DVFSPolicy) AddStep(time, freq float64) {
+	dp.Schedule = append(dp.Schedule, FreqStep{Time: time, Freq: freq})
+}
+
+// isState is true if the policy lists no States, or the frequency is one of them
+func (dp *DVFSPolicy) isState(freq float64) bool {
+	if len(dp.States) == 0 {
+		return true
+	}
+	for _, state := range dp.States {
+		if state == freq {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedStates returns the frequency states of the policy in increasing order
+func (dp *DVFSPolicy) sortedStates() []float64 {
+	states := make([]float64, len(dp.States))
+	copy(states, dp.States)
+	sort.Float64s(states)
+	return states
+}
+
+// initialFreq returns the frequency of the host at the start of the run
+func (dp *DVFSPolicy) initialFreq() float64 {
+	if dp.Initial > 0.0 {
+		return dp.Initial
+	}
+	if dp.Governor == "ondemand" && len(dp.States) > 0 {
+		states := dp.sortedStates()
+		return states[len(states)-1]
+	}
+	return dp.Nominal
+}
+
+// Validate checks the internal consistency of the policy
+func (dp *DVFSPolicy) Validate() error {
+	errs := []error{}
+	if len(dp.Host) == 0 {
+		errs = append(errs, fmt.Errorf("dvfs policy names no host"))
+	}
+	if !(dp.Nominal > 0.0) {
+		errs = append(errs, fmt.Errorf("dvfs policy for %s needs positive nominal frequency", dp.Host))
+	}
+	if dp.Initial < 0.0 || dp.Initial > 0.0 && !dp.isState(dp.Initial) {
+		errs = append(errs, fmt.Errorf("dvfs policy for %s has initial frequency %g, which is not a positive frequency state", dp.Host, dp.Initial))
+	}
+	for _, state := range dp.States {
+		if !(state > 0.0) {
+			errs = append(errs, fmt.Errorf("dvfs policy for %s has non-positive frequency state", dp.Host))
+			break
+		}
+	}
+
+	switch dp.Governor {
+	case "schedule":
+		if len(dp.Schedule) == 0 {
+			errs = append(errs, fmt.Errorf("dvfs policy for %s has an empty schedule", dp.Host))
+		}
+		for idx, step := range dp.Schedule {
+			if step.Time < 0.0 || idx > 0 && step.Time < dp.Schedule[idx-1].Time {
+				errs = append(errs, fmt.Errorf("dvfs policy for %s needs schedule times non-negative and in increasing order", dp.Host))
+				break
+			}
+			if !(step.Freq > 0.0) || !dp.isState(step.Freq) {
+				errs = append(errs, fmt.Errorf("dvfs policy for %s schedules frequency %g, which is not a positive frequency state", dp.Host, step.Freq))
+				break
+			}
+		}
+	case "ondemand":
+		if len(dp.States) == 0 {
+			errs = append(errs, fmt.Errorf("dvfs policy for %s has governor ondemand but no frequency states", dp.Host))
+		}
+		if !(dp.Interval > 0.0) {
+			errs = append(errs, fmt.Errorf("dvfs policy for %s needs positive interval", dp.Host))
+		}
+		if dp.Down < 0.0 || dp.Down >= dp.Up || dp.Up > 1.0 {
+			errs = append(errs, fmt.Errorf("dvfs policy for %s needs 0 <= down < up <= 1", dp.Host))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("dvfs policy for %s has governor %s, not in {schedule, ondemand}", dp.Host, dp.Governor))
+	}
+	return ReportErrs(errs)
+}
+
+// DVFSPolicyList holds all the DVFS policies of an experiment.  Sensitivity gives, by operation,
+// the fraction of its execution time that scales with CPU frequency, the rest (e.g. time waiting
+// on memory) being unaffected.  An operation not listed is taken to scale entirely
+type DVFSPolicyList struct {
+	ListName    string             `json:"listname" yaml:"listname"`
+	Sensitivity map[string]float64 `json:"sensitivity,omitempty" yaml:"sensitivity,omitempty"`
+	Policies    []DVFSPolicy       `json:"policies" yaml:"policies"`
+}
+
+// CreateDVFSPolicyList is a constructor
+func CreateDVFSPolicyList(name string) *DVFSPolicyList {
+	dpl := new(DVFSPolicyList)
+	dpl.ListName = name
+	dpl.Sensitivity = make(map[string]float64)
+	dpl.Policies = make([]DVFSPolicy, 0)
+	return dpl
+}
+
+// AddPolicy includes a policy in the list, returning an error if the list
+// already holds a policy for the same host
+func (dpl *DVFSPolicyList) AddPolicy(dp *DVFSPolicy) error {
+	for _, xdp := range dpl.Policies {
+		if xdp.Host == dp.Host {
+			return fmt.Errorf("duplicated dvfs policy for host %s", dp.Host)
+		}
+	}
+	dpl.Policies = append(dpl.Policies, *dp)
+	return nil
+}
+
+// SetSensitivity gives the fraction of the execution time of an operation that scales with CPU frequency
+func (dpl *DVFSPolicyList) SetSensitivity(op string, sensitivity float64) error {
+	if sensitivity < 0.0 || sensitivity > 1.0 {
+		return fmt.Errorf("dvfs sensitivity of %s must lie in [0,1]", op)
+	}
+	if dpl.Sensitivity == nil {
+		dpl.Sensitivity = make(map[string]float64)
+	}
+	dpl.Sensitivity[op] = sensitivity
+	return nil
+}
+
+// ReadDVFSPolicyList deserializes a slice of bytes into a DVFSPolicyList.  Bytes are either provided, or are
+// read from a file whose name is given.
+func ReadDVFSPolicyList(filename string, useYAML bool, dict []byte) (*DVFSPolicyList, error) {
+	var err error
+
+	// empty slice of bytes means we get those bytes from the named file
+	if len(dict) == 0 {
+		// validate input file name
+		fileInfo, err := os.Stat(filename)
+		if os.IsNotExist(err) || fileInfo.IsDir() {
+			msg := fmt.Sprintf("dvfs policy list %s does not exist or cannot be read", filename)
+			fmt.Println(msg)
+			return nil, errors.New(msg)
+		}
+		dict, err = os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	example := DVFSPolicyList{}
+
+	if useYAML {
+		err = yaml.Unmarshal(dict, &example)
+	} else {
+		err = json.Unmarshal(dict, &example)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &example, nil
+}
+
+// WriteToFile serializes the DVFSPolicyList and writes it to a file.  Output file
+// extension identifies whether serialization is to json or to yaml
+func (dpl *DVFSPolicyList) WriteToFile(filename string) error {
+	pathExt := path.Ext(filename)
+	var bytes []byte
+	var merr error = nil
+
+	if pathExt == ".yaml" || pathExt == ".YAML" || pathExt == ".yml" {
+		bytes, merr = yaml.Marshal(*dpl)
+	} else if pathExt == ".json" || pathExt == ".JSON" {
+		bytes, merr = json.MarshalIndent(*dpl, "", "\t")
+	}
+
+	if merr != nil {
+		panic(merr)
+	}
+
+	f, cerr := os.Create(filename)
+	if cerr != nil {
+		panic(cerr)
+	}
+	_, werr := f.WriteString(string(bytes[:]))
+	if werr != nil {
+		panic(werr)
+	}
+	f.Close()
+	return werr
+}
@@ -0,0 +1,528 @@
+package pces
+
+// file desc-include.go holds the methods that assemble a CompPatternDict, CPInitListDict, or
+// FuncExecList from more than one file.  A file may name others in its include list, whose entries
+// are merged in when it is read; entries defined in more than one of these files must agree.
+// A base description may also be followed by overlays, whose entries override or extend
+// those of the base, merged by pattern name, function label, and operation identifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// LayerFiles splits a comma-separated list of file names into the base file and the overlays that follow it
+func LayerFiles(files string) []string {
+	layers := []string{}
+	for _, filename := range strings.Split(files, ",") {
+		filename = strings.TrimSpace(filename)
+		if len(filename) > 0 {
+			layers = append(layers, filename)
+		}
+	}
+	return layers
+}
+
+// includePath returns the path of a file included by another, relative names
+// being found in the directory of the including file
+func includePath(including, inc string) string {
+	if filepath.IsAbs(inc) {
+		return inc
+	}
+	return filepath.Join(filepath.Dir(including), inc)
+}
+
+// includeChain adds a file to the chain of files whose includes are being resolved,
+// returning an error if the file is in the chain already
+func includeChain(filename string, chain []string) ([]string, error) {
+	absName, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for idx, name := range chain {
+		if name == absName {
+			cycle := append(append([]string{}, chain[idx:]...), absName)
+			return nil, fmt.Errorf("include cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+	return append(append([]string{}, chain...), absName), nil
+}
+
+// readIncluded deserializes the named file into the struct pointed to, the file's
+// extension selecting between yaml and json
+func readIncluded(filename string, into any) error {
+	dict, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	ext := path.Ext(filename)
+	if ext == ".yaml" || ext == ".YAML" || ext == ".yml" {
+		err = yaml.Unmarshal(dict, into)
+	} else {
+		err = json.Unmarshal(dict, into)
+	}
+	if err != nil {
+		return fmt.Errorf("included file %s: %s", filename, err.Error())
+	}
+	return nil
+}
+
+// mergeIncluded adds the entries of an included map to the map of the including file.  An entry
+// already present must be identical to the one included, otherwise a conflict is reported.
+// origin records the file each entry came from
+func mergeIncluded[V any](into, from map[string]V, origin map[string]string, fromFile, kind string) []error {
+	errs := []error{}
+	for _, key := range sortedKeys(from) {
+		prev, present := into[key]
+		if present {
+			if !reflect.DeepEqual(prev, from[key]) {
+				errs = append(errs, fmt.Errorf("%s %s is defined differently in %s and %s", kind, key, origin[key], fromFile))
+			}
+			continue
+		}
+		into[key] = from[key]
+		origin[key] = fromFile
+	}
+	return errs
+}
+
+// resolveIncludes merges into the dictionary the patterns of the files it includes, and of the files they include
+func (cpd *CompPatternDict) resolveIncludes(filename string, chain []string) error {
+	if len(cpd.Include) == 0 {
+		return nil
+	}
+	chain, err := includeChain(filename, chain)
+	if err != nil {
+		return err
+	}
+	if cpd.Patterns == nil {
+		cpd.Patterns = make(map[string]CompPattern)
+	}
+	origin := make(map[string]string)
+	for name := range cpd.Patterns {
+		origin[name] = filename
+	}
+
+	errs := []error{}
+	for _, inc := range cpd.Include {
+		incFile := includePath(filename, inc)
+		sub := CompPatternDict{}
+		err = readIncluded(incFile, &sub)
+		if err == nil {
+			err = checkFormatVersion("comp pattern dictionary", incFile, sub.Version)
+		}
+		if err == nil {
+			err = sub.resolveIncludes(incFile, chain)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, mergeIncluded(cpd.Patterns, sub.Patterns, origin, incFile, "comp pattern")...)
+	}
+	cpd.Include = nil
+	return ReportErrs(errs)
+}
+
+// resolveIncludes merges into the dictionary the initialization lists of the files it includes, and of the files they include
+func (cpild *CPInitListDict) resolveIncludes(filename string, chain []string) error {
+	if len(cpild.Include) == 0 {
+		return nil
+	}
+	chain, err := includeChain(filename, chain)
+	if err != nil {
+		return err
+	}
+	if cpild.InitList == nil {
+		cpild.InitList = make(map[string]CPInitList)
+	}
+	origin := make(map[string]string)
+	for name := range cpild.InitList {
+		origin[name] = filename
+	}
+
+	errs := []error{}
+	for _, inc := range cpild.Include {
+		incFile := includePath(filename, inc)
+		sub := CPInitListDict{}
+		err = readIncluded(incFile, &sub)
+		if err == nil {
+			err = checkFormatVersion("initialization list dictionary", incFile, sub.Version)
+		}
+		if err == nil {
+			err = sub.resolveIncludes(incFile, chain)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, mergeIncluded(cpild.InitList, sub.InitList, origin, incFile, "initialization list")...)
+	}
+	cpild.Include = nil
+	return ReportErrs(errs)
+}
+
+// timingKey identifies a timing within the list of timings of an operation
+type timingKey struct {
+	param    string
+	cpuModel string
+	pcktLen  int
+}
+
+// resolveIncludes merges into the list the timings of the files it includes, and of the files they include.
+// Timings are merged individually, so that, e.g., files holding the timings of different CPU models may be
+// included together; timings of an operation for the same param, CPU model, and packet length must be identical
+func (fel *FuncExecList) resolveIncludes(filename string, chain []string) error {
+	if len(fel.Include) == 0 {
+		return nil
+	}
+	chain, err := includeChain(filename, chain)
+	if err != nil {
+		return err
+	}
+	if fel.Times == nil {
+		fel.Times = make(map[string][]FuncExecDesc)
+	}
+	origin := make(map[string]map[timingKey]string)
+	for op, fedList := range fel.Times {
+		origin[op] = make(map[timingKey]string)
+		for _, fed := range fedList {
+			origin[op][timingKey{fed.Param, fed.CPUModel, fed.PcktLen}] = filename
+		}
+	}
+
+	errs := []error{}
+	for _, inc := range fel.Include {
+		incFile := includePath(filename, inc)
+		sub := FuncExecList{}
+		err = readIncluded(incFile, &sub)
+		if err == nil {
+			err = checkFormatVersion("function timing list", incFile, sub.Version)
+		}
+		if err == nil {
+			err = sub.resolveIncludes(incFile, chain)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, op := range sortedKeys(sub.Times) {
+			if origin[op] == nil {
+				origin[op] = make(map[timingKey]string)
+			}
+			for _, fed := range sub.Times[op] {
+				key := timingKey{fed.Param, fed.CPUModel, fed.PcktLen}
+				idx := findTiming(fel.Times[op], key)
+				if idx < 0 {
+					fel.Times[op] = append(fel.Times[op], fed)
+					origin[op][key] = incFile
+					continue
+				}
+				if !reflect.DeepEqual(fel.Times[op][idx], fed) {
+					errs = append(errs, fmt.Errorf("timing of op %s on CPU model %s, param %q, packet length %d is given differently in %s and %s",
+						op, fed.CPUModel, fed.Param, fed.PcktLen, origin[op][key], incFile))
+				}
+			}
+		}
+
+		for _, model := range sortedKeys(sub.Derived) {
+			if fel.Derived == nil {
+				fel.Derived = make(map[string]DerivedCPUModel)
+			}
+			dcm, present := fel.Derived[model]
+			if !present {
+				fel.Derived[model] = sub.Derived[model]
+				continue
+			}
+			if !reflect.DeepEqual(dcm, sub.Derived[model]) {
+				errs = append(errs, fmt.Errorf("derived CPU model %s is given differently in %s and %s", model, filename, incFile))
+			}
+		}
+
+		for _, op := range sortedKeys(sub.Models) {
+			if fel.Models == nil {
+				fel.Models = make(map[string]TimingModelDesc)
+			}
+			tmd, present := fel.Models[op]
+			if !present {
+				fel.Models[op] = sub.Models[op]
+				continue
+			}
+			if tmd != sub.Models[op] {
+				errs = append(errs, fmt.Errorf("timing model of op %s is given differently in %s and %s", op, filename, incFile))
+			}
+		}
+	}
+	fel.Include = nil
+	return ReportErrs(errs)
+}
+
+// findTiming returns the index of the timing with the given key, or -1 if there is none
+func findTiming(fedList []FuncExecDesc, key timingKey) int {
+	for idx, fed := range fedList {
+		if fed.Param == key.param && fed.CPUModel == key.cpuModel && fed.PcktLen == key.pcktLen {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Overlay merges the patterns of ovr into the dictionary.  A pattern not already present is added.
+// Otherwise the functions of the overlay not in the base are added,
+// its services replace those with the same name, and its edges and external edges are added to those of the base.
+// An overlay may not change the CPType of a pattern, nor the class of a function; it may leave either empty
+func (cpd *CompPatternDict) Overlay(ovr *CompPatternDict) error {
+	errs := []error{}
+	for _, name := range sortedKeys(ovr.Patterns) {
+		optn := ovr.Patterns[name]
+		if len(optn.Name) == 0 {
+			optn.Name = name
+		}
+		base, present := cpd.Patterns[name]
+		if !present {
+			cpd.Patterns[name] = *optn.DeepCopy()
+			continue
+		}
+		if len(optn.CPType) > 0 && optn.CPType != base.CPType {
+			errs = append(errs, fmt.Errorf("overlay of comp pattern %s changes its cptype from %s to %s",
+				name, base.CPType, optn.CPType))
+			continue
+		}
+
+		merged := base.DeepCopy()
+		changed := false
+		for _, fnc := range optn.Funcs {
+			replaced := false
+			for idx := range merged.Funcs {
+				if merged.Funcs[idx].Label != fnc.Label {
+					continue
+				}
+				if len(fnc.Class) > 0 && fnc.Class != merged.Funcs[idx].Class {
+					errs = append(errs, fmt.Errorf("overlay of comp pattern %s changes the class of function %s from %s to %s",
+						name, fnc.Label, merged.Funcs[idx].Class, fnc.Class))
+					changed = true
+				}
+				replaced = true
+				break
+			}
+			if replaced {
+				continue
+			}
+			if len(fnc.Class) == 0 {
+				errs = append(errs, fmt.Errorf("overlay of comp pattern %s adds function %s without a class", name, fnc.Label))
+				changed = true
+				continue
+			}
+			merged.Funcs = append(merged.Funcs, Func{Class: fnc.Class, Label: fnc.Label})
+		}
+		if changed {
+			continue
+		}
+		for srvOp, srvDesc := range optn.Services {
+			merged.Services[srvOp] = srvDesc
+		}
+		for _, edge := range optn.Edges {
+			if !containsEdge(merged.Edges, edge) {
+				merged.Edges = append(merged.Edges, edge)
+			}
+		}
+		for _, xedge := range optn.ExtEdges {
+			if !containsXEdge(merged.ExtEdges, xedge) {
+				merged.ExtEdges = append(merged.ExtEdges, xedge)
+			}
+		}
+		cpd.Patterns[name] = *merged
+	}
+	return ReportErrs(errs)
+}
+
+// containsEdge is true if the edge is in the list
+func containsEdge(edges []CmpPtnGraphEdge, edge CmpPtnGraphEdge) bool {
+	for _, e := range edges {
+		if e == edge {
+			return true
+		}
+	}
+	return false
+}
+
+// containsXEdge is true if the external edge is in the list
+func containsXEdge(xedges []XCPEdge, xedge XCPEdge) bool {
+	for _, e := range xedges {
+		if e == xedge {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlay merges the initialization lists of ovr into the dictionary.  A list not already present is added.
+// Otherwise the cfgs of the overlay replace those of the base with the same function label (and others are added),
+// and its msgs replace those with the same message type.  An overlay may not change the CPType of a list, nor
+// how its serialized cfgs are interpreted
+func (cpild *CPInitListDict) Overlay(ovr *CPInitListDict) error {
+	errs := []error{}
+	for _, name := range sortedKeys(ovr.InitList) {
+		ocpil := ovr.InitList[name]
+		if len(ocpil.Name) == 0 {
+			ocpil.Name = name
+		}
+		base, present := cpild.InitList[name]
+		if !present {
+			cpild.InitList[name] = *ocpil.DeepCopy()
+			continue
+		}
+		if len(ocpil.CPType) > 0 && ocpil.CPType != base.CPType {
+			errs = append(errs, fmt.Errorf("overlay of initialization list %s changes its cptype from %s to %s",
+				name, base.CPType, ocpil.CPType))
+			continue
+		}
+		if ocpil.hasStringCfgs() && base.hasStringCfgs() && ocpil.UseYAML != base.UseYAML {
+			errs = append(errs, fmt.Errorf("overlay of initialization list %s serializes cfgs differently than its base", name))
+			continue
+		}
+
+		merged := base.DeepCopy()
+		for label, cfgStr := range ocpil.Cfg {
+			merged.Cfg[label] = cfgStr
+			if ocpil.NativeCfg[label] {
+				merged.NativeCfg[label] = true
+			} else {
+				delete(merged.NativeCfg, label)
+			}
+		}
+		for _, msg := range ocpil.Msgs {
+			replaced := false
+			for idx := range merged.Msgs {
+				if merged.Msgs[idx].MsgType == msg.MsgType {
+					merged.Msgs[idx] = msg
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				merged.Msgs = append(merged.Msgs, msg)
+			}
+		}
+		cpild.InitList[name] = *merged
+	}
+	return ReportErrs(errs)
+}
+
+// Overlay merges the timings of ovr into the list.  A timing of the overlay replaces the base timing
+// of the same operation identifier with the same param, CPU model, and packet length, and is otherwise added.
+// A timing model or derived CPU model of the overlay replaces that of the base for the same operation or CPU model
+func (fel *FuncExecList) Overlay(ovr *FuncExecList) error {
+	for _, model := range sortedKeys(ovr.Derived) {
+		if fel.Derived == nil {
+			fel.Derived = make(map[string]DerivedCPUModel)
+		}
+		fel.Derived[model] = ovr.Derived[model]
+	}
+	for _, op := range sortedKeys(ovr.Models) {
+		if fel.Models == nil {
+			fel.Models = make(map[string]TimingModelDesc)
+		}
+		fel.Models[op] = ovr.Models[op]
+	}
+	for _, op := range sortedKeys(ovr.Times) {
+		for _, fed := range ovr.Times[op] {
+			fed.Identifier = op
+			idx := findTiming(fel.Times[op], timingKey{fed.Param, fed.CPUModel, fed.PcktLen})
+			if idx < 0 {
+				fel.Times[op] = append(fel.Times[op], fed)
+			} else {
+				fel.Times[op][idx] = fed
+			}
+		}
+	}
+	return nil
+}
+
+// ReadCompPatternDictLayers reads a CompPatternDict from the first named file and applies
+// the others to it as overlays, in order
+func ReadCompPatternDictLayers(filenames []string) (*CompPatternDict, error) {
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no comp pattern dictionary file named")
+	}
+	cpd, err := ReadCompPatternDict(filenames[0], layerYAML(filenames[0]), []byte{})
+	if err != nil {
+		return nil, err
+	}
+	if cpd.Patterns == nil {
+		cpd.Patterns = make(map[string]CompPattern)
+	}
+	for _, filename := range filenames[1:] {
+		ovr, err := ReadCompPatternDict(filename, layerYAML(filename), []byte{})
+		if err == nil {
+			err = cpd.Overlay(ovr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("overlay %s: %s", filename, err.Error())
+		}
+	}
+	return cpd, nil
+}
+
+// ReadCPInitListDictLayers reads a CPInitListDict from the first named file and applies
+// the others to it as overlays, in order
+func ReadCPInitListDictLayers(filenames []string) (*CPInitListDict, error) {
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no initialization list dictionary file named")
+	}
+	cpild, err := ReadCPInitListDict(filenames[0], layerYAML(filenames[0]), []byte{})
+	if err != nil {
+		return nil, err
+	}
+	if cpild.InitList == nil {
+		cpild.InitList = make(map[string]CPInitList)
+	}
+	for _, filename := range filenames[1:] {
+		ovr, err := ReadCPInitListDict(filename, layerYAML(filename), []byte{})
+		if err == nil {
+			err = cpild.Overlay(ovr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("overlay %s: %s", filename, err.Error())
+		}
+	}
+	return cpild, nil
+}
+
+// ReadFuncExecListLayers reads a FuncExecList from the first named file and applies
+// the others to it as overlays, in order
+func ReadFuncExecListLayers(filenames []string) (*FuncExecList, error) {
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no function timing file named")
+	}
+	fel, err := ReadFuncExecList(filenames[0], layerYAML(filenames[0]), []byte{})
+	if err != nil {
+		return nil, err
+	}
+	if fel.Times == nil {
+		fel.Times = make(map[string][]FuncExecDesc)
+	}
+	for _, filename := range filenames[1:] {
+		ovr, err := ReadFuncExecList(filename, layerYAML(filename), []byte{})
+		if err == nil {
+			err = fel.Overlay(ovr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("overlay %s: %s", filename, err.Error())
+		}
+	}
+	return fel, nil
+}
+
+// layerYAML is true if the file's extension marks it as yaml
+func layerYAML(filename string) bool {
+	ext := path.Ext(filename)
+	return (ext == ".yaml") || (ext == ".yml")
+}
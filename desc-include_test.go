@@ -0,0 +1,164 @@
+package pces
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludeCycle(t *testing.T) {
+	tests := []struct {
+		name     string
+		includes map[string][]string
+	}{
+		{"file including itself", map[string][]string{"a.yaml": {"a.yaml"}}},
+		{"two files including each other", map[string][]string{"a.yaml": {"b.yaml"}, "b.yaml": {"a.yaml"}}},
+		{"cycle below the top file", map[string][]string{"a.yaml": {"b.yaml"}, "b.yaml": {"c.yaml"}, "c.yaml": {"b.yaml"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for filename, includes := range tc.includes {
+				cpd := CreateCompPatternDict(filename)
+				cpd.Include = includes
+				err := cpd.WriteToFile(filepath.Join(dir, filename))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := ReadCompPatternDict(filepath.Join(dir, "a.yaml"), true, nil)
+			if err == nil || !strings.Contains(err.Error(), "include cycle") {
+				t.Errorf("ReadCompPatternDict error = %v, want an include cycle", err)
+			}
+		})
+	}
+}
+
+func TestIncludeConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(cpd *CompPatternDict, fel *FuncExecList)
+		crypts int
+		errStr string
+	}{
+		{name: "included entries identical", setup: func(cpd *CompPatternDict, fel *FuncExecList) {}, crypts: 2},
+		{
+			name: "included entries new",
+			setup: func(cpd *CompPatternDict, fel *FuncExecList) {
+				cpt := cpd.Patterns["chain1"]
+				cpt.Name = "chain2"
+				cpd.Patterns = map[string]CompPattern{"chain2": *cpt.DeepCopy()}
+				fel.Times = map[string][]FuncExecDesc{}
+				fel.AddTiming("crypt", "", "x86", 2000, 2.0e-3)
+			},
+			crypts: 3,
+		},
+		{
+			name: "pattern defined differently",
+			setup: func(cpd *CompPatternDict, fel *FuncExecList) {
+				cpd.Patterns["chain1"].Funcs[1].Class = "transfer"
+			},
+			errStr: "comp pattern chain1 is defined differently",
+		},
+		{
+			name: "timing given differently",
+			setup: func(cpd *CompPatternDict, fel *FuncExecList) {
+				fel.Times["crypt"][0].ExecTime = 5.0e-3
+			},
+			errStr: `timing of op crypt on CPU model x86, param "", packet length 1000 is given differently`,
+		},
+		{
+			name: "timing with a different distribution",
+			setup: func(cpd *CompPatternDict, fel *FuncExecList) {
+				fel.Times["crypt"][0].Dist = &ExecTimeDist{Kind: "normal", StdDev: 1.0e-4}
+			},
+			errStr: `timing of op crypt on CPU model x86, param "", packet length 1000 is given differently`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cpd, _, fel, _ := testModel(t)
+			incCPD, _, incFEL, _ := testModel(t)
+			tc.setup(incCPD, incFEL)
+			cpd.Include = []string{"inc-cp.yaml"}
+			fel.Include = []string{"inc-exec.yaml"}
+			for filename, writer := range map[string]interface{ WriteToFile(string) error }{
+				"cp.yaml": cpd, "inc-cp.yaml": incCPD, "exec.yaml": fel, "inc-exec.yaml": incFEL} {
+				err := writer.WriteToFile(filepath.Join(dir, filename))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, cpErr := ReadCompPatternDict(filepath.Join(dir, "cp.yaml"), true, nil)
+			readFEL, felErr := ReadFuncExecList(filepath.Join(dir, "exec.yaml"), true, nil)
+			err := ReportErrs([]error{cpErr, felErr})
+			if len(tc.errStr) == 0 {
+				if err != nil {
+					t.Fatalf("reading with includes: %v", err)
+				}
+				if len(readFEL.Times["crypt"]) != tc.crypts {
+					t.Errorf("crypt has %d timings after the include, want %d", len(readFEL.Times["crypt"]), tc.crypts)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+				t.Errorf("reading with includes gave error %v, want one containing %q", err, tc.errStr)
+			}
+		})
+	}
+}
+
+func TestCompPatternDictOverlay(t *testing.T) {
+	tests := []struct {
+		name   string
+		funcs  []Func
+		errStr string
+		class  map[string]string
+	}{
+		{name: "function class left empty", funcs: []Func{{Label: "proc"}},
+			class: map[string]string{"proc": "processPckt"}},
+		{name: "function class restated", funcs: []Func{{Class: "processPckt", Label: "proc"}},
+			class: map[string]string{"proc": "processPckt"}},
+		{name: "function added", funcs: []Func{{Class: "processPckt", Label: "tap"}},
+			class: map[string]string{"proc": "processPckt", "tap": "processPckt"}},
+		{name: "function class changed", funcs: []Func{{Class: "transfer", Label: "proc"}},
+			errStr: "overlay of comp pattern chain1 changes the class of function proc from processPckt to transfer"},
+		{name: "function added without a class", funcs: []Func{{Label: "tap"}},
+			errStr: "overlay of comp pattern chain1 adds function tap without a class"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpd, _, _, _ := testModel(t)
+			ovr := CreateCompPatternDict("overlay")
+			ovr.Patterns["chain1"] = CompPattern{Funcs: tc.funcs}
+			err := cpd.Overlay(ovr)
+			if len(tc.errStr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+					t.Errorf("Overlay error = %v, want one containing %q", err, tc.errStr)
+				}
+				if cpd.Patterns["chain1"].Funcs[1].Class != "processPckt" || len(cpd.Patterns["chain1"].Funcs) != 4 {
+					t.Errorf("rejected overlay changed the pattern: %v", cpd.Patterns["chain1"].Funcs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Overlay: %v", err)
+			}
+			for _, fnc := range cpd.Patterns["chain1"].Funcs {
+				class, present := tc.class[fnc.Label]
+				if present && fnc.Class != class {
+					t.Errorf("function %s has class %s after the overlay, want %s", fnc.Label, fnc.Class, class)
+				}
+				delete(tc.class, fnc.Label)
+			}
+			if len(tc.class) > 0 {
+				t.Errorf("functions %v missing after the overlay", tc.class)
+			}
+		})
+	}
+}
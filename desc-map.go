@@ -114,6 +114,8 @@ func ReadCompPatternMap(filename string, useYAML bool, dict []byte) (*CompPatter
 // A CompPatternMapDict holds copies of CompPatternMap structs in a map that is
 // indexed by the PatternName of resident CompPatternMaps
 type CompPatternMapDict struct {
+	// Version is the format version of the file, see ModelFormatVersion
+	Version  int                       `json:"version,omitempty" yaml:"version,omitempty"`
 	DictName string                    `json:"dictname" yaml:"dictname"`
 	Map      map[string]CompPatternMap `json:"map" yaml:"map"`
 }
@@ -122,6 +124,7 @@ type CompPatternMapDict struct {
 // Saves the dictionary name and initializes the map of CompPatternMaps to-be-stored.
 func CreateCompPatternMapDict(name string) *CompPatternMapDict {
 	cpmd := new(CompPatternMapDict)
+	cpmd.Version = ModelFormatVersion
 	cpmd.DictName = name
 	cpmd.Map = make(map[string]CompPatternMap)
 
@@ -178,6 +181,10 @@ func ReadCompPatternMapDict(filename string, useYAML bool, dict []byte) (*CompPa
 		return nil, err
 	}
 
+	err = checkFormatVersion("comp pattern map dictionary", filename, example.Version)
+	if err != nil {
+		return nil, err
+	}
 	return &example, nil
 }
 
@@ -0,0 +1,145 @@
+package pces
+
+// file desc-placement.go holds structs and methods used to describe the
+// constraints and objective given to the function-to-host placement optimizer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+)
+
+// A PlacementSpec describes what the placement optimizer is to achieve and
+// the constraints it must respect.  Functions are named by their global name, "ptnName:label".
+//
+//	Objective     - "latency" to minimize the estimated execution plus communication time,
+//	                "balance" to minimize the largest load on any host
+//	Hosts         - candidate hosts.  Empty means every endpoint in the topology
+//	Capacity      - relative capacity of a host.  Hosts not named have capacity equal to their core count
+//	Pin           - functions that must be placed on the given host
+//	Colocate      - groups of functions that must all be placed on the same host
+//	Affinity      - groups of functions that should be placed on the same host when possible
+//	AntiAffinity  - groups of functions that must all be placed on different hosts
+//	PcktLen       - packet length used to estimate execution times.  Zero uses the smallest length measured
+//	CommCost      - time (seconds) charged for each edge whose end points are on different hosts
+//	Priority      - scheduling priority written into the map for every function
+//	MaxIters      - limit on the number of improvement passes of the local search
+type PlacementSpec struct {
+	Name         string             `json:"name" yaml:"name"`
+	Objective    string             `json:"objective" yaml:"objective"`
+	Hosts        []string           `json:"hosts" yaml:"hosts"`
+	Capacity     map[string]float64 `json:"capacity" yaml:"capacity"`
+	Pin          map[string]string  `json:"pin" yaml:"pin"`
+	Colocate     [][]string         `json:"colocate" yaml:"colocate"`
+	Affinity     [][]string         `json:"affinity" yaml:"affinity"`
+	AntiAffinity [][]string         `json:"antiaffinity" yaml:"antiaffinity"`
+	PcktLen      int                `json:"pcktlen" yaml:"pcktlen"`
+	CommCost     float64            `json:"commcost" yaml:"commcost"`
+	Priority     int                `json:"priority" yaml:"priority"`
+	MaxIters     int                `json:"maxiters" yaml:"maxiters"`
+}
+
+// CreatePlacementSpec is a constructor.  The spec it returns has no constraints,
+// and charges 100 microseconds for each message that crosses between hosts
+func CreatePlacementSpec(name, objective string) *PlacementSpec {
+	ps := new(PlacementSpec)
+	ps.Name = name
+	ps.Objective = objective
+	ps.Hosts = make([]string, 0)
+	ps.Capacity = make(map[string]float64)
+	ps.Pin = make(map[string]string)
+	ps.Colocate = make([][]string, 0)
+	ps.Affinity = make([][]string, 0)
+	ps.AntiAffinity = make([][]string, 0)
+	ps.CommCost = 100e-6
+	ps.Priority = 1
+	ps.MaxIters = 100
+	return ps
+}
+
+// AddPin requires the named function to be placed on the named host
+func (ps *PlacementSpec) AddPin(funcName, host string) {
+	ps.Pin[funcName] = host
+}
+
+// AddColocate requires the named functions to be placed on the same host
+func (ps *PlacementSpec) AddColocate(funcNames []string) {
+	ps.Colocate = append(ps.Colocate, funcNames)
+}
+
+// AddAffinity asks that the named functions be placed on the same host when possible
+func (ps *PlacementSpec) AddAffinity(funcNames []string) {
+	ps.Affinity = append(ps.Affinity, funcNames)
+}
+
+// AddAntiAffinity requires the named functions to be placed on different hosts
+func (ps *PlacementSpec) AddAntiAffinity(funcNames []string) {
+	ps.AntiAffinity = append(ps.AntiAffinity, funcNames)
+}
+
+// ReadPlacementSpec deserializes a slice of bytes into a PlacementSpec.  Bytes are either provided, or are
+// read from a file whose name is given.
+func ReadPlacementSpec(filename string, useYAML bool, dict []byte) (*PlacementSpec, error) {
+	var err error
+
+	// empty slice of bytes means we get those bytes from the named file
+	if len(dict) == 0 {
+		// validate input file name
+		fileInfo, err := os.Stat(filename)
+		if os.IsNotExist(err) || fileInfo.IsDir() {
+			msg := fmt.Sprintf("placement spec %s does not exist or cannot be read", filename)
+			fmt.Println(msg)
+			return nil, errors.New(msg)
+		}
+		dict, err = os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// fields the bytes leave out keep the constructor's defaults
+	example := *CreatePlacementSpec("", "")
+
+	if useYAML {
+		err = yaml.Unmarshal(dict, &example)
+	} else {
+		err = json.Unmarshal(dict, &example)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &example, nil
+}
+
+// WriteToFile serializes the PlacementSpec and writes it to a file.  Output file
+// extension identifies whether serialization is to json or to yaml
+func (ps *PlacementSpec) WriteToFile(filename string) error {
+	pathExt := path.Ext(filename)
+	var bytes []byte
+	var merr error = nil
+
+	if pathExt == ".yaml" || pathExt == ".YAML" || pathExt == ".yml" {
+		bytes, merr = yaml.Marshal(*ps)
+	} else if pathExt == ".json" || pathExt == ".JSON" {
+		bytes, merr = json.MarshalIndent(*ps, "", "\t")
+	}
+
+	if merr != nil {
+		panic(merr)
+	}
+
+	f, cerr := os.Create(filename)
+	if cerr != nil {
+		panic(cerr)
+	}
+	_, werr := f.WriteString(string(bytes[:]))
+	if werr != nil {
+		panic(werr)
+	}
+	f.Close()
+	return werr
+}
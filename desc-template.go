@@ -0,0 +1,376 @@
+package pces
+
+// file desc-template.go holds structs and methods that describe comp pattern templates,
+// patterns declared once with parameters, and the instances that bind those parameters.
+// Expanding a TemplateDict adds one entry per instance to the CompPatternDict, CPInitListDict,
+// and CompPatternMapDict of an experiment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A CompPatternTemplate is a CompPattern, its CPInitList, and its CompPatternMap, any of whose strings
+// may hold parameter references written ${param}.  Two parameters are always bound: ${name}, the
+// name of the instance, and ${index}, the instance's position in a counted declaration.
+type CompPatternTemplate struct {
+	// CPType identifies the template, and becomes the CPType of every instance
+	CPType string `json:"cptype" yaml:"cptype"`
+
+	// Params lists the parameters an instance may bind
+	Params []string `json:"params" yaml:"params"`
+
+	// Defaults holds values for parameters an instance does not bind
+	Defaults map[string]string `json:"defaults" yaml:"defaults"`
+
+	Pattern CompPattern    `json:"pattern" yaml:"pattern"`
+	Init    CPInitList     `json:"init" yaml:"init"`
+	Map     CompPatternMap `json:"map" yaml:"map"`
+}
+
+// CreateCompPatternTemplate is a constructor.  It builds a template from a pattern, its
+// initialization list, and its map, which typically hold parameter references
+func CreateCompPatternTemplate(cpt *CompPattern, cpil *CPInitList, cpm *CompPatternMap, params []string) *CompPatternTemplate {
+	cptt := new(CompPatternTemplate)
+	cptt.CPType = cpt.CPType
+	cptt.Params = make([]string, len(params))
+	copy(cptt.Params, params)
+	cptt.Defaults = make(map[string]string)
+	cptt.Pattern = *cpt.DeepCopy()
+	cptt.Init = *cpil.DeepCopy()
+	cptt.Map = *CreateCompPatternMap(cpm.PatternName)
+	for label, hostPri := range cpm.FuncMap {
+		cptt.Map.FuncMap[label] = hostPri
+	}
+	return cptt
+}
+
+// SetDefault gives a value to a parameter that instances do not bind
+func (cptt *CompPatternTemplate) SetDefault(param, value string) {
+	cptt.Defaults[param] = value
+}
+
+// A TemplateInstance declares one instance of a template, or with Count greater than one,
+// Count instances whose ${index} runs from 0 to Count-1.  The Name of a counted declaration
+// must reference ${index} so that the instance names differ.  Bound values may themselves reference ${index}
+type TemplateInstance struct {
+	Template string            `json:"template" yaml:"template"`
+	Name     string            `json:"name" yaml:"name"`
+	Count    int               `json:"count" yaml:"count"`
+	Params   map[string]string `json:"params" yaml:"params"`
+}
+
+// TemplateDict holds templates, indexed by CPType, and the instances to be made of them
+type TemplateDict struct {
+	DictName  string                         `json:"dictname" yaml:"dictname"`
+	Templates map[string]CompPatternTemplate `json:"templates" yaml:"templates"`
+	Instances []TemplateInstance             `json:"instances" yaml:"instances"`
+}
+
+// CreateTemplateDict is a constructor
+func CreateTemplateDict(name string) *TemplateDict {
+	td := new(TemplateDict)
+	td.DictName = name
+	td.Templates = make(map[string]CompPatternTemplate)
+	td.Instances = make([]TemplateInstance, 0)
+	return td
+}
+
+// AddTemplate includes a template in the dictionary
+func (td *TemplateDict) AddTemplate(cptt *CompPatternTemplate) error {
+	_, present := td.Templates[cptt.CPType]
+	if present {
+		return fmt.Errorf("attempt to overwrite template %s", cptt.CPType)
+	}
+	td.Templates[cptt.CPType] = *cptt
+	return nil
+}
+
+// AddInstance declares count instances of the named template, with the given parameter bindings
+func (td *TemplateDict) AddInstance(template, name string, count int, params map[string]string) {
+	ti := TemplateInstance{Template: template, Name: name, Count: count, Params: make(map[string]string)}
+	for key, value := range params {
+		ti.Params[key] = value
+	}
+	td.Instances = append(td.Instances, ti)
+}
+
+// paramRef matches a parameter reference
+var paramRef *regexp.Regexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substParams replaces the parameter references in str that have bindings.
+// References without bindings are left in place
+func substParams(str string, binding map[string]string) string {
+	return paramRef.ReplaceAllStringFunc(str, func(ref string) string {
+		value, present := binding[ref[2:len(ref)-1]]
+		if !present {
+			return ref
+		}
+		return value
+	})
+}
+
+// Expand adds to cpd, cpid, and cpmd the pattern, initialization list, and map of every instance
+// declared in the dictionary.  Every parameter of a template must be bound by the instance or by a default,
+// an instance may bind only parameters the template declares, no parameter reference may remain after
+// substitution, and instance names must differ from each other and from patterns already in cpd.
+// All problems found are reported together, in which case nothing is added
+func (td *TemplateDict) Expand(cpd *CompPatternDict, cpid *CPInitListDict, cpmd *CompPatternMapDict) error {
+	errs := []error{}
+	expanded := make([]*CompPattern, 0)
+	inits := make([]*CPInitList, 0)
+	maps := make([]*CompPatternMap, 0)
+	names := make(map[string]bool)
+
+	for _, ti := range td.Instances {
+		cptt, present := td.Templates[ti.Template]
+		if !present {
+			errs = append(errs, fmt.Errorf("instance %s names unknown template %s", ti.Name, ti.Template))
+			continue
+		}
+
+		declared := make(map[string]bool)
+		for _, param := range cptt.Params {
+			declared[param] = true
+		}
+		bound := []string{}
+		for param := range ti.Params {
+			bound = append(bound, param)
+		}
+		sort.Strings(bound)
+		for _, param := range bound {
+			if !declared[param] {
+				errs = append(errs, fmt.Errorf("instance %s binds parameter %s, which template %s does not declare",
+					ti.Name, param, ti.Template))
+			}
+		}
+		for _, param := range cptt.Params {
+			_, isBound := ti.Params[param]
+			_, hasDefault := cptt.Defaults[param]
+			if !isBound && !hasDefault {
+				errs = append(errs, fmt.Errorf("instance %s leaves parameter %s of template %s unbound",
+					ti.Name, param, ti.Template))
+			}
+		}
+
+		count := ti.Count
+		if count <= 1 {
+			count = 1
+		} else if !strings.Contains(ti.Name, "${index}") {
+			errs = append(errs, fmt.Errorf("instance %s declares %d copies but its name does not reference ${index}",
+				ti.Name, count))
+			continue
+		}
+
+		for index := 0; index < count; index++ {
+			idxBinding := map[string]string{"index": strconv.Itoa(index)}
+			name := substParams(ti.Name, idxBinding)
+
+			if len(name) == 0 {
+				errs = append(errs, fmt.Errorf("instance of template %s has no name", ti.Template))
+				continue
+			}
+			_, exists := cpd.Patterns[name]
+			if exists || names[name] {
+				errs = append(errs, fmt.Errorf("instance name %s is not unique", name))
+				continue
+			}
+			names[name] = true
+
+			binding := make(map[string]string)
+			for param, value := range cptt.Defaults {
+				binding[param] = substParams(value, idxBinding)
+			}
+			for param, value := range ti.Params {
+				binding[param] = substParams(value, idxBinding)
+			}
+			binding["name"] = name
+			binding["index"] = idxBinding["index"]
+
+			cpt, cpil, cpm := cptt.instantiate(name, binding)
+			unbound := cptt.unboundRefs(cpt, cpil, cpm)
+			for _, ref := range unbound {
+				errs = append(errs, fmt.Errorf("instance %s of template %s leaves reference %s unbound",
+					name, ti.Template, ref))
+			}
+			expanded = append(expanded, cpt)
+			inits = append(inits, cpil)
+			maps = append(maps, cpm)
+		}
+	}
+
+	err := ReportErrs(errs)
+	if err != nil {
+		return err
+	}
+
+	for idx := range expanded {
+		errs = append(errs, cpd.AddCompPattern(expanded[idx]))
+		errs = append(errs, cpid.AddCPInitList(inits[idx]))
+		errs = append(errs, cpmd.AddCompPatternMap(maps[idx], false))
+	}
+	return ReportErrs(errs)
+}
+
+// instantiate applies a binding to copies of the template's pattern, initialization list, and map
+func (cptt *CompPatternTemplate) instantiate(name string, binding map[string]string) (*CompPattern, *CPInitList, *CompPatternMap) {
+	sub := func(str string) string {
+		return substParams(str, binding)
+	}
+
+	cpt := cptt.Pattern.DeepCopy()
+	cpt.CPType = cptt.CPType
+	cpt.Name = name
+	for idx := range cpt.Funcs {
+		cpt.Funcs[idx].Label = sub(cpt.Funcs[idx].Label)
+	}
+	services := make(map[string]funcDesc)
+	for srvOp, srvDesc := range cpt.Services {
+		services[sub(srvOp)] = funcDesc{CP: sub(srvDesc.CP), Label: sub(srvDesc.Label)}
+	}
+	cpt.Services = services
+	for idx, edge := range cpt.Edges {
+		cpt.Edges[idx] = CmpPtnGraphEdge{SrcLabel: sub(edge.SrcLabel), MsgType: sub(edge.MsgType), DstLabel: sub(edge.DstLabel)}
+	}
+	for idx, xedge := range cpt.ExtEdges {
+		cpt.ExtEdges[idx] = XCPEdge{SrcCP: sub(xedge.SrcCP), DstCP: sub(xedge.DstCP), SrcLabel: sub(xedge.SrcLabel),
+			DstLabel: sub(xedge.DstLabel), MsgType: sub(xedge.MsgType)}
+	}
+
+	cpil := cptt.Init.DeepCopy()
+	cpil.Name = name
+	cpil.CPType = cptt.CPType
+	cfg := make(map[string]string)
+	for label, cfgStr := range cpil.Cfg {
+		cfg[sub(label)] = sub(cfgStr)
+	}
+	cpil.Cfg = cfg
+	native := make(map[string]bool)
+	for label := range cpil.NativeCfg {
+		native[sub(label)] = true
+	}
+	cpil.NativeCfg = native
+	for idx := range cpil.Msgs {
+		cpil.Msgs[idx].MsgType = sub(cpil.Msgs[idx].MsgType)
+	}
+
+	cpm := CreateCompPatternMap(name)
+	for label, hostPri := range cptt.Map.FuncMap {
+		cpm.FuncMap[sub(label)] = sub(hostPri)
+	}
+	return cpt, cpil, cpm
+}
+
+// unboundRefs returns the parameter references remaining in an instantiated pattern,
+// initialization list, and map, sorted and without duplicates
+func (cptt *CompPatternTemplate) unboundRefs(cpt *CompPattern, cpil *CPInitList, cpm *CompPatternMap) []string {
+	found := make(map[string]bool)
+	look := func(str string) {
+		for _, ref := range paramRef.FindAllString(str, -1) {
+			found[ref] = true
+		}
+	}
+	for _, fnc := range cpt.Funcs {
+		look(fnc.Label)
+	}
+	for srvOp, srvDesc := range cpt.Services {
+		look(srvOp)
+		look(srvDesc.CP)
+		look(srvDesc.Label)
+	}
+	for _, edge := range cpt.Edges {
+		look(edge.SrcLabel + edge.MsgType + edge.DstLabel)
+	}
+	for _, xedge := range cpt.ExtEdges {
+		look(xedge.SrcCP + xedge.DstCP + xedge.SrcLabel + xedge.DstLabel + xedge.MsgType)
+	}
+	for label, cfgStr := range cpil.Cfg {
+		look(label)
+		look(cfgStr)
+	}
+	for _, msg := range cpil.Msgs {
+		look(msg.MsgType)
+	}
+	for label, hostPri := range cpm.FuncMap {
+		look(label)
+		look(hostPri)
+	}
+
+	refs := make([]string, 0, len(found))
+	for ref := range found {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// ReadTemplateDict deserializes a slice of bytes into a TemplateDict.  Bytes are either provided, or are
+// read from a file whose name is given.
+func ReadTemplateDict(filename string, useYAML bool, dict []byte) (*TemplateDict, error) {
+	var err error
+
+	// empty slice of bytes means we get those bytes from the named file
+	if len(dict) == 0 {
+		// validate input file name
+		fileInfo, err := os.Stat(filename)
+		if os.IsNotExist(err) || fileInfo.IsDir() {
+			msg := fmt.Sprintf("template dictionary %s does not exist or cannot be read", filename)
+			fmt.Println(msg)
+			return nil, errors.New(msg)
+		}
+		dict, err = os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	example := TemplateDict{}
+
+	if useYAML {
+		err = yaml.Unmarshal(dict, &example)
+	} else {
+		err = json.Unmarshal(dict, &example)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &example, nil
+}
+
+// WriteToFile serializes the TemplateDict and writes it to a file.  Output file
+// extension identifies whether serialization is to json or to yaml
+func (td *TemplateDict) WriteToFile(filename string) error {
+	pathExt := path.Ext(filename)
+	var bytes []byte
+	var merr error = nil
+
+	if pathExt == ".yaml" || pathExt == ".YAML" || pathExt == ".yml" {
+		bytes, merr = yaml.Marshal(*td)
+	} else if pathExt == ".json" || pathExt == ".JSON" {
+		bytes, merr = json.MarshalIndent(*td, "", "\t")
+	}
+
+	if merr != nil {
+		panic(merr)
+	}
+
+	f, cerr := os.Create(filename)
+	if cerr != nil {
+		panic(cerr)
+	}
+	_, werr := f.WriteString(string(bytes[:]))
+	if werr != nil {
+		panic(werr)
+	}
+	f.Close()
+	return werr
+}
@@ -0,0 +1,134 @@
+package pces
+
+import (
+	"strings"
+	"testing"
+)
+
+// testTemplateDict returns a dictionary holding one template, "chain", made from the pattern of
+// testModel with proc's op and host left as the parameters op and host, host defaulting to hostA
+func testTemplateDict(t *testing.T) *TemplateDict {
+	t.Helper()
+	cpd, cpid, _, cpmd := testModel(t)
+	cpt, cpil, cpm := cpd.Patterns["chain1"], cpid.InitList["chain1"], cpmd.Map["chain1"]
+	cpil.Cfg["proc"] = "timingcode: {req: ${op}}"
+	cptt := CreateCompPatternTemplate(&cpt, &cpil, &cpm, []string{"op", "host"})
+	cptt.Map.FuncMap["proc"] = "${host},1"
+	cptt.SetDefault("host", "hostA")
+
+	td := CreateTemplateDict("templates")
+	err := td.AddTemplate(cptt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return td
+}
+
+func TestTemplateExpand(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(td *TemplateDict)
+		errStr []string
+	}{
+		{
+			name:  "parameters bound and defaulted",
+			setup: func(td *TemplateDict) { td.AddInstance("chain", "c${index}", 2, map[string]string{"op": "crypt"}) },
+		},
+		{
+			name:   "unknown template",
+			setup:  func(td *TemplateDict) { td.AddInstance("ring", "r", 1, nil) },
+			errStr: []string{"instance r names unknown template ring"},
+		},
+		{
+			name:   "parameter left unbound",
+			setup:  func(td *TemplateDict) { td.AddInstance("chain", "c", 1, nil) },
+			errStr: []string{"instance c leaves parameter op of template chain unbound"},
+		},
+		{
+			name: "parameter the template does not declare",
+			setup: func(td *TemplateDict) {
+				td.AddInstance("chain", "c", 1, map[string]string{"op": "crypt", "mode": "fast"})
+			},
+			errStr: []string{"instance c binds parameter mode, which template chain does not declare"},
+		},
+		{
+			name: "reference to a parameter the template does not declare",
+			setup: func(td *TemplateDict) {
+				cptt := td.Templates["chain"]
+				cptt.Init.Cfg["hash"] = "timingcode: {req: ${hashop}}"
+				td.AddInstance("chain", "c", 1, map[string]string{"op": "crypt"})
+			},
+			errStr: []string{"instance c of template chain leaves reference ${hashop} unbound"},
+		},
+		{
+			name: "reference in a bound value",
+			setup: func(td *TemplateDict) {
+				td.AddInstance("chain", "c", 1, map[string]string{"op": "${cipher}"})
+			},
+			errStr: []string{"instance c of template chain leaves reference ${cipher} unbound"},
+		},
+		{
+			name:   "counted name without an index",
+			setup:  func(td *TemplateDict) { td.AddInstance("chain", "c", 3, map[string]string{"op": "crypt"}) },
+			errStr: []string{"instance c declares 3 copies but its name does not reference ${index}"},
+		},
+		{
+			name: "names not unique",
+			setup: func(td *TemplateDict) {
+				td.AddInstance("chain", "c1", 1, map[string]string{"op": "crypt"})
+				td.AddInstance("chain", "c${index}", 2, map[string]string{"op": "crypt"})
+			},
+			errStr: []string{"instance name c1 is not unique"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			td := testTemplateDict(t)
+			tc.setup(td)
+			cpd, cpid, cpmd := CreateCompPatternDict("cpd"), CreateCPInitListDict("cpid"), CreateCompPatternMapDict("cpmd")
+			err := td.Expand(cpd, cpid, cpmd)
+			if len(tc.errStr) == 0 {
+				if err != nil {
+					t.Fatalf("Expand: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expand gave no error, want %q", tc.errStr)
+			}
+			for _, errStr := range tc.errStr {
+				if !strings.Contains(err.Error(), errStr) {
+					t.Errorf("Expand error = %v, want one containing %q", err, errStr)
+				}
+			}
+			if len(cpd.Patterns) != 0 || len(cpid.InitList) != 0 || len(cpmd.Map) != 0 {
+				t.Errorf("Expand added instances despite errors")
+			}
+		})
+	}
+}
+
+func TestTemplateInstance(t *testing.T) {
+	td := testTemplateDict(t)
+	td.AddInstance("chain", "c${index}", 2, map[string]string{"op": "crypt-${index}", "host": "hostB"})
+	cpd, cpid, cpmd := CreateCompPatternDict("cpd"), CreateCPInitListDict("cpid"), CreateCompPatternMapDict("cpmd")
+	err := td.Expand(cpd, cpid, cpmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"c0", "c1"} {
+		cpt, present := cpd.Patterns[name]
+		if !present || cpt.Name != name || cpt.CPType != "chain" {
+			t.Errorf("pattern %s = %+v, present %v", name, cpt, present)
+		}
+		idx := name[1:]
+		if cfg := cpid.InitList[name].Cfg["proc"]; cfg != "timingcode: {req: crypt-"+idx+"}" {
+			t.Errorf("%s:proc cfg = %q", name, cfg)
+		}
+		if hostPri := cpmd.Map[name].FuncMap["proc"]; hostPri != "hostB,1" {
+			t.Errorf("%s:proc mapped to %q, want hostB,1", name, hostPri)
+		}
+	}
+}
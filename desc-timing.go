@@ -6,9 +6,12 @@ package pces
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"gopkg.in/yaml.v3"
 	"os"
 	"path"
+	"strings"
 )
 
 // A FuncExecDesc struct holds a description of a function timing.
@@ -18,30 +21,140 @@ import (
 //	 Param - additional information, e.g., key length for crypto
 //		CPUModel - the CPU,
 //		PcktLen  - number of bytes in data packet being operated on
+//
+// Dist optionally describes the variation of the time about ExecTime, its mean.  When
+// ExecTime is zero and Dist holds samples or a histogram, their mean is taken as ExecTime
 type FuncExecDesc struct {
-	Identifier string  `json:"identifier" yaml:"identifier"`
-	Param      string  `json:"param" yaml:"param"`
-	CPUModel   string  `json:"cpumodel" yaml:"cpumodel"`
-	PcktLen    int     `json:"pcktlen" yaml:"pcktlen"`
-	ExecTime   float64 `json:"exectime" yaml:"exectime"`
+	Identifier string        `json:"identifier" yaml:"identifier"`
+	Param      string        `json:"param" yaml:"param"`
+	CPUModel   string        `json:"cpumodel" yaml:"cpumodel"`
+	PcktLen    int           `json:"pcktlen" yaml:"pcktlen"`
+	ExecTime   float64       `json:"exectime" yaml:"exectime"`
+	Dist       *ExecTimeDist `json:"dist,omitempty" yaml:"dist,omitempty"`
+}
+
+// ExecTimeDistKinds lists the kinds of execution time distribution
+var ExecTimeDistKinds []string = []string{"normal", "lognormal", "empirical", "histogram"}
+
+// An ExecTimeDist describes the distribution from which execution times are drawn when
+// the simulation is run with stochastic execution times.
+//
+//	Kind    - one of normal, lognormal, empirical, histogram
+//	StdDev  - for normal and lognormal, the standard deviation of the time (seconds)
+//	Samples - for empirical, measured times, each drawn with equal probability
+//	Edges   - for histogram, the boundaries of the bins, one more than there are Counts
+//	Counts  - for histogram, the weight of each bin, a time being drawn uniformly within its bin
+//
+// Normal draws below zero are taken as zero
+type ExecTimeDist struct {
+	Kind    string    `json:"kind" yaml:"kind"`
+	StdDev  float64   `json:"stddev,omitempty" yaml:"stddev,omitempty"`
+	Samples []float64 `json:"samples,omitempty" yaml:"samples,omitempty"`
+	Edges   []float64 `json:"edges,omitempty" yaml:"edges,omitempty"`
+	Counts  []float64 `json:"counts,omitempty" yaml:"counts,omitempty"`
+}
+
+// mean returns the mean of the samples or histogram of the distribution, zero for the parameterized kinds
+func (etd *ExecTimeDist) mean() float64 {
+	switch etd.Kind {
+	case "empirical":
+		sum := 0.0
+		for _, sample := range etd.Samples {
+			sum += sample
+		}
+		return sum / float64(len(etd.Samples))
+	case "histogram":
+		sum, weight := 0.0, 0.0
+		for idx, count := range etd.Counts {
+			sum += count * (etd.Edges[idx] + etd.Edges[idx+1]) / 2.0
+			weight += count
+		}
+		return sum / weight
+	}
+	return 0.0
+}
+
+// validate returns an error describing the first problem found with the distribution
+func (etd *ExecTimeDist) validate() error {
+	switch etd.Kind {
+	case "normal", "lognormal":
+		if etd.StdDev < 0.0 {
+			return fmt.Errorf("%s distribution has negative stddev", etd.Kind)
+		}
+	case "empirical":
+		if len(etd.Samples) == 0 {
+			return errors.New("empirical distribution has no samples")
+		}
+		for _, sample := range etd.Samples {
+			if sample < 0.0 {
+				return errors.New("empirical distribution has a negative sample")
+			}
+		}
+	case "histogram":
+		if len(etd.Counts) == 0 || len(etd.Edges) != len(etd.Counts)+1 {
+			return errors.New("histogram distribution needs one more edge than it has counts")
+		}
+		total := 0.0
+		for idx, count := range etd.Counts {
+			if count < 0.0 {
+				return errors.New("histogram distribution has a negative count")
+			}
+			if etd.Edges[idx] < 0.0 || etd.Edges[idx+1] < etd.Edges[idx] {
+				return errors.New("histogram distribution edges must be non-negative and increasing")
+			}
+			total += count
+		}
+		if total == 0.0 {
+			return errors.New("histogram distribution has no weight")
+		}
+	default:
+		return fmt.Errorf("distribution kind %s is not one of %s", etd.Kind, strings.Join(ExecTimeDistKinds, ", "))
+	}
+	return nil
 }
 
 // A FuncExecList holds a map (Times) whose key is the class
 // of a Func, and whose value is a list of FuncExecDescs
 // associated with all Funcs of that class
 type FuncExecList struct {
+	// Version is the format version of the file, see ModelFormatVersion
+	Version int `json:"version,omitempty" yaml:"version,omitempty"`
+
 	// ListName is an identifier for this collection of timings
 	ListName string `json:"listname" yaml:"listname"`
 
 	// Times key is an identifier for the function.
 	// Value is list of function times for that type of function
 	Times map[string][]FuncExecDesc `json:"times" yaml:"times"`
+
+	// Models selects, by operation identifier, the timing model that estimates execution times
+	// for packet lengths between and beyond those measured.  Operations not named use piecewise
+	// linear interpolation
+	Models map[string]TimingModelDesc `json:"models,omitempty" yaml:"models,omitempty"`
+
+	// Derived declares CPU models, by name, whose timings are derived from those of a reference model
+	// for operations that have no timings of their own on them
+	Derived map[string]DerivedCPUModel `json:"derived,omitempty" yaml:"derived,omitempty"`
+
+	// Include names other files whose timings are merged into this list when it is read
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+}
+
+// A TimingModelDesc selects the estimator fitted to the timings of an operation.
+//
+//	Kind   - one of TimingModelKinds: linear (piecewise, the default), leastsquares,
+//	         polynomial, loglinear, step, or a kind registered with RegisterTimingModel
+//	Degree - for polynomial, the degree of the polynomial, 2 if not given
+type TimingModelDesc struct {
+	Kind   string `json:"kind" yaml:"kind"`
+	Degree int    `json:"degree,omitempty" yaml:"degree,omitempty"`
 }
 
 // CreateFuncExecList is an initialization constructor.
 // Its output struct has methods for integrating data.
 func CreateFuncExecList(listname string) *FuncExecList {
 	fel := new(FuncExecList)
+	fel.Version = ModelFormatVersion
 	fel.ListName = listname
 	fel.Times = make(map[string][]FuncExecDesc)
 	return fel
@@ -92,6 +205,23 @@ func ReadFuncExecList(filename string, useYAML bool, dict []byte) (*FuncExecList
 		}
 	}
 
+	example, err := decodeFuncExecList(filename, useYAML, dict)
+	if err != nil {
+		return nil, err
+	}
+
+	// merge in the timings of included files
+	err = example.resolveIncludes(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	return example, nil
+}
+
+// decodeFuncExecList deserializes the FuncExecList of the named file from its bytes, checking its
+// format version, without merging in the timings of the files it includes
+func decodeFuncExecList(filename string, useYAML bool, dict []byte) (*FuncExecList, error) {
+	var err error
 	example := FuncExecList{}
 
 	if useYAML {
@@ -104,9 +234,95 @@ func ReadFuncExecList(filename string, useYAML bool, dict []byte) (*FuncExecList
 		return nil, err
 	}
 
+	err = checkFormatVersion("function timing list", filename, example.Version)
+	if err != nil {
+		return nil, err
+	}
 	return &example, nil
 }
 
+// AddTimingDist adds a timing as AddTiming does, with the distribution from which its
+// execution times are drawn when the simulation is run with stochastic execution times
+func (fel *FuncExecList) AddTimingDist(identifier, param, cpumodel string,
+	pcktLen int, execTime float64, dist *ExecTimeDist) error {
+	err := dist.validate()
+	if err != nil {
+		return fmt.Errorf("timing of %s on %s: %s", identifier, cpumodel, err.Error())
+	}
+	fel.AddTiming(identifier, param, cpumodel, pcktLen, execTime)
+	timings := fel.Times[identifier]
+	timings[len(timings)-1].Dist = dist
+	return nil
+}
+
+// CheckDists returns an error for every timing whose distribution is malformed, or
+// that has a distribution of a kind that needs it but no mean execution time
+func (fel *FuncExecList) CheckDists() error {
+	errs := []error{}
+	for _, op := range sortedKeys(fel.Times) {
+		for _, fed := range fel.Times[op] {
+			if fed.Dist == nil {
+				continue
+			}
+			err := fed.Dist.validate()
+			if err == nil && fed.ExecTime <= 0.0 && (fed.Dist.Kind == "normal" || fed.Dist.Kind == "lognormal") {
+				err = fmt.Errorf("%s distribution needs a positive exectime as its mean", fed.Dist.Kind)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("timing of %s on %s for packet length %d: %s",
+					op, fed.CPUModel, fed.PcktLen, err.Error()))
+			}
+		}
+	}
+	return ReportErrs(errs)
+}
+
+// A DerivedCPUModel describes a CPU model as a scaled version of a reference model.  An execution time
+// derived for it is the reference model's time multiplied by a scale factor, e.g. 2 for a CPU half as fast.
+//
+//	Reference  - the CPU model whose timings are scaled, itself possibly derived
+//	Scale      - the scale factor applied to every operation
+//	OpScale    - scale factors for particular operations, by identifier, in place of Scale
+//	Benchmarks - ratios of time on this model to time on the reference, measured by a few benchmarks,
+//	             by benchmark name.  Without a Scale, their geometric mean is used as the Scale
+type DerivedCPUModel struct {
+	Reference  string             `json:"reference" yaml:"reference"`
+	Scale      float64            `json:"scale,omitempty" yaml:"scale,omitempty"`
+	OpScale    map[string]float64 `json:"opscale,omitempty" yaml:"opscale,omitempty"`
+	Benchmarks map[string]float64 `json:"benchmarks,omitempty" yaml:"benchmarks,omitempty"`
+}
+
+// DeriveCPUModel declares that timings missing for the CPU model named are derived from those of
+// the reference model, scaled by the given factor, or for the operations in opScale, by the factors given there
+func (fel *FuncExecList) DeriveCPUModel(cpumodel, reference string, scale float64, opScale map[string]float64) error {
+	dcm := DerivedCPUModel{Reference: reference, Scale: scale, OpScale: opScale}
+	err := dcm.validate(cpumodel)
+	if err != nil {
+		return err
+	}
+	if fel.Derived == nil {
+		fel.Derived = make(map[string]DerivedCPUModel)
+	}
+	fel.Derived[cpumodel] = dcm
+	return nil
+}
+
+// SetTimingModel selects the timing model fitted to the timings of an operation
+func (fel *FuncExecList) SetTimingModel(identifier, kind string, degree int) error {
+	_, present := TimingModelKinds[kind]
+	if !present {
+		return fmt.Errorf("timing model of %s has unrecognized kind %s", identifier, kind)
+	}
+	if degree < 0 {
+		return fmt.Errorf("timing model of %s has negative degree", identifier)
+	}
+	if fel.Models == nil {
+		fel.Models = make(map[string]TimingModelDesc)
+	}
+	fel.Models[identifier] = TimingModelDesc{Kind: kind, Degree: degree}
+	return nil
+}
+
 // AddTiming takes the parameters of a FuncExecDesc, creates one, and adds it to the FuncExecList
 func (fel *FuncExecList) AddTiming(identifier, param, cpumodel string,
 	pcktLen int, execTime float64) {
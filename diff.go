@@ -0,0 +1,441 @@
+package pces
+
+// file diff.go holds the structural comparison of two versions of a model, reporting the patterns,
+// functions, edges, services, messages, cfg fields, mappings, and timings added, removed, or changed
+// between them.  Descriptions are compared as data, so reordering a list or reformatting a file is not a change
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ModelDescs gathers the descriptions of one version of a model.  Any may be nil,
+// in which case that part of the model is not compared
+type ModelDescs struct {
+	CPD  *CompPatternDict
+	CPID *CPInitListDict
+	FEL  *FuncExecList
+	CPMD *CompPatternMapDict
+}
+
+// the kinds of change
+const (
+	ChangeAdded   string = "added"
+	ChangeRemoved string = "removed"
+	ChangeChanged string = "changed"
+)
+
+// diffItems lists the items compared, in the order they are reported
+var diffItems []string = []string{"pattern", "function", "edge", "extedge", "service", "msg", "cfg", "mapping", "timing"}
+
+// A ModelChange describes one difference between two versions of a model.
+//
+//	Kind - one of added, removed, changed
+//	Item - what changed, in {pattern, function, edge, extedge, service, msg, cfg, mapping, timing}
+//	Path - identifies the item, e.g. "chain1:proc" for a function, "chain1:proc.timingcode.req" for a cfg field
+//	Old  - value before, absent for an addition
+//	New  - value after, absent for a removal
+type ModelChange struct {
+	Kind string `json:"kind" yaml:"kind"`
+	Item string `json:"item" yaml:"item"`
+	Path string `json:"path" yaml:"path"`
+	Old  any    `json:"old,omitempty" yaml:"old,omitempty"`
+	New  any    `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// ModelDiff holds the differences between two versions of a model, is serializable
+type ModelDiff struct {
+	Changes []ModelChange `json:"changes" yaml:"changes"`
+}
+
+// add records a change
+func (md *ModelDiff) add(kind, item, path string, oldValue, newValue any) {
+	md.Changes = append(md.Changes, ModelChange{Kind: kind, Item: item, Path: path, Old: oldValue, New: newValue})
+}
+
+// Empty is true if the two versions compared do not differ
+func (md *ModelDiff) Empty() bool {
+	return len(md.Changes) == 0
+}
+
+// DiffModels compares two versions of a model and returns their differences.  A part
+// of the model is compared only if the descriptions of both versions give it
+func DiffModels(oldDescs, newDescs *ModelDescs) *ModelDiff {
+	md := &ModelDiff{Changes: []ModelChange{}}
+	if oldDescs.CPD != nil && newDescs.CPD != nil {
+		md.diffPatterns(oldDescs.CPD, newDescs.CPD)
+	}
+	if oldDescs.CPID != nil && newDescs.CPID != nil {
+		md.diffInits(oldDescs.CPID, newDescs.CPID)
+	}
+	if oldDescs.CPMD != nil && newDescs.CPMD != nil {
+		md.diffMaps(oldDescs.CPMD, newDescs.CPMD)
+	}
+	if oldDescs.FEL != nil && newDescs.FEL != nil {
+		md.diffTimings(oldDescs.FEL, newDescs.FEL)
+	}
+
+	// report in item order, and within an item by path
+	order := make(map[string]int)
+	for idx, item := range diffItems {
+		order[item] = idx
+	}
+	sort.SliceStable(md.Changes, func(i, j int) bool {
+		if md.Changes[i].Item != md.Changes[j].Item {
+			return order[md.Changes[i].Item] < order[md.Changes[j].Item]
+		}
+		return md.Changes[i].Path < md.Changes[j].Path
+	})
+	return md
+}
+
+// diffKeys calls added, removed, and common with the keys found in only the new map, only the old map, and both
+func diffKeys[V any](oldMap, newMap map[string]V, added, removed, common func(key string)) {
+	for _, key := range sortedKeys(newMap) {
+		_, present := oldMap[key]
+		if !present {
+			added(key)
+		} else {
+			common(key)
+		}
+	}
+	for _, key := range sortedKeys(oldMap) {
+		_, present := newMap[key]
+		if !present {
+			removed(key)
+		}
+	}
+}
+
+// diffSets records the members of a set that were added or removed
+func (md *ModelDiff) diffSets(item string, oldSet, newSet map[string]bool) {
+	diffKeys(oldSet, newSet,
+		func(key string) { md.add(ChangeAdded, item, key, nil, nil) },
+		func(key string) { md.add(ChangeRemoved, item, key, nil, nil) },
+		func(key string) {})
+}
+
+// diffPatterns compares comp patterns, their functions, edges, external edges, and services
+func (md *ModelDiff) diffPatterns(oldCPD, newCPD *CompPatternDict) {
+	diffKeys(oldCPD.Patterns, newCPD.Patterns,
+		func(ptnName string) { md.add(ChangeAdded, "pattern", ptnName, nil, newCPD.Patterns[ptnName].CPType) },
+		func(ptnName string) { md.add(ChangeRemoved, "pattern", ptnName, oldCPD.Patterns[ptnName].CPType, nil) },
+		func(ptnName string) {
+			oldCPT, newCPT := oldCPD.Patterns[ptnName], newCPD.Patterns[ptnName]
+			if oldCPT.CPType != newCPT.CPType {
+				md.add(ChangeChanged, "pattern", ptnName+".cptype", oldCPT.CPType, newCPT.CPType)
+			}
+
+			oldFuncs, newFuncs := make(map[string]string), make(map[string]string)
+			for _, fnc := range oldCPT.Funcs {
+				oldFuncs[fnc.Label] = fnc.Class
+			}
+			for _, fnc := range newCPT.Funcs {
+				newFuncs[fnc.Label] = fnc.Class
+			}
+			diffKeys(oldFuncs, newFuncs,
+				func(label string) { md.add(ChangeAdded, "function", ptnName+":"+label, nil, newFuncs[label]) },
+				func(label string) { md.add(ChangeRemoved, "function", ptnName+":"+label, oldFuncs[label], nil) },
+				func(label string) {
+					if oldFuncs[label] != newFuncs[label] {
+						md.add(ChangeChanged, "function", ptnName+":"+label+".class", oldFuncs[label], newFuncs[label])
+					}
+				})
+
+			md.diffSets("edge", edgeSet(ptnName, oldCPT.Edges), edgeSet(ptnName, newCPT.Edges))
+			md.diffSets("extedge", extEdgeSet(oldCPT.ExtEdges), extEdgeSet(newCPT.ExtEdges))
+
+			diffKeys(oldCPT.Services, newCPT.Services,
+				func(srvOp string) {
+					md.add(ChangeAdded, "service", ptnName+"."+srvOp, nil, srvTarget(ptnName, newCPT.Services[srvOp]))
+				},
+				func(srvOp string) {
+					md.add(ChangeRemoved, "service", ptnName+"."+srvOp, srvTarget(ptnName, oldCPT.Services[srvOp]), nil)
+				},
+				func(srvOp string) {
+					oldTarget := srvTarget(ptnName, oldCPT.Services[srvOp])
+					newTarget := srvTarget(ptnName, newCPT.Services[srvOp])
+					if oldTarget != newTarget {
+						md.add(ChangeChanged, "service", ptnName+"."+srvOp, oldTarget, newTarget)
+					}
+				})
+		})
+}
+
+// edgeSet describes each edge of a pattern as "ptn:src -msgtype-> dst"
+func edgeSet(ptnName string, edges []CmpPtnGraphEdge) map[string]bool {
+	set := make(map[string]bool)
+	for _, edge := range edges {
+		set[fmt.Sprintf("%s:%s -%s-> %s", ptnName, edge.SrcLabel, edge.MsgType, edge.DstLabel)] = true
+	}
+	return set
+}
+
+// extEdgeSet describes each external edge as "srcCP:src -msgtype-> dstCP:dst"
+func extEdgeSet(edges []XCPEdge) map[string]bool {
+	set := make(map[string]bool)
+	for _, edge := range edges {
+		set[fmt.Sprintf("%s:%s -%s-> %s:%s", edge.SrcCP, edge.SrcLabel, edge.MsgType, edge.DstCP, edge.DstLabel)] = true
+	}
+	return set
+}
+
+// srvTarget names the function offering a service, the pattern defaulting to the one offering it
+func srvTarget(ptnName string, fd funcDesc) string {
+	if len(fd.CP) == 0 {
+		return ptnName + ":" + fd.Label
+	}
+	return fd.CP + ":" + fd.Label
+}
+
+// diffInits compares the message types and function cfgs of the initialization lists.  Cfgs
+// are compared field by field, whether they are written serialized or as objects
+func (md *ModelDiff) diffInits(oldCPID, newCPID *CPInitListDict) {
+	for _, ptnName := range sortedKeys(newCPID.InitList) {
+		_, present := oldCPID.InitList[ptnName]
+		if !present {
+			continue
+		}
+		oldCPIL, newCPIL := oldCPID.InitList[ptnName], newCPID.InitList[ptnName]
+
+		oldMsgs, newMsgs := make(map[string]bool), make(map[string]bool)
+		for _, msg := range oldCPIL.Msgs {
+			oldMsgs[msg.MsgType] = msg.IsPckt
+		}
+		for _, msg := range newCPIL.Msgs {
+			newMsgs[msg.MsgType] = msg.IsPckt
+		}
+		diffKeys(oldMsgs, newMsgs,
+			func(msgType string) { md.add(ChangeAdded, "msg", ptnName+"."+msgType, nil, nil) },
+			func(msgType string) { md.add(ChangeRemoved, "msg", ptnName+"."+msgType, nil, nil) },
+			func(msgType string) {
+				if oldMsgs[msgType] != newMsgs[msgType] {
+					md.add(ChangeChanged, "msg", ptnName+"."+msgType+".ispckt", oldMsgs[msgType], newMsgs[msgType])
+				}
+			})
+
+		diffKeys(oldCPIL.Cfg, newCPIL.Cfg,
+			func(label string) { md.add(ChangeAdded, "cfg", ptnName+":"+label, nil, nil) },
+			func(label string) { md.add(ChangeRemoved, "cfg", ptnName+":"+label, nil, nil) },
+			func(label string) {
+				md.diffValues("cfg", ptnName+":"+label, decodeCfg(oldCPIL.Cfg[label]), decodeCfg(newCPIL.Cfg[label]))
+			})
+	}
+
+	// patterns initialized in only one version
+	for _, ptnName := range sortedKeys(oldCPID.InitList) {
+		_, present := newCPID.InitList[ptnName]
+		if !present {
+			for _, label := range sortedKeys(oldCPID.InitList[ptnName].Cfg) {
+				md.add(ChangeRemoved, "cfg", ptnName+":"+label, nil, nil)
+			}
+		}
+	}
+	for _, ptnName := range sortedKeys(newCPID.InitList) {
+		_, present := oldCPID.InitList[ptnName]
+		if !present {
+			for _, label := range sortedKeys(newCPID.InitList[ptnName].Cfg) {
+				md.add(ChangeAdded, "cfg", ptnName+":"+label, nil, nil)
+			}
+		}
+	}
+}
+
+// diffValues compares two decoded values field by field, recording a change at every leaf that differs.
+// Lists are compared whole
+func (md *ModelDiff) diffValues(item, path string, oldValue, newValue any) {
+	oldMap, oldIsMap := oldValue.(map[string]any)
+	newMap, newIsMap := newValue.(map[string]any)
+	if oldIsMap && newIsMap {
+		diffKeys(oldMap, newMap,
+			func(key string) { md.add(ChangeAdded, item, path+"."+key, nil, newMap[key]) },
+			func(key string) { md.add(ChangeRemoved, item, path+"."+key, oldMap[key], nil) },
+			func(key string) { md.diffValues(item, path+"."+key, oldMap[key], newMap[key]) })
+		return
+	}
+	if !reflect.DeepEqual(oldValue, newValue) {
+		md.add(ChangeChanged, item, path, oldValue, newValue)
+	}
+}
+
+// diffMaps compares the host and priority to which every function is mapped
+func (md *ModelDiff) diffMaps(oldCPMD, newCPMD *CompPatternMapDict) {
+	ptnNames := make(map[string]bool)
+	for ptnName := range oldCPMD.Map {
+		ptnNames[ptnName] = true
+	}
+	for ptnName := range newCPMD.Map {
+		ptnNames[ptnName] = true
+	}
+	for _, ptnName := range sortedKeys(ptnNames) {
+		oldFuncMap, newFuncMap := oldCPMD.Map[ptnName].FuncMap, newCPMD.Map[ptnName].FuncMap
+		diffKeys(oldFuncMap, newFuncMap,
+			func(label string) { md.add(ChangeAdded, "mapping", ptnName+":"+label, nil, newFuncMap[label]) },
+			func(label string) { md.add(ChangeRemoved, "mapping", ptnName+":"+label, oldFuncMap[label], nil) },
+			func(label string) {
+				oldHost := strings.ReplaceAll(oldFuncMap[label], " ", "")
+				newHost := strings.ReplaceAll(newFuncMap[label], " ", "")
+				if oldHost != newHost {
+					md.add(ChangeChanged, "mapping", ptnName+":"+label, oldFuncMap[label], newFuncMap[label])
+				}
+			})
+	}
+}
+
+// diffTimings compares the execution time of every operation, and its distribution, by param, CPU model, and packet length,
+// the timing model of every operation in both versions, and the derived CPU models
+func (md *ModelDiff) diffTimings(oldFEL, newFEL *FuncExecList) {
+	timings := func(fel *FuncExecList) map[string]FuncExecDesc {
+		rtn := make(map[string]FuncExecDesc)
+		for op, fedList := range fel.Times {
+			for _, fed := range fedList {
+				rtn[timingPath(op, timingKey{fed.Param, fed.CPUModel, fed.PcktLen})] = fed
+			}
+		}
+		return rtn
+	}
+	oldTimes, newTimes := timings(oldFEL), timings(newFEL)
+	diffKeys(oldTimes, newTimes,
+		func(key string) { md.add(ChangeAdded, "timing", key, nil, newTimes[key].ExecTime) },
+		func(key string) { md.add(ChangeRemoved, "timing", key, oldTimes[key].ExecTime, nil) },
+		func(key string) {
+			if oldTimes[key].ExecTime != newTimes[key].ExecTime {
+				md.add(ChangeChanged, "timing", key, oldTimes[key].ExecTime, newTimes[key].ExecTime)
+			}
+			oldDist, newDist := oldTimes[key].Dist, newTimes[key].Dist
+			if !reflect.DeepEqual(oldDist, newDist) {
+				switch {
+				case oldDist == nil:
+					md.add(ChangeAdded, "timing", key+".dist", nil, newDist.Kind)
+				case newDist == nil:
+					md.add(ChangeRemoved, "timing", key+".dist", oldDist.Kind, nil)
+				default:
+					md.add(ChangeChanged, "timing", key+".dist", *oldDist, *newDist)
+				}
+			}
+		})
+
+	oldModels, newModels := make(map[string]string), make(map[string]string)
+	for op := range oldFEL.Times {
+		oldModels[op] = timingModelStr(oldFEL.timingModelDesc(op))
+	}
+	for op := range newFEL.Times {
+		newModels[op] = timingModelStr(newFEL.timingModelDesc(op))
+	}
+	diffKeys(oldModels, newModels, func(key string) {}, func(key string) {},
+		func(key string) {
+			if oldModels[key] != newModels[key] {
+				md.add(ChangeChanged, "timing model", key, oldModels[key], newModels[key])
+			}
+		})
+
+	diffKeys(oldFEL.Derived, newFEL.Derived,
+		func(key string) { md.add(ChangeAdded, "derived CPU model", key, nil, newFEL.Derived[key].Reference) },
+		func(key string) { md.add(ChangeRemoved, "derived CPU model", key, oldFEL.Derived[key].Reference, nil) },
+		func(key string) {
+			if !reflect.DeepEqual(oldFEL.Derived[key], newFEL.Derived[key]) {
+				md.add(ChangeChanged, "derived CPU model", key, oldFEL.Derived[key], newFEL.Derived[key])
+			}
+		})
+}
+
+// timingModelStr gives the kind of a timing model, with its degree if it has one
+func timingModelStr(tmd TimingModelDesc) string {
+	if tmd.Degree > 0 {
+		return fmt.Sprintf("%s(%d)", tmd.Kind, tmd.Degree)
+	}
+	return tmd.Kind
+}
+
+// timingPath identifies a timing as "op[cpumodel,pcktlen]", with the param ahead of the cpumodel when there is one
+func timingPath(op string, key timingKey) string {
+	if len(key.param) > 0 {
+		return fmt.Sprintf("%s[%s,%s,%d]", op, key.param, key.cpuModel, key.pcktLen)
+	}
+	return fmt.Sprintf("%s[%s,%d]", op, key.cpuModel, key.pcktLen)
+}
+
+// diffValueStr formats a value for the report, compound values as json
+func diffValueStr(value any) string {
+	switch value.(type) {
+	case map[string]any, []any:
+		bytes, err := json.Marshal(value)
+		if err == nil {
+			return string(bytes)
+		}
+	case string:
+		return fmt.Sprintf("%q", value)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// Report describes the differences for a reader, one line per change grouped by item.
+// Added items are marked '+', removed items '-', and changed items '~'
+func (md *ModelDiff) Report() string {
+	if md.Empty() {
+		return "no differences\n"
+	}
+	var sb strings.Builder
+	counts := make(map[string]int)
+	item := ""
+	for _, change := range md.Changes {
+		if change.Item != item {
+			item = change.Item
+			sb.WriteString(item + "s:\n")
+		}
+		counts[change.Kind] += 1
+		switch change.Kind {
+		case ChangeAdded:
+			sb.WriteString("  + " + change.Path)
+			if change.New != nil {
+				sb.WriteString(" = " + diffValueStr(change.New))
+			}
+		case ChangeRemoved:
+			sb.WriteString("  - " + change.Path)
+			if change.Old != nil {
+				sb.WriteString(" = " + diffValueStr(change.Old))
+			}
+		case ChangeChanged:
+			sb.WriteString(fmt.Sprintf("  ~ %s: %s -> %s", change.Path, diffValueStr(change.Old), diffValueStr(change.New)))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(fmt.Sprintf("%d added, %d removed, %d changed\n",
+		counts[ChangeAdded], counts[ChangeRemoved], counts[ChangeChanged]))
+	return sb.String()
+}
+
+// WriteToFile serializes the ModelDiff and writes it to a file.  Output file
+// extension identifies whether serialization is to json or to yaml
+func (md *ModelDiff) WriteToFile(filename string) error {
+	pathExt := path.Ext(filename)
+	var bytes []byte
+	var merr error = nil
+
+	if pathExt == ".yaml" || pathExt == ".YAML" || pathExt == ".yml" {
+		bytes, merr = yaml.Marshal(*md)
+	} else if pathExt == ".json" || pathExt == ".JSON" {
+		bytes, merr = json.MarshalIndent(*md, "", "\t")
+	}
+
+	if merr != nil {
+		panic(merr)
+	}
+
+	f, cerr := os.Create(filename)
+	if cerr != nil {
+		panic(cerr)
+	}
+	_, werr := f.WriteString(string(bytes[:]))
+	if werr != nil {
+		panic(werr)
+	}
+	f.Close()
+	return werr
+}
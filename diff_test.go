@@ -0,0 +1,105 @@
+package pces
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testModelDescs returns the descriptions of testModel
+func testModelDescs(t *testing.T) *ModelDescs {
+	t.Helper()
+	cpd, cpid, fel, cpmd := testModel(t)
+	return &ModelDescs{CPD: cpd, CPID: cpid, FEL: fel, CPMD: cpmd}
+}
+
+func TestDiffModels(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(oldDescs, newDescs *ModelDescs)
+		want  []string
+	}{
+		{name: "same model", setup: func(oldDescs, newDescs *ModelDescs) {}, want: []string{}},
+		{
+			name: "patterns added and removed",
+			setup: func(oldDescs, newDescs *ModelDescs) {
+				cpt := newDescs.CPD.Patterns["chain1"]
+				newDescs.CPD.Patterns["chain2"] = *cpt.DeepCopy()
+				delete(newDescs.CPD.Patterns, "chain1")
+			},
+			want: []string{"removed pattern chain1 chain <nil>", "added pattern chain2 <nil> chain"},
+		},
+		{
+			name: "functions and edges",
+			setup: func(oldDescs, newDescs *ModelDescs) {
+				cpt := newDescs.CPD.Patterns["chain1"]
+				cpt.Funcs = append(cpt.Funcs, Func{Class: "processPckt", Label: "tap"})
+				cpt.Funcs[3].Class = "measure"
+				cpt.Edges[2].DstLabel = "tap"
+				newDescs.CPD.Patterns["chain1"] = cpt
+			},
+			want: []string{"changed function chain1:sink.class finish measure",
+				"added function chain1:tap <nil> processPckt",
+				"removed edge chain1:hash -rsp-> sink <nil> <nil>",
+				"added edge chain1:hash -rsp-> tap <nil> <nil>"},
+		},
+		{
+			name: "msgs",
+			setup: func(oldDescs, newDescs *ModelDescs) {
+				cpil := newDescs.CPID.InitList["chain1"]
+				cpil.Msgs = []CompPatternMsg{{MsgType: "req", IsPckt: false}, {MsgType: "ack", IsPckt: true}}
+				newDescs.CPID.InitList["chain1"] = cpil
+			},
+			want: []string{"added msg chain1.ack <nil> <nil>", "changed msg chain1.req.ispckt true false",
+				"removed msg chain1.rsp <nil> <nil>"},
+		},
+		{
+			name: "cfg fields, whatever their serialization",
+			setup: func(oldDescs, newDescs *ModelDescs) {
+				oldDescs.CPID.InitList["chain1"].Cfg["proc"] = "timingcode: {req: crypt}\nmsg2msg: {req: req}"
+				newDescs.CPID.InitList["chain1"].Cfg["proc"] = `{"timingcode": {"req": "hash"}, "threads": 2}`
+				newDescs.CPID.InitList["chain1"].Cfg["tap"] = "timingcode: {req: crypt}"
+			},
+			want: []string{"removed cfg chain1:proc.msg2msg map[req:req] <nil>",
+				"added cfg chain1:proc.threads <nil> 2",
+				"changed cfg chain1:proc.timingcode.req crypt hash",
+				"added cfg chain1:tap <nil> <nil>"},
+		},
+		{
+			name: "mappings",
+			setup: func(oldDescs, newDescs *ModelDescs) {
+				newDescs.CPMD.Map["chain1"].FuncMap["proc"] = "hostB,1"
+				newDescs.CPMD.Map["chain1"].FuncMap["src"] = "hostA, 1"
+				delete(newDescs.CPMD.Map["chain1"].FuncMap, "sink")
+			},
+			want: []string{"changed mapping chain1:proc hostA,1 hostB,1", "removed mapping chain1:sink hostA,1 <nil>"},
+		},
+		{
+			name: "timings",
+			setup: func(oldDescs, newDescs *ModelDescs) {
+				newDescs.FEL.Times["crypt"][0].ExecTime = 2.0e-3
+				newDescs.FEL.Times["crypt"][1].Dist = &ExecTimeDist{Kind: "normal", StdDev: 1.0e-4}
+				newDescs.FEL.AddTiming("crypt", "", "x86", 2000, 1.5e-3)
+				delete(newDescs.FEL.Times, "hash")
+			},
+			want: []string{"added timing crypt[arm,1000].dist <nil> normal",
+				"changed timing crypt[x86,1000] 0.001 0.002",
+				"added timing crypt[x86,2000] <nil> 0.0015",
+				"removed timing hash[x86,1000] 0.0005 <nil>"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			oldDescs, newDescs := testModelDescs(t), testModelDescs(t)
+			tc.setup(oldDescs, newDescs)
+			md := DiffModels(oldDescs, newDescs)
+			got := make([]string, len(md.Changes))
+			for idx, mc := range md.Changes {
+				got[idx] = fmt.Sprintf("%s %s %s %v %v", mc.Kind, mc.Item, mc.Path, mc.Old, mc.New)
+			}
+			if !hasPrefixes(got, tc.want) || md.Empty() != (len(tc.want) == 0) {
+				t.Errorf("DiffModels =\n%q\nwant\n%q", got, tc.want)
+			}
+		})
+	}
+}
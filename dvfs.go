@@ -0,0 +1,269 @@
+package pces
+
+// file dvfs.go holds structs, methods, and event handlers that change the CPU frequency of
+// hosts while the simulation runs, following a DVFSPolicy, and that scale the execution times
+// looked up for functions on those hosts by the frequency in force.  An execution takes the
+// time given by the frequency at its start, a later change of frequency leaving it unaffected
+
+import (
+	"fmt"
+	"github.com/iti/evt/evtm"
+	"github.com/iti/evt/vrtime"
+	"github.com/iti/mrnes"
+	"sort"
+)
+
+// FreqChange records one change in the CPU frequency of a host
+type FreqChange struct {
+	Time float64 // simulation time of the change
+	Host string  // host whose frequency changed
+	From float64 // frequency before the change
+	To   float64 // frequency after the change
+	Util float64 // utilization sampled by an ondemand governor, zero for a schedule
+}
+
+// FreqChanges lists every change of frequency, in order of occurrence
+var FreqChanges []*FreqChange = make([]*FreqChange, 0)
+
+// DVFSGovernors holds the governors created for the experiment, indexed by host
+var DVFSGovernors map[string]*DVFSGovernor = make(map[string]*DVFSGovernor)
+
+// dvfsSensitivity gives, by operation, the fraction of its execution time that scales with CPU frequency
+var dvfsSensitivity map[string]float64 = make(map[string]float64)
+
+// A DVFSGovernor applies a DVFSPolicy to one host
+type DVFSGovernor struct {
+	Policy   DVFSPolicy
+	freq     float64   // current frequency
+	states   []float64 // frequency states, in increasing order
+	started  float64   // time the governor started
+	since    float64   // time of the most recent change of frequency
+	area     float64   // integral of frequency over time, up to since
+	lastBusy float64   // busy time summed over the functions on the host at the previous sample
+	lastTime float64   // time of the previous sample
+	running  bool
+	dormant  bool // true when sampling is suspended until the next arrival on the host
+}
+
+// CreateDVFSGovernor is a constructor.  It checks the policy and the host it names,
+// and remembers the governor in DVFSGovernors
+func CreateDVFSGovernor(policy *DVFSPolicy) (*DVFSGovernor, error) {
+	err := policy.Validate()
+	if err != nil {
+		return nil, err
+	}
+	_, present := mrnes.EndptDevByName[policy.Host]
+	if !present {
+		return nil, fmt.Errorf("dvfs policy names unrecognized host %s", policy.Host)
+	}
+	_, present = DVFSGovernors[policy.Host]
+	if present {
+		return nil, fmt.Errorf("host %s given more than one dvfs governor", policy.Host)
+	}
+
+	dg := &DVFSGovernor{Policy: *policy, freq: policy.initialFreq(), states: policy.sortedStates()}
+	DVFSGovernors[policy.Host] = dg
+	return dg, nil
+}
+
+// Start records the initial frequency of the host and schedules the governor's first events,
+// the steps of a schedule or the first sample of an ondemand governor
+func (dg *DVFSGovernor) Start(evtMgr *evtm.EventManager) error {
+	if dg.running {
+		return fmt.Errorf("dvfs governor for %s already started", dg.Policy.Host)
+	}
+	dg.running = true
+
+	now := evtMgr.CurrentSeconds()
+	dg.started, dg.since = now, now
+
+	if dg.Policy.Governor == "schedule" {
+		for _, step := range dg.Policy.Schedule {
+			evtMgr.Schedule(dg, step.Freq, dvfsStep, vrtime.SecondsToTime(step.Time-now))
+		}
+		return nil
+	}
+
+	dg.lastTime = now
+	dg.lastBusy = hostBusyTime(dg.Policy.Host, now)
+	evtMgr.Schedule(dg, nil, dvfsSample, vrtime.SecondsToTime(dg.Policy.Interval))
+	return nil
+}
+
+// Stop ends the governor's changes of frequency at its next event.  The frequency in force remains
+func (dg *DVFSGovernor) Stop() {
+	dg.running = false
+}
+
+// StartDVFS takes the operation sensitivities of the list, and creates and starts a governor for every policy in it
+func StartDVFS(evtMgr *evtm.EventManager, dpl *DVFSPolicyList) error {
+	errs := []error{}
+	for _, op := range sortedKeys(dpl.Sensitivity) {
+		sensitivity := dpl.Sensitivity[op]
+		if sensitivity < 0.0 || sensitivity > 1.0 {
+			errs = append(errs, fmt.Errorf("dvfs sensitivity of %s must lie in [0,1]", op))
+			continue
+		}
+		dvfsSensitivity[op] = sensitivity
+	}
+	for idx := range dpl.Policies {
+		dg, err := CreateDVFSGovernor(&dpl.Policies[idx])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = dg.Start(evtMgr)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return ReportErrs(errs)
+}
+
+// dvfsScale returns the factor by which the execution time of an operation on a host is multiplied
+// at the host's current frequency.  The fraction of the time sensitive to frequency scales inversely
+// with it, relative to the nominal frequency at which the timings were measured
+func dvfsScale(host, op string) float64 {
+	dg, present := DVFSGovernors[host]
+	if !present {
+		return 1.0
+	}
+	sensitivity, present := dvfsSensitivity[op]
+	if !present {
+		sensitivity = 1.0
+	}
+	return sensitivity*dg.Policy.Nominal/dg.freq + (1.0 - sensitivity)
+}
+
+// setFreq changes the frequency of the host, recording the change
+func (dg *DVFSGovernor) setFreq(now, freq, util float64) {
+	if freq == dg.freq {
+		return
+	}
+	dg.area += dg.freq * (now - dg.since)
+	FreqChanges = append(FreqChanges, &FreqChange{Time: now, Host: dg.Policy.Host, From: dg.freq, To: freq, Util: util})
+	dg.freq = freq
+	dg.since = now
+}
+
+// dvfsStep is an event handler that sets the frequency of a host to the one given as data
+func dvfsStep(evtMgr *evtm.EventManager, context any, data any) any {
+	dg := context.(*DVFSGovernor)
+	if !dg.running {
+		return nil
+	}
+	dg.setFreq(evtMgr.CurrentSeconds(), data.(float64), 0.0)
+	return nil
+}
+
+// hostBusyTime sums the busy time of all the function instances running on the host
+func hostBusyTime(host string, now float64) float64 {
+	// summed in order of ID, so that runs are reproducible
+	ids := make([]int, 0, len(CmpPtnFuncInstByID))
+	for id := range CmpPtnFuncInstByID {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var busy float64
+	for _, id := range ids {
+		cpfi := CmpPtnFuncInstByID[id]
+		if cpfi.Host == host {
+			busy += cpfi.busyTimeAt(now)
+		}
+	}
+	return busy
+}
+
+// hostInFlight sums the work in flight over all the function instances running on the host
+func hostInFlight(host string) int {
+	inFlight := 0
+	for _, cpfi := range CmpPtnFuncInstByID {
+		if cpfi.Host == host {
+			inFlight += cpfi.InFlight
+		}
+	}
+	return inFlight
+}
+
+// sample returns the fraction of the time since the previous sample that functions on the host
+// had work in flight, summed over the functions and taken as at most one.  Functions moved off
+// the host take their busy time with them, which can make the difference negative; that is read
+// as an idle interval
+func (dg *DVFSGovernor) sample(now float64) float64 {
+	busy := hostBusyTime(dg.Policy.Host, now)
+	elapsed := now - dg.lastTime
+	util := 0.0
+	if elapsed > 0.0 && busy > dg.lastBusy {
+		util = min((busy-dg.lastBusy)/elapsed, 1.0)
+	}
+	dg.lastBusy = busy
+	dg.lastTime = now
+	return util
+}
+
+// dvfsSample is an event handler that samples the utilization of the host, moves its frequency
+// one state up or down as the policy directs, and schedules the next sample
+func dvfsSample(evtMgr *evtm.EventManager, context any, data any) any {
+	dg := context.(*DVFSGovernor)
+	if !dg.running {
+		return nil
+	}
+
+	now := evtMgr.CurrentSeconds()
+	util := dg.sample(now)
+
+	// an ondemand governor always runs at one of its states
+	idx := 0
+	for dg.states[idx] != dg.freq {
+		idx += 1
+	}
+	if util >= dg.Policy.Up && idx+1 < len(dg.states) {
+		dg.setFreq(now, dg.states[idx+1], util)
+	} else if util <= dg.Policy.Down && idx > 0 {
+		dg.setFreq(now, dg.states[idx-1], util)
+	}
+
+	// an idle host at its lowest state stops sampling, otherwise the sampling events alone
+	// would keep a simulation with no stop time from ever ending.  The next arrival at
+	// a function on the host resumes sampling
+	if util == 0.0 && hostInFlight(dg.Policy.Host) == 0 && dg.freq == dg.states[0] {
+		dg.dormant = true
+		return nil
+	}
+
+	evtMgr.Schedule(dg, nil, dvfsSample, vrtime.SecondsToTime(dg.Policy.Interval))
+	return nil
+}
+
+// wakeDVFS resumes sampling of the dormant governor of a host, if it has one
+func wakeDVFS(evtMgr *evtm.EventManager, host string) {
+	dg, present := DVFSGovernors[host]
+	if !present || !dg.dormant || !dg.running {
+		return
+	}
+	dg.dormant = false
+	now := evtMgr.CurrentSeconds()
+	dg.lastTime = now
+	dg.lastBusy = hostBusyTime(host, now)
+	evtMgr.Schedule(dg, nil, dvfsSample, vrtime.SecondsToTime(dg.Policy.Interval))
+}
+
+// ReportDVFS prints the changes of frequency of the run, and the time-weighted
+// average frequency of each governed host up to the given time
+func ReportDVFS(now float64) {
+	for _, fc := range FreqChanges {
+		utilStr := ""
+		if DVFSGovernors[fc.Host].Policy.Governor == "ondemand" {
+			utilStr = fmt.Sprintf(", utilization %f", fc.Util)
+		}
+		fmt.Printf("Frequency of %s at %f changed from %g to %g%s\n", fc.Host, fc.Time, fc.From, fc.To, utilStr)
+	}
+	for _, host := range sortedKeys(DVFSGovernors) {
+		dg := DVFSGovernors[host]
+		if now > dg.started {
+			area := dg.area + dg.freq*(now-dg.since)
+			fmt.Printf("Host %s averaged frequency %g (nominal %g)\n", host, area/(now-dg.started), dg.Policy.Nominal)
+		}
+	}
+}
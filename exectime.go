@@ -0,0 +1,158 @@
+package pces
+
+// file exectime.go holds the drawing of stochastic function execution times.  A timing may
+// describe the distribution of its execution time about its mean; when the simulation is run with
+// stochastic execution times each lookup draws from the distribution, using a random number stream
+// belonging to the function doing the lookup.  Otherwise the mean is used, as it always is for
+// timings without a distribution
+
+import (
+	"github.com/iti/rngstream"
+	"math"
+	"sort"
+)
+
+// StochasticExecTimes selects whether function execution times are drawn from the distributions
+// given with their timings, or are the means of those distributions
+var StochasticExecTimes bool = false
+
+// an execDist is the distribution of a timing, with the timing's mean
+type execDist struct {
+	dist *ExecTimeDist
+	mean float64
+}
+
+// execDistTbl holds the distributions of function execution times, with the same keys as an execTimeTbl
+type execDistTbl map[string]map[string]map[string]map[int]execDist
+
+var funcExecDistTbl execDistTbl = make(execDistTbl)
+
+// buildFuncExecDistTbl gathers the distributions of the timings that have them
+func buildFuncExecDistTbl(fel *FuncExecList) execDistTbl {
+	edt := make(execDistTbl)
+	for operation, mapList := range fel.Times {
+		for _, funcExecDesc := range mapList {
+			if funcExecDesc.Dist == nil {
+				continue
+			}
+			cpumodel := funcExecDesc.CPUModel
+			param := funcExecDesc.Param
+			_, present := edt[operation]
+			if !present {
+				edt[operation] = make(map[string]map[string]map[int]execDist)
+			}
+			_, present = edt[operation][cpumodel]
+			if !present {
+				edt[operation][cpumodel] = make(map[string]map[int]execDist)
+			}
+			_, present = edt[operation][cpumodel][param]
+			if !present {
+				edt[operation][cpumodel][param] = make(map[int]execDist)
+			}
+			edt[operation][cpumodel][param][funcExecDesc.PcktLen] = execDist{dist: funcExecDesc.Dist, mean: timingMean(&funcExecDesc)}
+		}
+	}
+
+	// a drawn time is scaled to its mean, so a derived CPU model shares the distributions of its reference
+	deriveModels(edt, fel, func(params map[string]map[int]execDist, scale float64) map[string]map[int]execDist { return params })
+	return edt
+}
+
+// timingMean is the execution time used for a timing when times are not drawn: its ExecTime,
+// or the mean of its samples or histogram when no ExecTime is given
+func timingMean(fed *FuncExecDesc) float64 {
+	if fed.ExecTime == 0.0 && fed.Dist != nil {
+		return fed.Dist.mean()
+	}
+	return fed.ExecTime
+}
+
+// lookupParam selects among values indexed by param the one for the given param.
+// A value given without a param serves any param that has none of its own,
+// and when no param is asked for, the value of the one param given serves
+func lookupParam[V any](params map[string]V, param string) (V, bool) {
+	value, present := params[param]
+	if present {
+		return value, true
+	}
+	value, present = params[""]
+	if present {
+		return value, true
+	}
+	if len(param) == 0 && len(params) == 1 {
+		for _, value := range params {
+			return value, true
+		}
+	}
+	return value, false
+}
+
+// drawExecTime returns an execution time drawn about the given mean, from the distribution of the timing
+// of the operation on the model with the given param whose packet length is closest to pcktLen.  The
+// distribution gives the shape of the variation, scaled to the mean.  Without a distribution the mean is returned
+func drawExecTime(model, op, param string, pcktLen int, mean float64, rng *rngstream.RngStream) float64 {
+	dists, present := lookupParam(funcExecDistTbl[op][model], param)
+	if !present || len(dists) == 0 || rng == nil || mean <= 0.0 {
+		return mean
+	}
+
+	pls := make([]int, 0, len(dists))
+	for pl := range dists {
+		pls = append(pls, pl)
+	}
+	sort.Ints(pls)
+	nearest := pls[0]
+	for _, pl := range pls[1:] {
+		if math.Abs(float64(pl-pcktLen)) < math.Abs(float64(nearest-pcktLen)) {
+			nearest = pl
+		}
+	}
+	ed := dists[nearest]
+	if ed.mean <= 0.0 {
+		return mean
+	}
+	return mean * ed.dist.draw(ed.mean, rng) / ed.mean
+}
+
+// draw returns a time drawn from the distribution, a normal or lognormal distribution having the given mean
+func (etd *ExecTimeDist) draw(mean float64, rng *rngstream.RngStream) float64 {
+	switch etd.Kind {
+	case "normal":
+		return math.Max(0.0, mean+etd.StdDev*stdNormal(rng))
+	case "lognormal":
+		// parameters of the underlying normal giving the mean and standard deviation asked for
+		sigma2 := math.Log(1.0 + (etd.StdDev*etd.StdDev)/(mean*mean))
+		mu := math.Log(mean) - sigma2/2.0
+		return math.Exp(mu + math.Sqrt(sigma2)*stdNormal(rng))
+	case "empirical":
+		idx := int(rng.RandU01() * float64(len(etd.Samples)))
+		return etd.Samples[min(idx, len(etd.Samples)-1)]
+	case "histogram":
+		total := 0.0
+		for _, count := range etd.Counts {
+			total += count
+		}
+		u := rng.RandU01() * total
+		for idx, count := range etd.Counts {
+			if u < count || idx == len(etd.Counts)-1 {
+				frac := 0.0
+				if count > 0.0 {
+					frac = math.Min(1.0, u/count)
+				}
+				return etd.Edges[idx] + frac*(etd.Edges[idx+1]-etd.Edges[idx])
+			}
+			u -= count
+		}
+	}
+	return mean
+}
+
+// stdNormal draws from the standard normal distribution, by the Box-Muller transform
+func stdNormal(rng *rngstream.RngStream) float64 {
+	u1 := rng.RandU01()
+	for u1 == 0.0 {
+		u1 = rng.RandU01()
+	}
+	u2 := rng.RandU01()
+	return math.Sqrt(-2.0*math.Log(u1)) * math.Cos(2.0*math.Pi*u2)
+}
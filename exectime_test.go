@@ -0,0 +1,62 @@
+package pces
+
+import (
+	"testing"
+)
+
+func TestLookupParam(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]int
+		param   string
+		want    int
+		present bool
+	}{
+		{"own param", map[string]int{"": 1, "aes": 2}, "aes", 2, true},
+		{"falls back to no param", map[string]int{"": 1, "aes": 2}, "des", 1, true},
+		{"no param asked", map[string]int{"": 1, "aes": 2}, "", 1, true},
+		{"no param asked, one param given", map[string]int{"aes": 2}, "", 2, true},
+		{"no param asked, several given", map[string]int{"aes": 2, "des": 3}, "", 0, false},
+		{"other param, no fallback", map[string]int{"aes": 2}, "des", 0, false},
+		{"nothing given", map[string]int{}, "aes", 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, present := lookupParam(tc.params, tc.param)
+			if present != tc.present || (present && got != tc.want) {
+				t.Errorf("lookupParam(%v, %q) = %d, %v, want %d, %v", tc.params, tc.param, got, present, tc.want, tc.present)
+			}
+		})
+	}
+}
+
+func TestExecTimeTblLookupByParam(t *testing.T) {
+	fel := CreateFuncExecList("params")
+	fel.AddTiming("crypt", "", "x86", 100, 1.0)
+	fel.AddTiming("crypt", "", "x86", 200, 2.0)
+	fel.AddTiming("crypt", "aes", "x86", 100, 10.0)
+	fel.AddTiming("crypt", "aes", "x86", 200, 20.0)
+	et := buildFuncExecTimeTbl(fel)
+
+	tests := []struct {
+		model, param string
+		want         float64
+		present      bool
+	}{
+		{"x86", "aes", 20.0, true},
+		{"x86", "des", 2.0, true},
+		{"x86", "", 2.0, true},
+		{"arm", "aes", 0.0, false},
+	}
+	for _, tc := range tests {
+		fmap, present := et.lookup("crypt", tc.model, tc.param)
+		if present != tc.present {
+			t.Errorf("lookup(crypt, %s, %q) present %v, want %v", tc.model, tc.param, present, tc.present)
+			continue
+		}
+		if present && (len(fmap) != 2 || !closeTo(fmap[200], tc.want)) {
+			t.Errorf("lookup(crypt, %s, %q) = %v, want %g at 200", tc.model, tc.param, fmap, tc.want)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package pces
+
+// file graph.go holds exporters that render the comp patterns of a CompPatternDict, with their
+// functions, edges, external edges, and services, as Graphviz DOT, Mermaid, or GraphML text
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// graphNode is a function as the exporters draw it
+type graphNode struct {
+	id      string // identifier safe to use in every output format
+	ptnName string
+	label   string
+	class   string
+	host    string // empty when no map is given or the function is not mapped
+}
+
+// graphEdge is an edge as the exporters draw it.  kind is "edge" for an edge within a pattern,
+// "xedge" for an edge between patterns, and "service" for the link from a service to its provider
+type graphEdge struct {
+	src, dst string // node ids
+	msgType  string
+	kind     string
+}
+
+// graphService is a service offered by a pattern
+type graphService struct {
+	id      string
+	ptnName string
+	srvOp   string
+}
+
+// cpGraph holds everything the exporters draw, in a fixed order so that output is repeatable
+type cpGraph struct {
+	ptnNames []string
+	nodes    []*graphNode
+	services []*graphService
+	edges    []*graphEdge
+}
+
+// graphID turns a name into an identifier made only of letters, digits, and underscores
+func graphID(prefix string, names ...string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	for _, name := range names {
+		sb.WriteString("_")
+		for _, r := range name {
+			if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+				sb.WriteRune(r)
+			} else {
+				sb.WriteString(fmt.Sprintf("_%x_", r))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// buildCPGraph gathers from cpd (and cpmd, which may be nil) what the exporters draw
+func buildCPGraph(cpd *CompPatternDict, cpmd *CompPatternMapDict) *cpGraph {
+	cg := new(cpGraph)
+	cg.ptnNames = sortedPtnNames(cpd)
+
+	known := make(map[string]bool)
+	for _, ptnName := range cg.ptnNames {
+		cpt := cpd.Patterns[ptnName]
+		for _, fnc := range cpt.Funcs {
+			gn := &graphNode{id: graphID("f", ptnName, fnc.Label), ptnName: ptnName, label: fnc.Label, class: fnc.Class}
+			if cpmd != nil {
+				cpm, present := cpmd.Map[ptnName]
+				if present {
+					host, err := parseHostPri(cpm.FuncMap[fnc.Label])
+					if err == nil {
+						gn.host = host
+					}
+				}
+			}
+			known[gn.id] = true
+			cg.nodes = append(cg.nodes, gn)
+		}
+	}
+
+	for _, ptnName := range cg.ptnNames {
+		cpt := cpd.Patterns[ptnName]
+		for _, edge := range cpt.Edges {
+			src, dst := graphID("f", ptnName, edge.SrcLabel), graphID("f", ptnName, edge.DstLabel)
+			if known[src] && known[dst] {
+				cg.edges = append(cg.edges, &graphEdge{src: src, dst: dst, msgType: edge.MsgType, kind: "edge"})
+			}
+		}
+		for _, xedge := range cpt.ExtEdges {
+			src, dst := graphID("f", xedge.SrcCP, xedge.SrcLabel), graphID("f", xedge.DstCP, xedge.DstLabel)
+			if known[src] && known[dst] {
+				cg.edges = append(cg.edges, &graphEdge{src: src, dst: dst, msgType: xedge.MsgType, kind: "xedge"})
+			}
+		}
+		for _, srvOp := range sortedKeys(cpt.Services) {
+			srvDesc := cpt.Services[srvOp]
+			srvCP := srvDesc.CP
+			if len(srvCP) == 0 {
+				srvCP = ptnName
+			}
+			gs := &graphService{id: graphID("s", ptnName, srvOp), ptnName: ptnName, srvOp: srvOp}
+			cg.services = append(cg.services, gs)
+			dst := graphID("f", srvCP, srvDesc.Label)
+			if known[dst] {
+				cg.edges = append(cg.edges, &graphEdge{src: gs.id, dst: dst, kind: "service"})
+			}
+		}
+	}
+	return cg
+}
+
+// nodeText returns the lines of text shown inside a function's node
+func (gn *graphNode) nodeText() []string {
+	lines := []string{gn.label, "(" + gn.class + ")"}
+	if len(gn.host) > 0 {
+		lines = append(lines, "@ "+gn.host)
+	}
+	return lines
+}
+
+// dotQuote escapes a string for use inside a double-quoted DOT string
+func dotQuote(str string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(str, `\`, `\\`), `"`, `\"`)
+}
+
+// ExportDOT renders the comp patterns of cpd as a Graphviz DOT digraph, one cluster per pattern.
+// If cpmd is not nil each function is annotated with the host it is mapped to.
+// External edges are dashed, services are drawn as notes linked by dotted edges to the functions providing them
+func ExportDOT(cpd *CompPatternDict, cpmd *CompPatternMapDict) string {
+	cg := buildCPGraph(cpd, cpmd)
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("digraph \"%s\" {\n", dotQuote(cpd.DictName)))
+	sb.WriteString("\trankdir=LR;\n")
+	sb.WriteString("\tnode [shape=box, style=rounded];\n")
+
+	for _, ptnName := range cg.ptnNames {
+		sb.WriteString(fmt.Sprintf("\tsubgraph %s {\n", graphID("cluster", ptnName)))
+		sb.WriteString(fmt.Sprintf("\t\tlabel=\"%s\";\n", dotQuote(ptnName)))
+		for _, gn := range cg.nodes {
+			if gn.ptnName == ptnName {
+				lines := gn.nodeText()
+				for idx := range lines {
+					lines[idx] = dotQuote(lines[idx])
+				}
+				sb.WriteString(fmt.Sprintf("\t\t%s [label=\"%s\"];\n", gn.id, strings.Join(lines, `\n`)))
+			}
+		}
+		for _, gs := range cg.services {
+			if gs.ptnName == ptnName {
+				sb.WriteString(fmt.Sprintf("\t\t%s [label=\"service %s\", shape=note, style=\"\"];\n", gs.id, dotQuote(gs.srvOp)))
+			}
+		}
+		sb.WriteString("\t}\n")
+	}
+
+	for _, ge := range cg.edges {
+		switch ge.kind {
+		case "edge":
+			sb.WriteString(fmt.Sprintf("\t%s -> %s [label=\"%s\"];\n", ge.src, ge.dst, dotQuote(ge.msgType)))
+		case "xedge":
+			sb.WriteString(fmt.Sprintf("\t%s -> %s [label=\"%s\", style=dashed];\n", ge.src, ge.dst, dotQuote(ge.msgType)))
+		case "service":
+			sb.WriteString(fmt.Sprintf("\t%s -> %s [style=dotted, arrowhead=none];\n", ge.src, ge.dst))
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// mermaidQuote replaces the characters that would end a quoted Mermaid label
+func mermaidQuote(str string) string {
+	return strings.ReplaceAll(str, `"`, "#quot;")
+}
+
+// ExportMermaid renders the comp patterns of cpd as a Mermaid flowchart, one subgraph per pattern.
+// If cpmd is not nil each function is annotated with the host it is mapped to.
+// External edges are dotted arrows, services are drawn as circles linked to the functions providing them
+func ExportMermaid(cpd *CompPatternDict, cpmd *CompPatternMapDict) string {
+	cg := buildCPGraph(cpd, cpmd)
+	var sb strings.Builder
+
+	sb.WriteString("flowchart LR\n")
+	for _, ptnName := range cg.ptnNames {
+		sb.WriteString(fmt.Sprintf("  subgraph %s[\"%s\"]\n", graphID("p", ptnName), mermaidQuote(ptnName)))
+		for _, gn := range cg.nodes {
+			if gn.ptnName == ptnName {
+				sb.WriteString(fmt.Sprintf("    %s[\"%s\"]\n", gn.id, mermaidQuote(strings.Join(gn.nodeText(), "<br/>"))))
+			}
+		}
+		for _, gs := range cg.services {
+			if gs.ptnName == ptnName {
+				sb.WriteString(fmt.Sprintf("    %s((\"service %s\"))\n", gs.id, mermaidQuote(gs.srvOp)))
+			}
+		}
+		sb.WriteString("  end\n")
+	}
+
+	for _, ge := range cg.edges {
+		switch ge.kind {
+		case "edge":
+			sb.WriteString(fmt.Sprintf("  %s -->|\"%s\"| %s\n", ge.src, mermaidQuote(ge.msgType), ge.dst))
+		case "xedge":
+			sb.WriteString(fmt.Sprintf("  %s -.->|\"%s\"| %s\n", ge.src, mermaidQuote(ge.msgType), ge.dst))
+		case "service":
+			sb.WriteString(fmt.Sprintf("  %s -.- %s\n", ge.src, ge.dst))
+		}
+	}
+	return sb.String()
+}
+
+// xmlText escapes a string for use as XML character data
+func xmlText(str string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(str))
+	return buf.String()
+}
+
+// ExportGraphML renders the comp patterns of cpd as a GraphML document.  Every function and service
+// is a node carrying data keys for its kind, pattern, label, class, and (if cpmd is not nil) host.
+// Every edge carries data keys for its kind and message type
+func ExportGraphML(cpd *CompPatternDict, cpmd *CompPatternMapDict) string {
+	cg := buildCPGraph(cpd, cpmd)
+	var sb strings.Builder
+
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	sb.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	nodeKeys := []string{"kind", "pattern", "label", "class", "host"}
+	for _, key := range nodeKeys {
+		sb.WriteString(fmt.Sprintf("  <key id=\"n_%s\" for=\"node\" attr.name=\"%s\" attr.type=\"string\"/>\n", key, key))
+	}
+	for _, key := range []string{"kind", "msgtype"} {
+		sb.WriteString(fmt.Sprintf("  <key id=\"e_%s\" for=\"edge\" attr.name=\"%s\" attr.type=\"string\"/>\n", key, key))
+	}
+	sb.WriteString(fmt.Sprintf("  <graph id=\"%s\" edgedefault=\"directed\">\n", xmlText(cpd.DictName)))
+
+	writeData := func(prefix, key, value string) {
+		if len(value) > 0 {
+			sb.WriteString(fmt.Sprintf("      <data key=\"%s_%s\">%s</data>\n", prefix, key, xmlText(value)))
+		}
+	}
+
+	for _, gn := range cg.nodes {
+		sb.WriteString(fmt.Sprintf("    <node id=\"%s\">\n", gn.id))
+		writeData("n", "kind", "function")
+		writeData("n", "pattern", gn.ptnName)
+		writeData("n", "label", gn.label)
+		writeData("n", "class", gn.class)
+		writeData("n", "host", gn.host)
+		sb.WriteString("    </node>\n")
+	}
+	for _, gs := range cg.services {
+		sb.WriteString(fmt.Sprintf("    <node id=\"%s\">\n", gs.id))
+		writeData("n", "kind", "service")
+		writeData("n", "pattern", gs.ptnName)
+		writeData("n", "label", gs.srvOp)
+		sb.WriteString("    </node>\n")
+	}
+	for idx, ge := range cg.edges {
+		sb.WriteString(fmt.Sprintf("    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", idx, ge.src, ge.dst))
+		writeData("e", "kind", ge.kind)
+		writeData("e", "msgtype", ge.msgType)
+		sb.WriteString("    </edge>\n")
+	}
+	sb.WriteString("  </graph>\n")
+	sb.WriteString("</graphml>\n")
+	return sb.String()
+}
+
+// GraphFormatByExt returns the export format implied by a file name's extension:
+// "dot" for .dot or .gv, "mermaid" for .mmd or .mermaid, "graphml" for .graphml, otherwise empty
+func GraphFormatByExt(filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".dot", ".gv":
+		return "dot"
+	case ".mmd", ".mermaid":
+		return "mermaid"
+	case ".graphml":
+		return "graphml"
+	}
+	return ""
+}
+
+// WriteGraphToFile renders cpd (annotated with hosts from cpmd if that is not nil) in the named
+// format, one of "dot", "mermaid", or "graphml", and writes the result to filename
+func WriteGraphToFile(cpd *CompPatternDict, cpmd *CompPatternMapDict, format, filename string) error {
+	var text string
+	switch format {
+	case "dot":
+		text = ExportDOT(cpd, cpmd)
+	case "mermaid":
+		text = ExportMermaid(cpd, cpmd)
+	case "graphml":
+		text = ExportGraphML(cpd, cpmd)
+	default:
+		return fmt.Errorf("graph format %s not in {dot, mermaid, graphml}", format)
+	}
+	return os.WriteFile(filename, []byte(text), 0644)
+}
@@ -0,0 +1,360 @@
+package pces
+
+// file import.go holds importers that build a FuncExecList from the output of benchmarks:
+// `go test -bench` output, CSV files with a header row, and JSON arrays of objects.  Benchmark
+// names are mapped to operation identifier, param, and packet length by a regular expression,
+// and repeated measurements of the same timing are averaged
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultBenchNamePattern maps Go benchmark names such as BenchmarkCrypt/2048/1500-8 or
+// BenchmarkCrypt/keylen=2048/size=1500-8 to op crypt, param 2048, and packet length 1500.
+// Both the param and packet length levels are optional
+var DefaultBenchNamePattern string = `^Benchmark(?P<op>[^/]+?)(?:/(?:\w+=)?(?P<param>[^/]+?))??(?:/(?:\w+=)?(?P<pcktlen>\d+))?(?:-\d+)?$`
+
+// ImportFields are the fields of a timing that an imported CSV or JSON file may give
+var ImportFields []string = []string{"identifier", "param", "cpumodel", "pcktlen", "exectime", "name"}
+
+// ImportOptions direct the translation of benchmark output into timings.
+//
+//	ListName    - the name of the FuncExecList built
+//	CPUModel    - the CPU model of timings whose input does not give one
+//	PcktLen     - the packet length of timings whose input does not give one
+//	NamePattern - a regular expression applied to benchmark names, whose named groups op (or identifier),
+//	              param, pcktlen, and cpumodel give those fields.  DefaultBenchNamePattern if not given
+//	Columns     - for CSV and JSON, the column header (or object key) holding each of ImportFields,
+//	              by field.  A field not named is looked for under its own name.  A name column is
+//	              translated by NamePattern when the input has no identifier column
+//	TimeUnit    - for CSV and JSON, the unit of execution times: s (the default), ms, us, or ns
+type ImportOptions struct {
+	ListName    string
+	CPUModel    string
+	PcktLen     int
+	NamePattern string
+	Columns     map[string]string
+	TimeUnit    string
+
+	nameRE *regexp.Regexp
+}
+
+// importTimeUnits gives the number of each unit an imported time may have in a second
+var importTimeUnits map[string]float64 = map[string]float64{"s": 1.0, "ms": 1e3, "us": 1e6, "ns": 1e9}
+
+// an importedTiming is one measurement read from benchmark output, in seconds
+type importedTiming struct {
+	op, param, cpumodel string
+	pcktLen             int
+	execTime            float64
+}
+
+// nameFields applies the name pattern of the options to a benchmark name and returns the
+// fields given by its named groups, or an error if the name does not match
+func (opts *ImportOptions) nameFields(name string) (map[string]string, error) {
+	pattern := opts.NamePattern
+	if len(pattern) == 0 {
+		pattern = DefaultBenchNamePattern
+	}
+	if opts.nameRE == nil || opts.nameRE.String() != pattern {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("benchmark name pattern %s: %s", pattern, err.Error())
+		}
+		opts.nameRE = re
+	}
+	match := opts.nameRE.FindStringSubmatch(name)
+	if match == nil {
+		return nil, fmt.Errorf("benchmark name %s does not match pattern %s", name, pattern)
+	}
+	fields := make(map[string]string)
+	for idx, group := range opts.nameRE.SubexpNames() {
+		if len(group) > 0 && len(match[idx]) > 0 {
+			fields[group] = match[idx]
+		}
+	}
+	if len(fields["identifier"]) > 0 {
+		fields["op"] = fields["identifier"]
+	}
+	if len(fields["op"]) == 0 {
+		return nil, fmt.Errorf("benchmark name %s gives no op", name)
+	}
+
+	// Go benchmark names must begin with an upper-case letter, operation identifiers need not
+	if strings.HasPrefix(name, "Benchmark") {
+		op := []rune(fields["op"])
+		op[0] = unicode.ToLower(op[0])
+		fields["op"] = string(op)
+	}
+	return fields, nil
+}
+
+// timing builds an importedTiming from the fields given for it, taking the CPU model and
+// packet length of the options when the fields give none
+func (opts *ImportOptions) timing(fields map[string]string, execTime float64) (importedTiming, error) {
+	it := importedTiming{op: fields["op"], param: fields["param"], cpumodel: fields["cpumodel"],
+		pcktLen: opts.PcktLen, execTime: execTime}
+	if len(it.cpumodel) == 0 {
+		it.cpumodel = opts.CPUModel
+	}
+	if len(it.cpumodel) == 0 {
+		return it, fmt.Errorf("timing of %s has no CPU model", it.op)
+	}
+	if len(fields["pcktlen"]) > 0 {
+		pcktLen, err := strconv.Atoi(fields["pcktlen"])
+		if err != nil {
+			return it, fmt.Errorf("timing of %s has packet length %s, which is not an integer", it.op, fields["pcktlen"])
+		}
+		it.pcktLen = pcktLen
+	}
+	if execTime < 0.0 {
+		return it, fmt.Errorf("timing of %s has negative execution time", it.op)
+	}
+	return it, nil
+}
+
+// buildList gathers imported timings into a FuncExecList, averaging repeated measurements of a timing
+func (opts *ImportOptions) buildList(timings []importedTiming) *FuncExecList {
+	listName := opts.ListName
+	if len(listName) == 0 {
+		listName = "imported"
+	}
+	fel := CreateFuncExecList(listName)
+	counts := make(map[string]map[timingKey]int)
+	for _, it := range timings {
+		key := timingKey{it.param, it.cpumodel, it.pcktLen}
+		if counts[it.op] == nil {
+			counts[it.op] = make(map[timingKey]int)
+		}
+		idx := findTiming(fel.Times[it.op], key)
+		if idx < 0 {
+			fel.AddTiming(it.op, it.param, it.cpumodel, it.pcktLen, it.execTime)
+			counts[it.op][key] = 1
+			continue
+		}
+		n := float64(counts[it.op][key])
+		fel.Times[it.op][idx].ExecTime = (n*fel.Times[it.op][idx].ExecTime + it.execTime) / (n + 1.0)
+		counts[it.op][key] += 1
+	}
+	return fel
+}
+
+// ImportGoBench builds a FuncExecList from the output of `go test -bench`, taking the execution time of
+// each benchmark from its ns/op.  Benchmark names are translated by the name pattern of the options, the
+// first letter of the op being lower-cased.  Without a CPU model in the options, the cpu line of the output names it
+func ImportGoBench(dict []byte, opts ImportOptions) (*FuncExecList, error) {
+	timings := []importedTiming{}
+	errs := []error{}
+	for _, line := range strings.Split(string(dict), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[0] == "cpu:" && len(opts.CPUModel) == 0 {
+			opts.CPUModel = strings.Join(fields[1:], " ")
+			continue
+		}
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+
+		nsPerOp := -1.0
+		for idx := 3; idx < len(fields); idx++ {
+			if fields[idx] == "ns/op" {
+				value, err := strconv.ParseFloat(fields[idx-1], 64)
+				if err == nil {
+					nsPerOp = value
+				}
+			}
+		}
+		if nsPerOp < 0.0 {
+			errs = append(errs, fmt.Errorf("benchmark %s reports no ns/op", fields[0]))
+			continue
+		}
+
+		nameFields, err := opts.nameFields(fields[0])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		it, err := opts.timing(nameFields, nsPerOp/importTimeUnits["ns"])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		timings = append(timings, it)
+	}
+	if len(timings) == 0 && len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("no benchmark results found"))
+	}
+
+	err := ReportErrs(errs)
+	if err != nil {
+		return nil, err
+	}
+	return opts.buildList(timings), nil
+}
+
+// ImportCSV builds a FuncExecList from CSV holding a header row and then a timing per row,
+// the columns of the fields of a timing named by the options
+func ImportCSV(dict []byte, opts ImportOptions) (*FuncExecList, error) {
+	rows, err := csv.NewReader(bytes.NewReader(dict)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("CSV input has no timings")
+	}
+	records := make([]map[string]any, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]any)
+		for idx, header := range rows[0] {
+			if idx < len(row) {
+				record[strings.TrimSpace(header)] = strings.TrimSpace(row[idx])
+			}
+		}
+		records = append(records, record)
+	}
+	return opts.importRecords(records)
+}
+
+// ImportJSON builds a FuncExecList from a JSON array of objects, one per timing, the keys of
+// the fields of a timing named by the options
+func ImportJSON(dict []byte, opts ImportOptions) (*FuncExecList, error) {
+	records := []map[string]any{}
+	err := json.Unmarshal(dict, &records)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("JSON input has no timings")
+	}
+	return opts.importRecords(records)
+}
+
+// importRecords translates the records of CSV or JSON input, by field name, into timings
+func (opts *ImportOptions) importRecords(records []map[string]any) (*FuncExecList, error) {
+	unit := opts.TimeUnit
+	if len(unit) == 0 {
+		unit = "s"
+	}
+	perSecond, present := importTimeUnits[unit]
+	if !present {
+		return nil, fmt.Errorf("time unit %s is not one of s, ms, us, ns", unit)
+	}
+	for _, field := range sortedKeys(opts.Columns) {
+		if !isImportField(field) {
+			return nil, fmt.Errorf("column given for %s, which is not one of %s", field, strings.Join(ImportFields, ", "))
+		}
+	}
+
+	timings := []importedTiming{}
+	errs := []error{}
+	for idx, record := range records {
+		fields := make(map[string]string)
+		for _, field := range ImportFields {
+			column, present := opts.Columns[field]
+			if !present {
+				column = field
+			}
+			value, present := record[column]
+			if present && value != nil {
+				fields[field] = fmt.Sprintf("%v", value)
+			}
+		}
+
+		// an operation is given by an identifier, or by a name to which the name pattern is applied
+		if len(fields["identifier"]) == 0 && len(fields["name"]) > 0 {
+			nameFields, err := opts.nameFields(fields["name"])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("record %d: %s", idx+1, err.Error()))
+				continue
+			}
+			for field, value := range nameFields {
+				if len(fields[field]) == 0 {
+					fields[field] = value
+				}
+			}
+		} else {
+			fields["op"] = fields["identifier"]
+		}
+		if len(fields["op"]) == 0 {
+			errs = append(errs, fmt.Errorf("record %d gives no identifier or name", idx+1))
+			continue
+		}
+
+		execTime, err := strconv.ParseFloat(fields["exectime"], 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("record %d has execution time %q, which is not a number", idx+1, fields["exectime"]))
+			continue
+		}
+		it, err := opts.timing(fields, execTime/perSecond)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("record %d: %s", idx+1, err.Error()))
+			continue
+		}
+		timings = append(timings, it)
+	}
+
+	err := ReportErrs(errs)
+	if err != nil {
+		return nil, err
+	}
+	return opts.buildList(timings), nil
+}
+
+// isImportField is true if the field is one of ImportFields
+func isImportField(field string) bool {
+	for _, name := range ImportFields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeImported merges imported timings into those the named funcExec file gives itself, as Overlay does,
+// and returns the list to write back to it.  The timings of the files it includes are not merged in, and its
+// include list is kept.  An error is returned if a merged timing differs from one given by an included file,
+// since the file written could then no longer be read
+func MergeImported(filename string, useYAML bool, imported *FuncExecList) (*FuncExecList, error) {
+	dict, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	fel, err := decodeFuncExecList(filename, useYAML, dict)
+	if err != nil {
+		return nil, err
+	}
+	if fel.Times == nil {
+		fel.Times = make(map[string][]FuncExecDesc)
+	}
+	err = fel.Overlay(imported)
+	if err != nil {
+		return nil, err
+	}
+	if len(fel.Include) == 0 {
+		return fel, nil
+	}
+
+	// resolve the includes of a copy, leaving the list written as the file gives it
+	check := *fel
+	check.Times = make(map[string][]FuncExecDesc)
+	for op, fedList := range fel.Times {
+		check.Times[op] = slices.Clone(fedList)
+	}
+	check.Models = maps.Clone(fel.Models)
+	check.Derived = maps.Clone(fel.Derived)
+	err = check.resolveIncludes(filename, nil)
+	if err != nil {
+		return nil, fmt.Errorf("merged timings conflict with those included by %s: %s", filename, err.Error())
+	}
+	return fel, nil
+}
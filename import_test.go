@@ -0,0 +1,225 @@
+package pces
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// importedTimings returns the timings of a list as op, param, CPU model, packet length, and execution time
+func importedTimings(fel *FuncExecList) []string {
+	timings := []string{}
+	for _, op := range sortedKeys(fel.Times) {
+		for _, fed := range fel.Times[op] {
+			timings = append(timings, fmt.Sprintf("%s %q %s %d %g", op, fed.Param, fed.CPUModel, fed.PcktLen, fed.ExecTime))
+		}
+	}
+	return timings
+}
+
+func TestImportNameMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		opts   ImportOptions
+		want   []string
+	}{
+		{
+			name:   "go bench param and packet length levels, cpu line",
+			format: "gobench",
+			input:  "cpu: Xeon E5\nBenchmarkCrypt/2048/1500-8   1000   1500 ns/op\n",
+			want:   []string{`crypt "2048" Xeon E5 1500 1.5e-06`},
+		},
+		{
+			name:   "go bench levels written as key=value",
+			format: "gobench",
+			input:  "BenchmarkCrypt/keylen=2048/size=1500-8   1000   1500 ns/op\n",
+			opts:   ImportOptions{CPUModel: "x86"},
+			want:   []string{`crypt "2048" x86 1500 1.5e-06`},
+		},
+		{
+			name:   "go bench op alone, options give the rest over the cpu line",
+			format: "gobench",
+			input:  "cpu: Xeon E5\nBenchmarkHash-8   1000   500 ns/op   64 B/op\n",
+			opts:   ImportOptions{CPUModel: "x86", PcktLen: 64},
+			want:   []string{`hash "" x86 64 5e-07`},
+		},
+		{
+			name:   "go bench repeated runs averaged",
+			format: "gobench",
+			input:  "BenchmarkHash/64-8   1000   1000 ns/op\nBenchmarkHash/64-8   1000   2000 ns/op\n",
+			opts:   ImportOptions{CPUModel: "x86"},
+			want:   []string{`hash "" x86 64 1.5e-06`},
+		},
+		{
+			name:   "go bench own name pattern",
+			format: "gobench",
+			input:  "BenchmarkHash_64_arm   1000   500 ns/op\n",
+			opts:   ImportOptions{NamePattern: `^Benchmark(?P<op>\w+?)_(?P<pcktlen>\d+)_(?P<cpumodel>\w+)$`},
+			want:   []string{`hash "" arm 64 5e-07`},
+		},
+		{
+			name:   "csv columns named, times in ms",
+			format: "csv",
+			input:  "Op, Key, Size, Mean\ncrypt, aes, 1500, 2.0\nhash, , 64, 0.5\n",
+			opts: ImportOptions{CPUModel: "x86", TimeUnit: "ms",
+				Columns: map[string]string{"identifier": "Op", "param": "Key", "pcktlen": "Size", "exectime": "Mean"}},
+			want: []string{`crypt "aes" x86 1500 0.002`, `hash "" x86 64 0.0005`},
+		},
+		{
+			name:   "csv name column translated by the name pattern",
+			format: "csv",
+			input:  "name,cpumodel,exectime\nBenchmarkCrypt/aes/1500,arm,0.003\n",
+			want:   []string{`crypt "aes" arm 1500 0.003`},
+		},
+		{
+			name:   "json keys by field name, numbers and strings",
+			format: "json",
+			input:  `[{"identifier": "crypt", "cpumodel": "x86", "pcktlen": 1500, "exectime": 1500}]`,
+			opts:   ImportOptions{TimeUnit: "us"},
+			want:   []string{`crypt "" x86 1500 0.0015`},
+		},
+		{
+			name:   "json name key, its fields not overriding those given",
+			format: "json",
+			input:  `[{"bench": "BenchmarkCrypt/aes/1500", "pcktlen": "64", "exectime": 0.001}]`,
+			opts:   ImportOptions{CPUModel: "x86", Columns: map[string]string{"name": "bench"}},
+			want:   []string{`crypt "aes" x86 64 0.001`},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fel, err := importAs(tc.format, tc.input, tc.opts)
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			got := importedTimings(fel)
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("imported %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		opts   ImportOptions
+		errStr string
+	}{
+		{"go bench without results", "gobench", "PASS\n", ImportOptions{}, "no benchmark results found"},
+		{"go bench without ns/op", "gobench", "BenchmarkHash-8   1000   64 B/op\n", ImportOptions{CPUModel: "x86"},
+			"benchmark BenchmarkHash-8 reports no ns/op"},
+		{"go bench name not matched", "gobench", "BenchmarkHash-8   1000   500 ns/op\n",
+			ImportOptions{CPUModel: "x86", NamePattern: `^Benchmark(?P<op>\w+)_(?P<pcktlen>\d+)$`}, "does not match pattern"},
+		{"no CPU model", "gobench", "BenchmarkHash-8   1000   500 ns/op\n", ImportOptions{}, "timing of hash has no CPU model"},
+		{"csv packet length not an integer", "csv", "identifier,cpumodel,pcktlen,exectime\nhash,x86,large,0.1\n",
+			ImportOptions{}, "record 1: timing of hash has packet length large, which is not an integer"},
+		{"csv time not a number", "csv", "identifier,cpumodel,exectime\nhash,x86,fast\n",
+			ImportOptions{}, `record 1 has execution time "fast", which is not a number`},
+		{"csv column of an unknown field", "csv", "identifier,cpumodel,exectime\nhash,x86,0.1\n",
+			ImportOptions{Columns: map[string]string{"duration": "exectime"}}, "column given for duration"},
+		{"json unknown time unit", "json", `[{"identifier": "hash", "cpumodel": "x86", "exectime": 1}]`,
+			ImportOptions{TimeUnit: "min"}, "time unit min is not one of"},
+		{"json without an op", "json", `[{"cpumodel": "x86", "exectime": 1}]`,
+			ImportOptions{}, "record 1 gives no identifier or name"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := importAs(tc.format, tc.input, tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+				t.Errorf("import error = %v, want one containing %q", err, tc.errStr)
+			}
+		})
+	}
+}
+
+// importAs imports the input with the importer of the named format
+func importAs(format, input string, opts ImportOptions) (*FuncExecList, error) {
+	switch format {
+	case "gobench":
+		return ImportGoBench([]byte(input), opts)
+	case "csv":
+		return ImportCSV([]byte(input), opts)
+	}
+	return ImportJSON([]byte(input), opts)
+}
+
+func TestMergeImported(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, body string) string {
+		filename := filepath.Join(dir, name)
+		err := os.WriteFile(filename, []byte(body), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	writeFile("arm.yaml", "listname: arm\ntimes:\n  crypt:\n    - {cpumodel: arm, pcktlen: 1000, exectime: 0.002}\n")
+
+	tests := []struct {
+		name     string
+		target   string
+		cpuModel string
+		imported float64
+		want     []string
+		errStr   string
+	}{
+		{
+			name:     "own timing replaced",
+			target:   "listname: base\ntimes:\n  crypt:\n    - {cpumodel: x86, pcktlen: 1000, exectime: 0.001}\n",
+			cpuModel: "x86",
+			imported: 0.003,
+			want:     []string{`crypt "" x86 1000 0.003`},
+		},
+		{
+			name: "includes kept and not flattened",
+			target: "listname: base\ninclude: [arm.yaml]\n" +
+				"times:\n  crypt:\n    - {cpumodel: x86, pcktlen: 1000, exectime: 0.001}\n",
+			cpuModel: "x86",
+			imported: 0.003,
+			want:     []string{`crypt "" x86 1000 0.003`},
+		},
+		{
+			name: "timing differing from an included one refused",
+			target: "listname: base\ninclude: [arm.yaml]\n" +
+				"times:\n  crypt:\n    - {cpumodel: x86, pcktlen: 1000, exectime: 0.001}\n",
+			cpuModel: "arm",
+			imported: 0.004,
+			errStr:   "merged timings conflict with those included by",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filename := writeFile("base.yaml", tc.target)
+			imported := CreateFuncExecList("imported")
+			imported.AddTiming("crypt", "", tc.cpuModel, 1000, tc.imported)
+
+			fel, err := MergeImported(filename, true, imported)
+			if tc.errStr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+					t.Errorf("MergeImported error = %v, want one containing %q", err, tc.errStr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeImported: %v", err)
+			}
+			got := importedTimings(fel)
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("merged %q, want %q", got, tc.want)
+			}
+			if strings.Contains(tc.target, "include:") && (len(fel.Include) != 1 || fel.Include[0] != "arm.yaml") {
+				t.Errorf("merged include list %v, want [arm.yaml]", fel.Include)
+			}
+		})
+	}
+}
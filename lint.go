@@ -0,0 +1,301 @@
+package pces
+
+// file lint.go holds static checks of a model's comp pattern, initialization, timing, and map
+// descriptions, made without building the mrnes network or running the simulation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// lintFunc gathers what the linter needs to know about one function
+type lintFunc struct {
+	ptnName string
+	label   string
+	class   string
+	cfgStr  string
+	cfg     map[string]any
+}
+
+// LintModel examines the model descriptions and returns one error for every structural problem found:
+//   - functions that cannot be reached from any start (or bckgrndLd) function
+//   - start functions from which no finish function can be reached
+//   - edges whose message type is not declared in the Msgs of the pattern's CPInitList
+//   - msg2mc entries naming method codes the function's class does not have
+//   - transfer functions whose xcp/xlabel target does not exist
+//   - srvReq functions whose srvop is not offered in any Services table
+//   - op codes that have no timing for any CPU model
+//   - map entries that are missing, malformed, or name unknown patterns or functions
+//   - shared cfg groups of ssgl (which may be nil) that are incoherent with the comp patterns
+//
+// Members of shared cfg groups are checked with the cfg of their group.
+// Reachability follows pattern edges, external edges, transfer targets, and service requests
+func LintModel(cpd *CompPatternDict, cpid *CPInitListDict, ssgl *SharedCfgGroupList, fel *FuncExecList,
+	cpmd *CompPatternMapDict) []error {
+	errs := []error{}
+
+	funcs := make(map[string]*lintFunc)
+	names := []string{}
+	for _, ptnName := range sortedPtnNames(cpd) {
+		_, present := cpid.InitList[ptnName]
+		if !present {
+			errs = append(errs, fmt.Errorf("comp pattern %s has no initialization list", ptnName))
+		}
+		for _, fnc := range cpd.Patterns[ptnName].Funcs {
+			name := ptnName + ":" + fnc.Label
+			cfgStr := funcCfgStr(cpid, ssgl, ptnName, fnc.Label)
+			funcs[name] = &lintFunc{ptnName: ptnName, label: fnc.Label, class: fnc.Class,
+				cfgStr: cfgStr, cfg: decodeCfg(cfgStr)}
+			names = append(names, name)
+		}
+	}
+
+	// services offered by every pattern, and check that they name functions that exist
+	offered := make(map[string]map[string]string)
+	for _, ptnName := range sortedPtnNames(cpd) {
+		offered[ptnName] = make(map[string]string)
+		for srvOp, srvDesc := range cpd.Patterns[ptnName].Services {
+			srvCP := srvDesc.CP
+			if len(srvCP) == 0 {
+				srvCP = ptnName
+			}
+			target := srvCP + ":" + srvDesc.Label
+			if funcs[target] == nil {
+				errs = append(errs, fmt.Errorf("comp pattern %s offers service %s by %s, which does not exist",
+					ptnName, srvOp, target))
+				continue
+			}
+			offered[ptnName][srvOp] = target
+		}
+	}
+
+	// successors of every function
+	succ := make(map[string][]string)
+	addSucc := func(src, dst string) {
+		if funcs[src] != nil && funcs[dst] != nil {
+			succ[src] = append(succ[src], dst)
+		}
+	}
+
+	for _, ptnName := range sortedPtnNames(cpd) {
+		cpt := cpd.Patterns[ptnName]
+		msgs := declaredMsgTypes(cpid, ptnName)
+
+		for _, edge := range cpt.Edges {
+			src, dst := ptnName+":"+edge.SrcLabel, ptnName+":"+edge.DstLabel
+			if funcs[src] == nil || funcs[dst] == nil {
+				errs = append(errs, fmt.Errorf("comp pattern %s has edge %s -> %s naming a function it does not have",
+					ptnName, edge.SrcLabel, edge.DstLabel))
+				continue
+			}
+			if !msgs[edge.MsgType] {
+				errs = append(errs, fmt.Errorf("comp pattern %s edge %s -> %s carries message type %s, not declared in its msgs",
+					ptnName, edge.SrcLabel, edge.DstLabel, edge.MsgType))
+			}
+			addSucc(src, dst)
+		}
+
+		for _, xedge := range cpt.ExtEdges {
+			src, dst := xedge.SrcCP+":"+xedge.SrcLabel, xedge.DstCP+":"+xedge.DstLabel
+			if funcs[src] == nil || funcs[dst] == nil {
+				errs = append(errs, fmt.Errorf("comp pattern %s has external edge %s -> %s naming a function that does not exist",
+					ptnName, src, dst))
+				continue
+			}
+			if !declaredMsgTypes(cpid, xedge.SrcCP)[xedge.MsgType] && !declaredMsgTypes(cpid, xedge.DstCP)[xedge.MsgType] {
+				errs = append(errs, fmt.Errorf("external edge %s -> %s carries message type %s, not declared in the msgs of either pattern",
+					src, dst, xedge.MsgType))
+			}
+			addSucc(src, dst)
+		}
+	}
+
+	for _, name := range names {
+		lf := funcs[name]
+
+		_, present := ClassMethods[lf.class]
+		if !present {
+			errs = append(errs, fmt.Errorf("function %s has unrecognized class %s", name, lf.class))
+			continue
+		}
+
+		msg2mc, _ := lf.cfg["msg2mc"].(map[string]any)
+		for _, msgType := range sortedKeys(msg2mc) {
+			mc, _ := msg2mc[msgType].(string)
+			if !checkMCValidity(lf.class, mc) {
+				errs = append(errs, fmt.Errorf("function %s maps message type %s to method code %s, which class %s does not have",
+					name, msgType, mc, lf.class))
+			}
+		}
+
+		switch lf.class {
+		case "transfer":
+			target, err := lintTransfer(name, lf, funcs)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			addSucc(name, target)
+		case "srvReq":
+			target, err := lintSrvReq(name, lf, funcs, offered)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			addSucc(name, target)
+		}
+	}
+
+	// reachability from the functions that originate work
+	reached := make(map[string]bool)
+	for _, name := range names {
+		lf := funcs[name]
+		if lf.class != "start" && lf.class != "bckgrndLd" {
+			continue
+		}
+		visited := lintReach(name, succ)
+		foundFinish := false
+		for visit := range visited {
+			reached[visit] = true
+			if funcs[visit].class == "finish" {
+				foundFinish = true
+			}
+		}
+		if lf.class == "start" && !foundFinish {
+			errs = append(errs, fmt.Errorf("start function %s cannot reach a finish function", name))
+		}
+	}
+	for _, name := range names {
+		if !reached[name] {
+			errs = append(errs, fmt.Errorf("function %s is not reachable from any start function", name))
+		}
+	}
+
+	// every op code used needs some timing
+	for _, name := range names {
+		fo := cfgOpCodes(funcs[name].cfgStr)
+		for _, op := range append(append([]string{}, fo.hostOps...), fo.accelOps...) {
+			if len(fel.Times[op]) == 0 {
+				errs = append(errs, fmt.Errorf("function %s uses op %s, which has no timings", name, op))
+			}
+		}
+	}
+
+	errs = append(errs, checkMapStructure(cpd, cpmd)...)
+	errs = append(errs, sharedCfgGroupErrs(cpd, cpid, ssgl)...)
+	return errs
+}
+
+// lintTransfer checks the destination of a transfer function, returning its global name
+func lintTransfer(name string, lf *lintFunc, funcs map[string]*lintFunc) (string, error) {
+	xcp, _ := lf.cfg["xcp"].(string)
+	xlabel, _ := lf.cfg["xlabel"].(string)
+	carried, _ := lf.cfg["carried"].(int)
+
+	if len(xcp) == 0 && len(xlabel) == 0 {
+		if carried == 0 {
+			return "", fmt.Errorf("transfer function %s names no destination and does not take one from the message", name)
+		}
+		return "", nil
+	}
+	target := xcp + ":" + xlabel
+	if funcs[target] == nil {
+		return "", fmt.Errorf("transfer function %s targets %s, which does not exist", name, target)
+	}
+	return target, nil
+}
+
+// lintSrvReq checks the service a srvReq function requests, returning the global name of the
+// function that provides it when that can be determined statically
+func lintSrvReq(name string, lf *lintFunc, funcs map[string]*lintFunc, offered map[string]map[string]string) (string, error) {
+	srvCP, _ := lf.cfg["srvcp"].(string)
+	srvOp, _ := lf.cfg["srvop"].(string)
+	srvLabel, _ := lf.cfg["srvlabel"].(string)
+
+	if len(srvCP) > 0 {
+		_, present := offered[srvCP]
+		if !present {
+			return "", fmt.Errorf("srvReq function %s names server comp pattern %s, which does not exist", name, srvCP)
+		}
+	}
+
+	if len(srvLabel) > 0 {
+		cp := srvCP
+		if len(cp) == 0 {
+			cp = lf.ptnName
+		}
+		target := cp + ":" + srvLabel
+		if funcs[target] == nil {
+			return "", fmt.Errorf("srvReq function %s names server %s, which does not exist", name, target)
+		}
+		return target, nil
+	}
+
+	if len(srvOp) == 0 {
+		return "", fmt.Errorf("srvReq function %s names neither a service nor a server", name)
+	}
+
+	// the service op prefix is the key to the services table, as at run-time
+	op := strings.Split(srvOp, "-")[0]
+	if len(srvCP) > 0 {
+		target, present := offered[srvCP][op]
+		if !present {
+			return "", fmt.Errorf("srvReq function %s requests service %s, which comp pattern %s does not offer",
+				name, op, srvCP)
+		}
+		return target, nil
+	}
+
+	// without a server pattern the request goes to the pattern that called, unknown statically.
+	// Prefer the requester's own pattern, otherwise any pattern offering the service
+	target, present := offered[lf.ptnName][op]
+	if present {
+		return target, nil
+	}
+	for _, ptnName := range sortedKeys(offered) {
+		target, present = offered[ptnName][op]
+		if present {
+			return target, nil
+		}
+	}
+	return "", fmt.Errorf("srvReq function %s requests service %s, which no comp pattern offers", name, op)
+}
+
+// lintReach returns the set of functions reachable from the named one, itself included
+func lintReach(start string, succ map[string][]string) map[string]bool {
+	visited := map[string]bool{start: true}
+	frontier := []string{start}
+	for len(frontier) > 0 {
+		name := frontier[0]
+		frontier = frontier[1:]
+		for _, nxt := range succ[name] {
+			if !visited[nxt] {
+				visited[nxt] = true
+				frontier = append(frontier, nxt)
+			}
+		}
+	}
+	return visited
+}
+
+// declaredMsgTypes returns the set of message types declared in the initialization list of a pattern
+func declaredMsgTypes(cpid *CPInitListDict, ptnName string) map[string]bool {
+	msgs := make(map[string]bool)
+	cpil, present := cpid.InitList[ptnName]
+	if !present {
+		return msgs
+	}
+	for _, msg := range cpil.Msgs {
+		msgs[msg.MsgType] = true
+	}
+	return msgs
+}
+
+// sortedKeys returns the keys of a string-indexed map, sorted
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
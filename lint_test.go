@@ -0,0 +1,138 @@
+package pces
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintModel(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList)
+		errStr []string
+	}{
+		{name: "valid", setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {}},
+		{
+			name: "no initialization list",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				delete(cpid.InitList, "chain1")
+			},
+			errStr: []string{"comp pattern chain1 has no initialization list"},
+		},
+		{
+			name: "edge naming a function the pattern does not have",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpt := cpd.Patterns["chain1"]
+				cpt.Edges = append(cpt.Edges, CmpPtnGraphEdge{SrcLabel: "proc", MsgType: "req", DstLabel: "tap"})
+				cpd.Patterns["chain1"] = cpt
+			},
+			errStr: []string{"comp pattern chain1 has edge proc -> tap naming a function it does not have"},
+		},
+		{
+			name: "message type not declared",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpd.Patterns["chain1"].Edges[0].MsgType = "ack"
+			},
+			errStr: []string{"comp pattern chain1 edge src -> proc carries message type ack, not declared in its msgs"},
+		},
+		{
+			name: "unrecognized class",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpd.Patterns["chain1"].Funcs[1].Class = "nosuch"
+			},
+			errStr: []string{"function chain1:proc has unrecognized class nosuch"},
+		},
+		{
+			name: "method code the class does not have",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpid.InitList["chain1"].Cfg["proc"] = "timingcode: {req: crypt}\nmsg2mc: {req: bogus}"
+			},
+			errStr: []string{"function chain1:proc maps message type req to method code bogus, which class processPckt does not have"},
+		},
+		{
+			name: "chain broken after the start",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpt := cpd.Patterns["chain1"]
+				cpt.Edges = cpt.Edges[1:]
+				cpd.Patterns["chain1"] = cpt
+			},
+			errStr: []string{"start function chain1:src cannot reach a finish function",
+				"function chain1:proc is not reachable from any start function",
+				"function chain1:sink is not reachable from any start function"},
+		},
+		{
+			name: "op without timings",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				delete(fel.Times, "hash")
+			},
+			errStr: []string{"function chain1:hash uses op hash, which has no timings"},
+		},
+		{
+			name: "transfer to a function that does not exist",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpd.Patterns["chain1"].Funcs[2].Class = "transfer"
+				cpid.InitList["chain1"].Cfg["hash"] = "xcp: chain1\nxlabel: tap"
+			},
+			errStr: []string{"transfer function chain1:hash targets chain1:tap, which does not exist"},
+		},
+		{
+			name: "transfer with no destination",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpd.Patterns["chain1"].Funcs[2].Class = "transfer"
+				cpid.InitList["chain1"].Cfg["hash"] = "{}"
+			},
+			errStr: []string{"transfer function chain1:hash names no destination"},
+		},
+		{
+			name: "service no pattern offers",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpd.Patterns["chain1"].Funcs[2].Class = "srvReq"
+				cpid.InitList["chain1"].Cfg["hash"] = "srvop: lookup-v4"
+			},
+			errStr: []string{"srvReq function chain1:hash requests service lookup, which no comp pattern offers"},
+		},
+		{
+			name: "service of a pattern that does not exist",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpd.Patterns["chain1"].Funcs[2].Class = "srvReq"
+				cpid.InitList["chain1"].Cfg["hash"] = "srvcp: chain9\nsrvop: lookup"
+			},
+			errStr: []string{"srvReq function chain1:hash names server comp pattern chain9, which does not exist"},
+		},
+		{
+			name: "service offered by the pattern",
+			setup: func(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList) {
+				cpt := cpd.Patterns["chain1"]
+				cpt.Funcs[2].Class = "srvReq"
+				cpt.AddService("lookup", "sink")
+				cpid.InitList["chain1"].Cfg["hash"] = "srvop: lookup-v4"
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpd, cpid, fel, cpmd := testModel(t)
+			tc.setup(cpd, cpid, fel)
+			errs := LintModel(cpd, cpid, nil, fel, cpmd)
+			if len(tc.errStr) == 0 {
+				for _, err := range errs {
+					t.Errorf("LintModel: %v", err)
+				}
+				return
+			}
+			for _, errStr := range tc.errStr {
+				found := false
+				for _, err := range errs {
+					if strings.Contains(err.Error(), errStr) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("LintModel errors = %v, want one containing %q", errs, errStr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package pces
+
+// file migrate.go holds structs, methods, and event handlers that move
+// an instantiated comp pattern function from one host to another while
+// the simulation is running
+
+import (
+	"fmt"
+	"github.com/iti/evt/evtm"
+	"github.com/iti/evt/vrtime"
+	"github.com/iti/mrnes"
+	"strconv"
+)
+
+// MigrationCost describes the penalty paid for moving a function between hosts.
+// Downtime is the time (in seconds) the function is suspended after its state has arrived
+// at the new host, StateSize is the number of bytes of state carried through the network
+// from the old host to the new one.  A zero StateSize means no state transfer is simulated.
+type MigrationCost struct {
+	Downtime  float64 `json:"downtime" yaml:"downtime"`
+	StateSize int     `json:"statesize" yaml:"statesize"`
+}
+
+// MigrationRecord remembers what happened when a function was migrated, for post-run reporting
+type MigrationRecord struct {
+	PtnName   string  // name of the comp pattern holding the migrated function
+	Label     string  // label of the migrated function
+	SrcHost   string  // host the function ran on before migration
+	DstHost   string  // host the function runs on after migration
+	Start     float64 // simulation time when the migration started
+	Finish    float64 // simulation time when the function resumed on DstHost
+	StateSize int     // bytes of state transferred
+	Lost      bool    // true if the network lost the state transfer
+	Held      int     // number of arrivals held while the function was suspended
+}
+
+// Migrations lists every migration started, in order of starting time
+var Migrations []*MigrationRecord = make([]*MigrationRecord, 0)
+
+// migrationReq carries the parameters of a scheduled migration to the event handler that starts it
+type migrationReq struct {
+	cpfi    *CmpPtnFuncInst
+	dstHost string
+	cost    MigrationCost
+	rec     *MigrationRecord
+}
+
+// FuncInstByName returns the run-time representation of the function with the given label
+// in the comp pattern with the given name
+func FuncInstByName(ptnName, label string) (*CmpPtnFuncInst, error) {
+	cpi, present := CmpPtnInstByName[ptnName]
+	if !present {
+		return nil, fmt.Errorf("comp pattern %s not recognized", ptnName)
+	}
+	cpfi, present := cpi.Funcs[label]
+	if !present {
+		return nil, fmt.Errorf("comp pattern %s has no function with label %s", ptnName, label)
+	}
+	return cpfi, nil
+}
+
+// checkMigration returns an error if the destination host is not recognized or the cost is negative
+func checkMigration(cpfi *CmpPtnFuncInst, dstHost string, cost MigrationCost) error {
+	_, present := mrnes.EndptDevByName[dstHost]
+	if !present {
+		return fmt.Errorf("migration of %s to unrecognized host %s", cpfi.GlobalName(), dstHost)
+	}
+	if cost.Downtime < 0.0 || cost.StateSize < 0 {
+		return fmt.Errorf("migration of %s given negative cost", cpfi.GlobalName())
+	}
+	return nil
+}
+
+// ScheduleFuncMigration arranges for the function identified by (ptnName, label) to be
+// moved to host dstHost at simulation time 'when' (in seconds), paying the given migration cost
+func ScheduleFuncMigration(evtMgr *evtm.EventManager, ptnName, label, dstHost string, when float64,
+	cost MigrationCost) error {
+
+	cpfi, err := FuncInstByName(ptnName, label)
+	if err != nil {
+		return err
+	}
+
+	err = checkMigration(cpfi, dstHost, cost)
+	if err != nil {
+		return err
+	}
+
+	delay := when - evtMgr.CurrentSeconds()
+	if delay < 0.0 {
+		return fmt.Errorf("migration of %s scheduled at %f, in the past", cpfi.GlobalName(), when)
+	}
+
+	mr := &migrationReq{cpfi: cpfi, dstHost: dstHost, cost: cost}
+	evtMgr.Schedule(mr, nil, startMigration, vrtime.SecondsToTime(delay))
+	return nil
+}
+
+// MigrateFunc starts the migration of a function to host dstHost immediately
+func MigrateFunc(evtMgr *evtm.EventManager, cpfi *CmpPtnFuncInst, dstHost string, cost MigrationCost) error {
+	err := checkMigration(cpfi, dstHost, cost)
+	if err != nil {
+		return err
+	}
+	if cpfi.Migrating {
+		return fmt.Errorf("migration of %s requested while already migrating", cpfi.GlobalName())
+	}
+
+	mr := &migrationReq{cpfi: cpfi, dstHost: dstHost, cost: cost}
+	startMigration(evtMgr, mr, nil)
+	return nil
+}
+
+// startMigration is an event handler that suspends the function and
+// either launches the state transfer through the network or waits out the downtime
+func startMigration(evtMgr *evtm.EventManager, context any, data any) any {
+	mr := context.(*migrationReq)
+	cpfi := mr.cpfi
+
+	// a migration already underway takes precedence
+	if cpfi.Migrating {
+		fmt.Printf("Warning, migration of %s to %s ignored, already migrating\n", cpfi.GlobalName(), mr.dstHost)
+		return nil
+	}
+
+	mr.rec = &MigrationRecord{PtnName: cpfi.PtnName, Label: cpfi.Label, SrcHost: cpfi.Host,
+		DstHost: mr.dstHost, Start: evtMgr.CurrentSeconds(), StateSize: mr.cost.StateSize}
+	Migrations = append(Migrations, mr.rec)
+
+	cpfi.Migrating = true
+
+	endpt := mrnes.EndptDevByName[cpfi.Host]
+	AddCPTrace(TraceMgr, cpfi.Trace, evtMgr.CurrentTime(), 0, endpt.DevID(), FullFuncName(cpfi, "startMigration"), nil)
+
+	// nothing to carry, or nowhere to carry it, means we only wait out the downtime
+	if mr.cost.StateSize == 0 || cpfi.Host == mr.dstHost {
+		evtMgr.Schedule(mr, nil, finishMigration, vrtime.SecondsToTime(mr.cost.Downtime))
+		return nil
+	}
+
+	// push the state through the network as a discrete message
+	connDesc := new(mrnes.ConnDesc)
+	connDesc.Type = mrnes.DiscreteConn
+	connDesc.Action = mrnes.None
+	if netportal.QkNetSim {
+		connDesc.Latency = mrnes.Place
+	} else {
+		connDesc.Latency = mrnes.Simulate
+	}
+
+	execID := NewExecID(cpfi.PtnName, cpfi.Label)
+	IDs := mrnes.NetMsgIDs{ExecID: execID}
+
+	rtnDesc := &mrnes.RtnDesc{Cxt: mr, EvtHdlr: migrationStateArrived}
+	lossDesc := &mrnes.RtnDesc{Cxt: mr, EvtHdlr: migrationStateLost}
+	rtns := mrnes.RtnDescs{Rtn: rtnDesc, Src: nil, Dst: nil, Loss: lossDesc}
+
+	msg := &CmpPtnMsg{ExecID: execID, MsgType: "migrate", MsgLen: mr.cost.StateSize, PcktLen: mr.cost.StateSize}
+	netportal.EnterNetwork(evtMgr, cpfi.Host, mr.dstHost, mr.cost.StateSize, connDesc, IDs, rtns, 0.0, 0, msg)
+	return nil
+}
+
+// migrationStateArrived is scheduled by mrnes when the function state reaches the new host
+func migrationStateArrived(evtMgr *evtm.EventManager, context any, data any) any {
+	mr := context.(*migrationReq)
+	evtMgr.Schedule(mr, nil, finishMigration, vrtime.SecondsToTime(mr.cost.Downtime))
+	return nil
+}
+
+// migrationStateLost is scheduled by mrnes when the state transfer is lost.  The migration
+// still completes (the state is assumed re-sent out of band), but the loss is recorded
+func migrationStateLost(evtMgr *evtm.EventManager, context any, data any) any {
+	mr := context.(*migrationReq)
+	mr.rec.Lost = true
+	evtMgr.Schedule(mr, nil, finishMigration, vrtime.SecondsToTime(mr.cost.Downtime))
+	return nil
+}
+
+// finishMigration binds the function to its new host, updates the comp pattern map
+// to reflect the move, and releases whatever arrived while the function was suspended
+func finishMigration(evtMgr *evtm.EventManager, context any, data any) any {
+	mr := context.(*migrationReq)
+	cpfi := mr.cpfi
+
+	cpfi.Host = mr.dstHost
+	cpfi.Migrating = false
+
+	// keep the map consistent with the run-time assignment, so that
+	// anything consulting it sees the new host.  Replicas do not appear in the map
+	if CmpPtnMapDict != nil && cpfi.Replica == 0 {
+		ptnMap, present := CmpPtnMapDict.Map[cpfi.PtnName]
+		if present {
+			priStr := strconv.Itoa(cpfi.Priority)
+			ptnMap.FuncMap[cpfi.Label] = cpfi.Host + "," + priStr
+		}
+	}
+
+	mr.rec.Finish = evtMgr.CurrentSeconds()
+	mr.rec.Held = len(cpfi.Held)
+
+	endpt := mrnes.EndptDevByName[cpfi.Host]
+	AddCPTrace(TraceMgr, cpfi.Trace, evtMgr.CurrentTime(), 0, endpt.DevID(), FullFuncName(cpfi, "finishMigration"), nil)
+
+	// re-deliver held arrivals in the order they arrived
+	held := cpfi.Held
+	cpfi.Held = make([]any, 0)
+	for _, cpMsg := range held {
+		evtMgr.Schedule(cpfi, cpMsg, EnterFunc, vrtime.SecondsToTime(0.0))
+	}
+	return nil
+}
+
+// ReportMigrations prints a summary of the migrations performed during the run
+func ReportMigrations() {
+	for _, rec := range Migrations {
+		lost := ""
+		if rec.Lost {
+			lost = ", state transfer lost"
+		}
+		fmt.Printf("Migration of %s:%s from %s to %s started %f finished %f, %d bytes state, %d held%s\n",
+			rec.PtnName, rec.Label, rec.SrcHost, rec.DstHost, rec.Start, rec.Finish, rec.StateSize, rec.Held, lost)
+	}
+}
@@ -0,0 +1,153 @@
+package pces
+
+// file parallel.go holds the simulation of operations that run on several cores at once.
+// Following Amdahl's law, the execution time of such an operation has a serial part, run on
+// one core, and a parallel part divided evenly among its threads, each scheduled as its own task
+// on the cores of the host (or accelerator).  The operation completes when its last thread does,
+// so threads that find no free core wait, and the speedup realized depends on the load
+
+import (
+	"fmt"
+	"github.com/iti/evt/evtm"
+	"github.com/iti/mrnes"
+	"math"
+	"strconv"
+)
+
+// A ParallelRecord accumulates the executions of a function whose operations run on several cores.
+//
+//	Threads      - number of cores each execution occupies in its parallel part
+//	ParallelFrac - fraction of the execution time divided among the threads
+//	CoreTime     - sum of the time cores were occupied by the operations.  Dividing an operation
+//	               among threads leaves this the time the operation would take on one core
+//	Elapsed      - sum of the times from the start of each operation to its completion.  Time spent
+//	               waiting for a core before an operation starts is left out, that its threads
+//	               spend waiting once it has started is not
+type ParallelRecord struct {
+	Func         string
+	Threads      int
+	ParallelFrac float64
+	Executions   int
+	CoreTime     float64
+	Elapsed      float64
+}
+
+// ParallelRecords holds a record for every function and number of threads its operations ran as,
+// in the order of their first execution
+var ParallelRecords []*ParallelRecord = make([]*ParallelRecord, 0)
+
+var parallelRecordIdx map[string]int = make(map[string]int)
+
+// a parallelExec follows one execution of an operation through its serial part and its threads
+type parallelExec struct {
+	cpfi       *CmpPtnFuncInst
+	scheduler  *mrnes.TaskScheduler
+	acct       *CPUAccount
+	methodCode string
+	msg        *CmpPtnMsg
+	execID     int
+	endPtID    int
+	threads    int
+	genTime    float64 // execution time of the operation on one core
+	partTime   float64 // execution time of each thread
+	remaining  int     // threads not yet complete
+	started    float64 // time the operation started on a core
+	rec        *ParallelRecord
+}
+
+// parallelism returns the number of threads an operation of the function runs as, and the fraction
+// of its execution time divided among them.  Given only a parallel fraction, the threads are the
+// cores of the host; given only threads, the whole of the time is divided
+func (pp *ProcessPcktCfg) parallelism(host string) (int, float64) {
+	threads, frac := pp.Threads, pp.ParallelFrac
+	if threads == 0 && frac > 0.0 && len(pp.AccelName) == 0 {
+		threads = mrnes.EndptDevByName[host].EndptCores
+	}
+	if threads <= 1 {
+		return 1, 0.0
+	}
+	if frac == 0.0 {
+		frac = 1.0
+	}
+	return threads, frac
+}
+
+// parallelRecord returns the record of the function running as the given number of threads, creating it
+// on the first such execution.  A function moved to a host with a different number of cores gets a new record
+func parallelRecord(cpfi *CmpPtnFuncInst, threads int, frac float64) *ParallelRecord {
+	name := cpfi.primary().GlobalName()
+	key := name + "/" + strconv.Itoa(threads)
+	idx, present := parallelRecordIdx[key]
+	if !present {
+		idx = len(ParallelRecords)
+		parallelRecordIdx[key] = idx
+		ParallelRecords = append(ParallelRecords, &ParallelRecord{Func: name, Threads: threads, ParallelFrac: frac})
+	}
+	return ParallelRecords[idx]
+}
+
+// scheduleParallel schedules an operation of execution time genTime as a serial part followed by
+// threads that each run its parallel part divided by their number.  When the last thread completes
+// processPcktExit is called, as the scheduler calls it for a serial operation
+func scheduleParallel(evtMgr *evtm.EventManager, cpfi *CmpPtnFuncInst, scheduler *mrnes.TaskScheduler,
+	acct *CPUAccount, methodCode string, genTime float64, threads int, frac float64, msg *CmpPtnMsg, execID, endPtID int) {
+
+	pe := &parallelExec{cpfi: cpfi, scheduler: scheduler, acct: acct, methodCode: methodCode, msg: msg, execID: execID,
+		endPtID: endPtID, threads: threads, genTime: genTime, partTime: genTime * frac / float64(threads),
+		remaining: threads, started: math.Inf(1), rec: parallelRecord(cpfi, threads, frac)}
+
+	serialTime := genTime * (1.0 - frac)
+	if serialTime > 0.0 {
+		acct.schedule(evtMgr, scheduler, methodCode, serialTime, cpfi.Priority, pe, msg, execID, endPtID, parallelFork)
+		return
+	}
+	pe.fork(evtMgr)
+}
+
+// fork schedules the threads of the parallel part of the operation
+func (pe *parallelExec) fork(evtMgr *evtm.EventManager) {
+	for idx := 0; idx < pe.threads; idx++ {
+		pe.acct.schedule(evtMgr, pe.scheduler, pe.methodCode, pe.partTime, pe.cpfi.Priority,
+			pe, pe.msg, pe.execID, pe.endPtID, parallelJoin)
+	}
+}
+
+// parallelFork is an event handler called when the serial part of an operation completes
+func parallelFork(evtMgr *evtm.EventManager, context any, data any) any {
+	pe := context.(*parallelExec)
+
+	// tasks are never preempted, so the serial part started as long before now as it ran
+	pe.started = evtMgr.CurrentSeconds() - pe.genTime*(1.0-pe.rec.ParallelFrac)
+	pe.fork(evtMgr)
+	return nil
+}
+
+// parallelJoin is an event handler called when a thread of an operation completes.  The last
+// to complete finishes the operation
+func parallelJoin(evtMgr *evtm.EventManager, context any, data any) any {
+	pe := context.(*parallelExec)
+	now := evtMgr.CurrentSeconds()
+	pe.started = min(pe.started, now-pe.partTime)
+	pe.remaining -= 1
+	if pe.remaining > 0 {
+		return nil
+	}
+	pe.rec.Executions += 1
+	pe.rec.CoreTime += pe.genTime
+	pe.rec.Elapsed += now - pe.started
+	return processPcktExit(evtMgr, pe.cpfi, data)
+}
+
+// ReportParallelism prints, for every function whose operations ran on several cores, the core time its
+// operations occupied and the time they took, and so the speedup realized (which is also the average
+// number of cores occupied while an operation was under way), beside the speedup Amdahl's law gives
+func ReportParallelism() {
+	for _, rec := range ParallelRecords {
+		if !(rec.Elapsed > 0.0) {
+			continue
+		}
+		ideal := 1.0 / ((1.0 - rec.ParallelFrac) + rec.ParallelFrac/float64(rec.Threads))
+		fmt.Printf("Parallel %s: %d executions on up to %d cores, parallel fraction %g, %g core seconds in %g seconds, speedup %.3f (ideal %.3f)\n",
+			rec.Func, rec.Executions, rec.Threads, rec.ParallelFrac, rec.CoreTime, rec.Elapsed, rec.CoreTime/rec.Elapsed, ideal)
+	}
+}
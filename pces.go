@@ -27,9 +27,11 @@ var netportal *mrnes.NetworkPortal
 // CmpPtnMapDict is a global variable that holds a description of the mapping of CmpPtn function instances to hosts
 var CmpPtnMapDict *CompPatternMapDict
 
-var funcExecTimeTbl map[string]map[string]map[int]float64
+var funcExecTimeTbl execTimeTbl
 var nameToSharedCfg map[string]any
 var funcInstToSharedCfg map[GlobalFuncID]any
+var funcInstToSharedGroup map[GlobalFuncID]*SharedCfgGroup
+var sharedCfgUseYAML bool
 
 // A CmpPtnGraph is the run-time description of a CompPattern
 type CmpPtnGraph struct {
@@ -175,18 +177,33 @@ func buildCmpPtns(cpd *CompPatternDict, cpid *CPInitListDict, ssgl *SharedCfgGro
 		createSrvFuncLinks(cp)
 	}
 
-	// after all the patterns have been built, create their edge tables
-	buildAllEdgeTables(cpd)
+	// after all the patterns have been built, create their edge tables and check the cfgs
+	errList = append(errList, buildAllEdgeTables(cpd)...)
 
 	return ReportErrs(errList)
 }
 
-// buildFuncExecTimeTbl creates a very nested map that stores information
-// about comp pattern function execution times.  The keys in order of application are
+// execTimeTbl is a very nested map that stores information about comp pattern function
+// execution times.  The keys in order of application are
 //
-//	map[operation] -> map[hardware] -> map[message length] -> execution time
-func buildFuncExecTimeTbl(fel *FuncExecList) map[string]map[string]map[int]float64 {
-	et := make(map[string]map[string]map[int]float64)
+//	map[operation] -> map[hardware] -> map[param] -> map[packet length] -> execution time
+type execTimeTbl map[string]map[string]map[string]map[int]float64
+
+// lookup returns the execution times by packet length of an operation on a hardware model with
+// the given param.  Timings given without a param serve any param for which there are none of its own,
+// and when no param is asked for, the timings of the one param given serve
+func (et execTimeTbl) lookup(op, model, param string) (map[int]float64, bool) {
+	params, present := et[op][model]
+	if !present {
+		return nil, false
+	}
+	return lookupParam(params, param)
+}
+
+// buildFuncExecTimeTbl creates the table of execution times of comp pattern functions from the timings read in,
+// and those derived from them
+func buildFuncExecTimeTbl(fel *FuncExecList) execTimeTbl {
+	et := make(execTimeTbl)
 
 	// loop over the primary key, function type
 	for operation, mapList := range fel.Times {
@@ -194,25 +211,33 @@ func buildFuncExecTimeTbl(fel *FuncExecList) map[string]map[string]map[int]float
 		// make sure that we've initialized a map for the map[operation] value
 		_, present := et[operation]
 		if !present {
-			et[operation] = make(map[string]map[int]float64)
+			et[operation] = make(map[string]map[string]map[int]float64)
 		}
 
 		// given the function class, the associated mapList is a list of
-		// structs that associate attribute information (cpu type, packet len) with the execution time
+		// structs that associate attribute information (cpu type, param, packet len) with the execution time
 		for _, funcExecDesc := range mapList {
 			cpumodel := funcExecDesc.CPUModel
+			param := funcExecDesc.Param
 			pcktLen := funcExecDesc.PcktLen
-			execTime := funcExecDesc.ExecTime
+			execTime := timingMean(&funcExecDesc)
 
-			// use the cpuType and pckLen attributes to flesh out the execution time table
+			// use the cpuType, param, and pckLen attributes to flesh out the execution time table
 			_, present := et[operation][cpumodel]
 			if !present {
-				et[operation][cpumodel] = make(map[int]float64)
+				et[operation][cpumodel] = make(map[string]map[int]float64)
+			}
+			_, present = et[operation][cpumodel][param]
+			if !present {
+				et[operation][cpumodel][param] = make(map[int]float64)
 			}
 
-			et[operation][cpumodel][pcktLen] = execTime
+			et[operation][cpumodel][param][pcktLen] = execTime
 		}
 	}
+
+	// CPU models derived from others take scaled timings of operations not measured on them
+	deriveModels(et, fel, scaleExecTimes)
 	return et
 }
 
@@ -258,26 +283,65 @@ func ContinueBuildExperimentCP(cpd *CompPatternDict, cpid *CPInitListDict,
 		panic("empty dictionary")
 	}
 
-	// N.B. ssgl may be empty if there are no functions with shared cfg
 	NumIDs = idCounter
 	TraceMgr = tm
 
 	// remember the mapping of functions to host
 	CmpPtnMapDict = cpmd
 
+	// distributions of execution times must be well-formed if times are drawn from them
+	err := fel.CheckDists()
+	if err != nil {
+		return err
+	}
+
+	// as must the CPU models whose timings are derived from others
+	err = fel.CheckDerived()
+	if err != nil {
+		return err
+	}
+	reportDerivedTimings(DerivedTimings(fel))
+
 	// build the tables used to look up the execution time of comp pattern functions, and device operations
 	funcExecTimeTbl = buildFuncExecTimeTbl(fel)
+	funcExecDistTbl = buildFuncExecDistTbl(fel)
 
-	var ssgl *SharedCfgGroupList
-	buildSharedCfgMaps(ssgl, true)
+	// fit the timing model selected for each operation to its timings
+	funcTimingModelTbl, _, err = fitTimingModels(fel, funcExecTimeTbl)
+	if err != nil {
+		return err
+	}
+
+	// functions may share cfg across comp patterns, as described by an optional shared cfg file
+	ssgl, err := getSharedCfgGroups(syn)
+	if err != nil {
+		return err
+	}
+	err = checkSharedCfgGroups(cpd, cpid, ssgl)
+	if err != nil {
+		return err
+	}
+	buildSharedCfgMaps(ssgl)
 
-	err := buildCmpPtns(cpd, cpid, ssgl, evtMgr)
+	// check the mapping against the topology and the timings before anything is built on it
+	err = ValidateCompPatternMap(cpd, cpid, ssgl, fel, cpmd)
+	if err != nil {
+		return err
+	}
 
-	// check the coherence of the shared cfg groups
-	if ssgl != nil {
-		checkSharedCfgAssignment(ssgl)
+	// cfgs written as nested objects are checked against the schemas of their classes,
+	// and decoded into the cfg types of those classes
+	err = checkNativeCfgs(cpd, cpid)
+	if err != nil {
+		return err
+	}
+	err = decodeNativeCfgs(cpd, cpid)
+	if err != nil {
+		return err
 	}
 
+	err = buildCmpPtns(cpd, cpid, ssgl, evtMgr)
+
 	// initialize background computation traces on endpoints that use that
 	mrnes.InitializeBckgrnd(evtMgr)
 
@@ -308,7 +372,7 @@ func GetExperimentCPDicts(syn map[string]string) (*CompPatternDict, *CPInitListD
 	var err error
 
 	// we allow some variation in input names, so apply fixup if needed
-	checkFields := []string{"cpInput", "cpInitInput", "funcExecInput", "mapInput"}
+	checkFields := []string{"cpInput", "cpInitInput", "funcExecInput", "mapInput", "templatesInput", "sharedCfgInput"}
 	for _, filename := range checkFields {
 		trimmed := strings.Replace(filename, "Input", "", -1)
 		_, present := syn[trimmed]
@@ -317,37 +381,18 @@ func GetExperimentCPDicts(syn map[string]string) (*CompPatternDict, *CPInitListD
 		}
 	}
 
-	var useYAML bool
-	ext := path.Ext(syn["cpInput"])
-	useYAML = (ext == ".yaml") || (ext == ".yml")
-
-	cpd, err = ReadCompPatternDict(syn["cpInput"], useYAML, empty)
+	// the comp pattern, initialization, and timing inputs may each name a base file followed by overlays
+	cpd, err = ReadCompPatternDictLayers(LayerFiles(syn["cpInput"]))
 	errs = append(errs, err)
 
-	ext = path.Ext(syn["cpInitInput"])
-	useYAML = (ext == ".yaml") || (ext == ".yml")
-
-	cpid, err = ReadCPInitListDict(syn["cpInitInput"], useYAML, empty)
+	cpid, err = ReadCPInitListDictLayers(LayerFiles(syn["cpInitInput"]))
 	errs = append(errs, err)
 
-	/*
-		scgl := nil
-		if len(syn["sharedCfg"]) > 0 {
-			ext = path.Ext(syn["sharedCfg"])
-			useYAML = (ext == ".yaml") || (ext == ".yml")
-
-			scgl, err = ReadSharedCfgGroupList(syn["sharedCfg"], useYAML, empty)
-			errs = append(errs, err)
-		}
-	*/
-
-	ext = path.Ext(syn["funcExecInput"])
-	useYAML = (ext == ".yaml") || (ext == ".yml")
-
-	fel, err = ReadFuncExecList(syn["funcExecInput"], useYAML, empty)
+	fel, err = ReadFuncExecListLayers(LayerFiles(syn["funcExecInput"]))
 	errs = append(errs, err)
 
-	ext = path.Ext(syn["mapInput"])
+	var useYAML bool
+	ext := path.Ext(syn["mapInput"])
 	useYAML = (ext == ".yaml") || (ext == ".yml")
 
 	cpmd, err = ReadCompPatternMapDict(syn["mapInput"], useYAML, empty)
@@ -358,29 +403,142 @@ func GetExperimentCPDicts(syn map[string]string) (*CompPatternDict, *CPInitListD
 		panic(err)
 	}
 
+	// expand comp pattern templates, if any, into additional patterns, initialization lists, and maps
+	if len(syn["templatesInput"]) > 0 {
+		ext = path.Ext(syn["templatesInput"])
+		useYAML = (ext == ".yaml") || (ext == ".yml")
+
+		td, err := ReadTemplateDict(syn["templatesInput"], useYAML, empty)
+		if err == nil {
+			err = td.Expand(cpd, cpid, cpmd)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	return cpd, cpid, fel, cpmd
 }
 
-// buildSharedCfgMaps fills out two maps used to initialize funcs with shared cfg.
+// getSharedCfgGroups reads the shared cfg group list named in syn, returning nil if none is named
+func getSharedCfgGroups(syn map[string]string) (*SharedCfgGroupList, error) {
+	filename := syn["sharedCfgInput"]
+	if len(filename) == 0 {
+		filename = syn["sharedCfg"]
+	}
+	if len(filename) == 0 {
+		return nil, nil
+	}
+	ext := path.Ext(filename)
+	useYAML := (ext == ".yaml") || (ext == ".yml")
+	return ReadSharedCfgGroupList(filename, useYAML, []byte{})
+}
+
+// checkSharedCfgGroups ensures that the shared cfg groups are coherent with the comp patterns
+// before anything is built from them:  every group has a unique name, a registered class, and a cfg
+// that is valid for the class, and every member exists, has the class of its group, belongs to no other
+// group, and has no cfg of its own in the initialization list.  All problems found are reported together
+func checkSharedCfgGroups(cpd *CompPatternDict, cpid *CPInitListDict, ssgl *SharedCfgGroupList) error {
+	return ReportErrs(sharedCfgGroupErrs(cpd, cpid, ssgl))
+}
+
+// sharedCfgGroupErrs returns an error for every problem checkSharedCfgGroups looks for
+func sharedCfgGroupErrs(cpd *CompPatternDict, cpid *CPInitListDict, ssgl *SharedCfgGroupList) []error {
+	errs := []error{}
+	if ssgl == nil {
+		return errs
+	}
+	groupNames := make(map[string]bool)
+	memberOf := make(map[GlobalFuncID]string)
+
+	// shared cfg groups in *ssgl are listed in unordered sequence
+	for _, ssg := range ssgl.Groups {
+		if len(ssg.Name) == 0 {
+			errs = append(errs, fmt.Errorf("shared cfg group of class %s has no name", ssg.Class))
+		} else if groupNames[ssg.Name] {
+			errs = append(errs, fmt.Errorf("shared cfg group name %s is used twice", ssg.Name))
+		}
+		groupNames[ssg.Name] = true
+
+		_, present := FuncClasses[ssg.Class]
+		if !present {
+			errs = append(errs, fmt.Errorf("shared cfg group %s has unrecognized class %s", ssg.Name, ssg.Class))
+			continue
+		}
+		errs = append(errs, ValidateCfgString(ssg.Class, ssg.CfgStr, "sharedCfg."+ssg.Name)...)
+
+		if len(ssg.Instances) == 0 {
+			errs = append(errs, fmt.Errorf("shared cfg group %s has no members", ssg.Name))
+		}
+
+		// check all the functions with shared cfg in the same group
+		for _, gfid := range ssg.Instances {
+			funcName := gfid.CmpPtnName + ":" + gfid.Label
+			cpt, present := cpd.Patterns[gfid.CmpPtnName]
+			if !present {
+				errs = append(errs, fmt.Errorf("comp pattern name %s from shared cfg group %s not found",
+					gfid.CmpPtnName, ssg.Name))
+				continue
+			}
+			class := ""
+			for _, fnc := range cpt.Funcs {
+				if fnc.Label == gfid.Label {
+					class = fnc.Class
+					break
+				}
+			}
+			if len(class) == 0 {
+				errs = append(errs, fmt.Errorf("function label %s from shared cfg group %s not found in comp pattern %s",
+					gfid.Label, ssg.Name, gfid.CmpPtnName))
+				continue
+			}
+
+			// the class of the func instance needs to be the class of the shared cfg group
+			if class != ssg.Class {
+				errs = append(errs, fmt.Errorf("function %s has class %s but shared cfg group %s has class %s",
+					funcName, class, ssg.Name, ssg.Class))
+			}
+			other, present := memberOf[gfid]
+			if present {
+				errs = append(errs, fmt.Errorf("function %s is a member of shared cfg groups %s and %s",
+					funcName, other, ssg.Name))
+			}
+			memberOf[gfid] = ssg.Name
+
+			if len(strings.TrimSpace(cpid.InitList[gfid.CmpPtnName].Cfg[gfid.Label])) > 0 {
+				errs = append(errs, fmt.Errorf("function %s has a cfg of its own and is a member of shared cfg group %s",
+					funcName, ssg.Name))
+			}
+		}
+	}
+	return errs
+}
+
+// buildSharedCfgMaps fills out the maps used to initialize funcs with shared cfg.
 // The read-in list of shared cfg groups (if any) are examined
 // to create the initial set up of the shared cfg, create one map that, given the name of the
-// shared cfg group returns a pointer to that state, and another which given the (cmpPtnName, label)
-// of a function that has shared cfg, a pointer to that state.
-func buildSharedCfgMaps(ssgl *SharedCfgGroupList, useYAML bool) {
+// shared cfg group returns a pointer to that state, another which given the (cmpPtnName, label)
+// of a function that has shared cfg, a pointer to that state, and a third which given the (cmpPtnName, label)
+// gives the group.  The groups are expected to have passed checkSharedCfgGroups
+func buildSharedCfgMaps(ssgl *SharedCfgGroupList) {
 
 	// map index is the shared cfg group identity
 	nameToSharedCfg = make(map[string]any)
 
 	// map index is struct whose first member is name of a comp pattern, and the second one is the label within
 	funcInstToSharedCfg = make(map[GlobalFuncID]any)
+	funcInstToSharedGroup = make(map[GlobalFuncID]*SharedCfgGroup)
+	sharedCfgUseYAML = true
 
 	// if there are no shared cfg groups we can leave now that the maps above are initialized to be empty
 	if ssgl == nil {
 		return
 	}
+	sharedCfgUseYAML = ssgl.UseYAML
 
 	// the shared cfg groups are simply listed
-	for _, ssg := range ssgl.Groups {
+	for idx := range ssgl.Groups {
+		ssg := &ssgl.Groups[idx]
 
 		// get a pointer to the class
 		fc := FuncClasses[ssg.Class]
@@ -394,40 +552,7 @@ func buildSharedCfgMaps(ssgl *SharedCfgGroupList, useYAML bool) {
 		for _, gfid := range ssg.Instances {
 			// given the (cmpPtnName, label) identity, get a pointer to the state structure
 			funcInstToSharedCfg[gfid] = cfg
-		}
-	}
-}
-
-// checkSharedCfgAssignment ensures that every function instance in a
-// shared cfg group has the same class
-func checkSharedCfgAssignment(ssgl *SharedCfgGroupList) {
-
-	// shared cfg groups in *ssgl are listed in unordered sequence
-	for _, ssg := range ssgl.Groups {
-
-		// check all the functions with shared cfg in the same group
-		for _, gfid := range ssg.Instances {
-
-			// pull out the function's comp pattern label
-			ptnName := gfid.CmpPtnName
-			label := gfid.Label
-
-			// find representation of the comp pattern instance
-			cpInst, present := CmpPtnInstByName[ptnName]
-			if !present {
-				panic(fmt.Errorf("comp pattern name %s from shared cfg group %s not found", ptnName, ssg.Name))
-			}
-
-			// find representation of the comp pattern's function
-			cpf, present := cpInst.Funcs[label]
-			if !present {
-				panic(fmt.Errorf("function label %s from shared cfg group %s not found", label, ssg.Name))
-			}
-
-			// the class of the func instance needs to be the class of the shared cfg group
-			if cpf.Class != ssg.Class {
-				panic(fmt.Errorf("(%s,%s) from shared cfg group %s suffers class mismatch", ptnName, label, ssg.Name))
-			}
+			funcInstToSharedGroup[gfid] = ssg
 		}
 	}
 }
@@ -0,0 +1,71 @@
+package pces
+
+import (
+	"github.com/iti/mrnes"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// closeTo reports whether got is within a small relative tolerance of want
+func closeTo(got, want float64) bool {
+	return math.Abs(got-want) <= 1e-9*math.Max(1.0, math.Abs(want))
+}
+
+// testModelBuilder starts the model the tests share, a chain of four functions, src, proc, hash, and sink,
+// all mapped to hostA.  proc and hash run timed operations: crypt, timed on the CPU models x86 and arm,
+// and hash, timed only on x86
+func testModelBuilder() *ModelBuilder {
+	mb := CreateModelBuilder("test")
+	mb.Pattern("chain", "chain1").
+		Msg("req", true).
+		Msg("rsp", true).
+		Func("start", "src", &StartCfg{PcktLen: 1000, MsgLen: 1000, MsgType: "req"}).
+		Func("processPckt", "proc", &ProcessPcktCfg{TimingCode: map[string]string{"req": "crypt"},
+			Msg2Msg: map[string]string{"req": "req"}}).
+		Func("processPckt", "hash", &ProcessPcktCfg{TimingCode: map[string]string{"req": "hash"},
+			Msg2Msg: map[string]string{"req": "rsp"}}).
+		Func("finish", "sink", &FinishCfg{}).
+		Edge("src", "req", "proc").
+		Edge("proc", "req", "hash").
+		Edge("hash", "rsp", "sink").
+		MapAll("hostA", 1)
+	mb.Timing("crypt", "", "x86", 1000, 1.0e-3)
+	mb.Timing("crypt", "", "arm", 1000, 2.0e-3)
+	mb.Timing("hash", "", "x86", 1000, 0.5e-3)
+	return mb
+}
+
+// testModel builds the model of testModelBuilder
+func testModel(t *testing.T) (*CompPatternDict, *CPInitListDict, *FuncExecList, *CompPatternMapDict) {
+	t.Helper()
+	cpd, cpid, fel, cpmd, err := testModelBuilder().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cpd, cpid, fel, cpmd
+}
+
+// testTopo returns the topology the tests share: hostA and hostB of CPU model x86, with 2 and 4 cores,
+// hostA having a gpu accelerator of model tesla, and hostC of CPU model arm, with 2 cores
+func testTopo() *mrnes.TopoCfg {
+	return &mrnes.TopoCfg{Name: "topo", Endpts: []mrnes.EndptDesc{
+		{Name: "hostA", Model: "x86", Cores: 2, Accel: map[string]string{"gpu": "tesla"}},
+		{Name: "hostB", Model: "x86", Cores: 4},
+		{Name: "hostC", Model: "arm", Cores: 2},
+	}}
+}
+
+// loadTestTopo loads testTopo into mrnes, so that its endpoints are known by name
+func loadTestTopo(t *testing.T) {
+	t.Helper()
+	topoFile := filepath.Join(t.TempDir(), "topo.yaml")
+	err := testTopo().WriteToFile(topoFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mrnes.LoadTopo(topoFile, 0, mrnes.CreateTraceManager("test", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,626 @@
+package pces
+
+// file placement.go holds the optimizer that chooses a host for every comp pattern function,
+// producing a CompPatternMapDict from the model description, the function timings, and the topology
+
+import (
+	"fmt"
+	"github.com/iti/mrnes"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+	"math"
+	"sort"
+	"strings"
+)
+
+// PlacementEstimate summarizes the quality of a placement as the optimizer sees it
+type PlacementEstimate struct {
+	Latency  float64            // estimated execution plus communication time
+	MaxLoad  float64            // largest HostLoad
+	HostLoad map[string]float64 // estimated execution cost placed on a host, relative to its capacity
+	Cut      int                // number of edges (and affinity pairs) whose end points are on different hosts
+}
+
+// placeFunc describes one function being placed
+type placeFunc struct {
+	ptnName string
+	label   string
+	ops     funcOps // operation codes the function's timings are looked up with
+	unit    int     // index of the placeUnit holding the function
+}
+
+// placeUnit is a set of functions that the constraints require to be on the same host
+type placeUnit struct {
+	members  []int              // indices of member functions
+	pin      string             // host the unit is pinned to, if any
+	cost     map[string]float64 // summed execution cost of the members, on each feasible host
+	feasible []string           // hosts on which every member has timings
+	anti     []int              // units that may not share a host with this one
+}
+
+// placer carries the state of one run of the optimizer
+type placer struct {
+	spec     *PlacementSpec
+	hosts    []string
+	capacity map[string]float64
+	funcs    []*placeFunc
+	units    []*placeUnit
+	links    [][2]int // pairs of units charged CommCost when on different hosts
+	assign   []string // host assigned to each unit, empty if not yet assigned
+}
+
+// funcOps lists the operation codes whose timings a function looks up, separated
+// by whether they run on the host CPU or on an accelerator of the host, and the
+// params its cfg selects among the timings of each op
+type funcOps struct {
+	hostOps  []string
+	accelOps []string
+	accel    string              // name of the accelerator accelOps run on
+	params   map[string][]string // params given for an op, empty string for none
+}
+
+// opParams returns the params with which the function looks up the timings of an op
+func (fo funcOps) opParams(op string) []string {
+	if len(fo.params[op]) == 0 {
+		return []string{""}
+	}
+	return fo.params[op]
+}
+
+// count returns the number of operations listed
+func (fo funcOps) count() int {
+	return len(fo.hostOps) + len(fo.accelOps)
+}
+
+// decodeCfg deserializes a func cfg into a generic map, so that its fields may be examined
+// without knowing the func's class.  Either yaml or json serialization is accepted, as yaml is
+// a superset of json.  An empty or malformed cfg gives an empty map
+func decodeCfg(cfgStr string) map[string]any {
+	cfg := make(map[string]any)
+	if len(cfgStr) == 0 {
+		return cfg
+	}
+	err := yaml.Unmarshal([]byte(cfgStr), &cfg)
+	if err != nil {
+		return make(map[string]any)
+	}
+	return cfg
+}
+
+// cfgOpCodes extracts from a serialized func cfg the operation codes whose timings
+// the function will look up: the values of a timingcode map, which run on the accelerator
+// named by accelname if there is one, and an rspop, which runs on the host.
+// Either yaml or json serialization is accepted
+func cfgOpCodes(cfgStr string) funcOps {
+	fo := funcOps{hostOps: []string{}, accelOps: []string{}, params: make(map[string][]string)}
+	cfg := decodeCfg(cfgStr)
+	fo.accel, _ = cfg["accelname"].(string)
+
+	addParam := func(op, param string) {
+		if !slices.Contains(fo.params[op], param) {
+			fo.params[op] = append(fo.params[op], param)
+		}
+	}
+	addOp := func(ops []string, op string) []string {
+		if len(op) == 0 || isNOP(op) || slices.Contains(ops, op) {
+			return ops
+		}
+		return append(ops, op)
+	}
+	tp, _ := cfg["timingparam"].(map[string]any)
+
+	tc, ok := cfg["timingcode"].(map[string]any)
+	if ok {
+		msgTypes := make([]string, 0, len(tc))
+		for msgType := range tc {
+			msgTypes = append(msgTypes, msgType)
+		}
+		sort.Strings(msgTypes)
+		for _, msgType := range msgTypes {
+			op, isStr := tc[msgType].(string)
+			if !isStr {
+				continue
+			}
+			param, _ := tp[msgType].(string)
+			addParam(op, param)
+			if len(fo.accel) > 0 {
+				fo.accelOps = addOp(fo.accelOps, op)
+			} else {
+				fo.hostOps = addOp(fo.hostOps, op)
+			}
+		}
+	}
+
+	rspOp, ok := cfg["rspop"].(string)
+	if ok {
+		rspParam, _ := cfg["rspparam"].(string)
+		addParam(rspOp, rspParam)
+		fo.hostOps = addOp(fo.hostOps, rspOp)
+	}
+	return fo
+}
+
+// PlaceFuncs chooses a host for every function of every comp pattern in cpd, respecting the constraints
+// of the spec and seeking to optimize its objective.  Function execution costs are estimated from the
+// op codes found in the cfgs of cpid and the timings of fel, on the CPU (or accelerator) models of the topology.
+// An initial greedy assignment is improved by a local search that moves and swaps functions between hosts
+func PlaceFuncs(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList, topo *mrnes.TopoCfg,
+	spec *PlacementSpec) (*CompPatternMapDict, *PlacementEstimate, error) {
+
+	if spec.Objective != "latency" && spec.Objective != "balance" {
+		return nil, nil, fmt.Errorf("placement objective %s not in {latency, balance}", spec.Objective)
+	}
+
+	pl, err := createPlacer(cpd, cpid, fel, topo, spec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = pl.greedy()
+	if err != nil {
+		return nil, nil, err
+	}
+	pl.localSearch()
+
+	cpmd := CreateCompPatternMapDict(spec.Name)
+	errs := []error{}
+	for _, ptnName := range sortedPtnNames(cpd) {
+		cpm := CreateCompPatternMap(ptnName)
+		for _, pf := range pl.funcs {
+			if pf.ptnName == ptnName {
+				err = cpm.AddMapping(pf.label, pl.assign[pf.unit], float64(spec.Priority), true)
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		err = cpmd.AddCompPatternMap(cpm, true)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err = ReportErrs(errs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cpmd, pl.estimate(), nil
+}
+
+// sortedPtnNames returns the names of the patterns in cpd, in sorted order
+func sortedPtnNames(cpd *CompPatternDict) []string {
+	names := make([]string, 0, len(cpd.Patterns))
+	for name := range cpd.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// createPlacer gathers the functions, resolves the constraints into units, and
+// computes the execution cost of each unit on each candidate host
+func createPlacer(cpd *CompPatternDict, cpid *CPInitListDict, fel *FuncExecList, topo *mrnes.TopoCfg,
+	spec *PlacementSpec) (*placer, error) {
+
+	pl := &placer{spec: spec, capacity: make(map[string]float64)}
+	errs := []error{}
+
+	// candidate hosts and their capacities
+	endpts := make(map[string]mrnes.EndptDesc)
+	for _, endpt := range topo.Endpts {
+		endpts[endpt.Name] = endpt
+	}
+	if len(spec.Hosts) > 0 {
+		for _, host := range spec.Hosts {
+			_, present := endpts[host]
+			if !present {
+				errs = append(errs, fmt.Errorf("placement candidate host %s not in topology", host))
+				continue
+			}
+			pl.hosts = append(pl.hosts, host)
+		}
+	} else {
+		for _, endpt := range topo.Endpts {
+			pl.hosts = append(pl.hosts, endpt.Name)
+		}
+	}
+	for _, host := range pl.hosts {
+		capacity, present := spec.Capacity[host]
+		if !present {
+			capacity = float64(max(endpts[host].Cores, 1))
+		}
+		if !(capacity > 0.0) {
+			errs = append(errs, fmt.Errorf("placement capacity of host %s must be positive", host))
+		}
+		pl.capacity[host] = capacity
+	}
+	if len(pl.hosts) == 0 {
+		errs = append(errs, fmt.Errorf("no candidate hosts for placement"))
+	}
+
+	// the functions, in a fixed order so that results are repeatable
+	funcIdx := make(map[string]int)
+	for _, ptnName := range sortedPtnNames(cpd) {
+		cpt := cpd.Patterns[ptnName]
+		cpil := cpid.InitList[ptnName]
+		for _, fnc := range cpt.Funcs {
+			pf := &placeFunc{ptnName: ptnName, label: fnc.Label, ops: cfgOpCodes(cpil.Cfg[fnc.Label])}
+			funcIdx[ptnName+":"+fnc.Label] = len(pl.funcs)
+			pl.funcs = append(pl.funcs, pf)
+		}
+	}
+
+	lookup := func(funcName, context string) (int, bool) {
+		idx, present := funcIdx[funcName]
+		if !present {
+			errs = append(errs, fmt.Errorf("placement %s names unknown function %s", context, funcName))
+		}
+		return idx, present
+	}
+
+	// co-location groups merge functions into units
+	parent := make([]int, len(pl.funcs))
+	for idx := range parent {
+		parent[idx] = idx
+	}
+	var find func(int) int
+	find = func(idx int) int {
+		if parent[idx] != idx {
+			parent[idx] = find(parent[idx])
+		}
+		return parent[idx]
+	}
+	for _, group := range spec.Colocate {
+		first := -1
+		for _, funcName := range group {
+			idx, present := lookup(funcName, "colocate group")
+			if !present {
+				continue
+			}
+			if first < 0 {
+				first = idx
+				continue
+			}
+			parent[find(idx)] = find(first)
+		}
+	}
+
+	unitOf := make(map[int]int)
+	for idx, pf := range pl.funcs {
+		root := find(idx)
+		uidx, present := unitOf[root]
+		if !present {
+			uidx = len(pl.units)
+			unitOf[root] = uidx
+			pl.units = append(pl.units, &placeUnit{cost: make(map[string]float64)})
+		}
+		pf.unit = uidx
+		pl.units[uidx].members = append(pl.units[uidx].members, idx)
+	}
+
+	// pins apply to the whole unit
+	pinNames := make([]string, 0, len(spec.Pin))
+	for funcName := range spec.Pin {
+		pinNames = append(pinNames, funcName)
+	}
+	sort.Strings(pinNames)
+	for _, funcName := range pinNames {
+		host := spec.Pin[funcName]
+		idx, present := lookup(funcName, "pin")
+		if !present {
+			continue
+		}
+		if !slices.Contains(pl.hosts, host) {
+			errs = append(errs, fmt.Errorf("function %s pinned to host %s, not a candidate host", funcName, host))
+			continue
+		}
+		pu := pl.units[pl.funcs[idx].unit]
+		if len(pu.pin) > 0 && pu.pin != host {
+			errs = append(errs, fmt.Errorf("function %s pinned to %s, but co-located with a function pinned to %s",
+				funcName, host, pu.pin))
+			continue
+		}
+		pu.pin = host
+	}
+
+	// anti-affinity relates units
+	for _, group := range spec.AntiAffinity {
+		units := []int{}
+		for _, funcName := range group {
+			idx, present := lookup(funcName, "anti-affinity group")
+			if !present {
+				continue
+			}
+			uidx := pl.funcs[idx].unit
+			for _, other := range units {
+				if other == uidx {
+					errs = append(errs, fmt.Errorf("function %s is required both to share and not to share a host",
+						funcName))
+				}
+			}
+			units = append(units, uidx)
+		}
+		for _, u := range units {
+			for _, v := range units {
+				if u != v {
+					pl.units[u].anti = append(pl.units[u].anti, v)
+				}
+			}
+		}
+	}
+
+	// graph edges, and pairs from affinity groups, are charged when split
+	for _, ptnName := range sortedPtnNames(cpd) {
+		cpt := cpd.Patterns[ptnName]
+		for _, edge := range cpt.Edges {
+			src, srcOK := funcIdx[ptnName+":"+edge.SrcLabel]
+			dst, dstOK := funcIdx[ptnName+":"+edge.DstLabel]
+			if srcOK && dstOK {
+				pl.links = append(pl.links, [2]int{pl.funcs[src].unit, pl.funcs[dst].unit})
+			}
+		}
+		for _, xedge := range cpt.ExtEdges {
+			src, srcOK := funcIdx[xedge.SrcCP+":"+xedge.SrcLabel]
+			dst, dstOK := funcIdx[xedge.DstCP+":"+xedge.DstLabel]
+			if srcOK && dstOK {
+				pl.links = append(pl.links, [2]int{pl.funcs[src].unit, pl.funcs[dst].unit})
+			}
+		}
+	}
+	for _, group := range spec.Affinity {
+		for i := 0; i < len(group); i++ {
+			src, srcOK := lookup(group[i], "affinity group")
+			for j := i + 1; j < len(group) && srcOK; j++ {
+				dst, dstOK := funcIdx[group[j]]
+				if dstOK {
+					pl.links = append(pl.links, [2]int{pl.funcs[src].unit, pl.funcs[dst].unit})
+				}
+			}
+		}
+	}
+
+	err := ReportErrs(errs)
+	if err != nil {
+		return nil, err
+	}
+
+	// execution cost of each unit on each host, and the hosts where that is defined
+	tmTbl, _, err := fitTimingModels(fel, buildFuncExecTimeTbl(fel))
+	if err != nil {
+		return nil, err
+	}
+	for _, pu := range pl.units {
+		for _, host := range pl.hosts {
+			if len(pu.pin) > 0 && pu.pin != host {
+				continue
+			}
+			total := 0.0
+			for _, idx := range pu.members {
+				total += pl.funcCost(pl.funcs[idx], endpts[host], tmTbl)
+			}
+			if !math.IsInf(total, 1) {
+				pu.cost[host] = total
+				pu.feasible = append(pu.feasible, host)
+			}
+		}
+		if len(pu.feasible) == 0 {
+			names := []string{}
+			for _, idx := range pu.members {
+				names = append(names, pl.funcs[idx].ptnName+":"+pl.funcs[idx].label)
+			}
+			errs = append(errs, fmt.Errorf("no candidate host has timings for every operation of %s",
+				strings.Join(names, ", ")))
+		}
+	}
+	err = ReportErrs(errs)
+	if err != nil {
+		return nil, err
+	}
+
+	pl.assign = make([]string, len(pl.units))
+	return pl, nil
+}
+
+// funcCost estimates the cost of running the function on the given endpoint, as the average of
+// the execution times of its operations, the time of an operation looked up with several params
+// being the average over them.  An operation without timings on the endpoint's CPU (or accelerator)
+// model, for any of its params, makes the cost infinite
+func (pl *placer) funcCost(pf *placeFunc, endpt mrnes.EndptDesc, tmTbl timingModelTbl) float64 {
+	if pf.ops.count() == 0 {
+		return 0.0
+	}
+
+	total := 0.0
+	sumOps := func(ops []string, model string) bool {
+		for _, op := range ops {
+			params := pf.ops.opParams(op)
+			if len(params) == 0 {
+				continue
+			}
+			opTotal := 0.0
+			for _, param := range params {
+				ft, present := tmTbl.lookup(op, model, param)
+				if !present {
+					return false
+				}
+				opTotal += ft.estimate(pl.spec.PcktLen)
+			}
+			total += opTotal / float64(len(params))
+		}
+		return true
+	}
+
+	if !sumOps(pf.ops.hostOps, endpt.Model) {
+		return math.Inf(1)
+	}
+	if len(pf.ops.accelOps) > 0 {
+		accelModel, present := endpt.Accel[pf.ops.accel]
+		if !present || !sumOps(pf.ops.accelOps, accelModel) {
+			return math.Inf(1)
+		}
+	}
+	return total / float64(pf.ops.count())
+}
+
+// estimate evaluates the current (possibly partial) assignment
+func (pl *placer) estimate() *PlacementEstimate {
+	pe := &PlacementEstimate{HostLoad: make(map[string]float64)}
+	for _, host := range pl.hosts {
+		pe.HostLoad[host] = 0.0
+	}
+	for uidx, pu := range pl.units {
+		host := pl.assign[uidx]
+		if len(host) > 0 {
+			pe.HostLoad[host] += pu.cost[host] / pl.capacity[host]
+		}
+	}
+	for _, load := range pe.HostLoad {
+		pe.MaxLoad = math.Max(pe.MaxLoad, load)
+	}
+
+	// execution is slowed by the load sharing its host
+	for uidx, pu := range pl.units {
+		host := pl.assign[uidx]
+		if len(host) > 0 {
+			pe.Latency += pu.cost[host] * (1.0 + pe.HostLoad[host])
+		}
+	}
+	for _, link := range pl.links {
+		src, dst := pl.assign[link[0]], pl.assign[link[1]]
+		if len(src) > 0 && len(dst) > 0 && src != dst {
+			pe.Cut += 1
+			pe.Latency += pl.spec.CommCost
+		}
+	}
+	return pe
+}
+
+// better reports whether estimate a is strictly preferred to estimate b under the spec's objective.
+// The balance objective breaks ties on latency
+func (pl *placer) better(a, b *PlacementEstimate) bool {
+	const tol = 1e-12
+	if pl.spec.Objective == "balance" {
+		if a.MaxLoad < b.MaxLoad-tol {
+			return true
+		}
+		if a.MaxLoad > b.MaxLoad+tol {
+			return false
+		}
+	}
+	return a.Latency < b.Latency-tol
+}
+
+// allowed reports whether the unit may be assigned the host without violating anti-affinity
+func (pl *placer) allowed(uidx int, host string) bool {
+	for _, other := range pl.units[uidx].anti {
+		if pl.assign[other] == host {
+			return false
+		}
+	}
+	return true
+}
+
+// greedy assigns units one at a time, pinned units first and then in order of decreasing cost,
+// each to the feasible host that gives the best estimate of the partial assignment
+func (pl *placer) greedy() error {
+	order := make([]int, len(pl.units))
+	heaviest := make([]float64, len(pl.units))
+	for uidx, pu := range pl.units {
+		order[uidx] = uidx
+		for _, cost := range pu.cost {
+			heaviest[uidx] = math.Max(heaviest[uidx], cost)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		ui, uj := pl.units[order[i]], pl.units[order[j]]
+		if (len(ui.pin) > 0) != (len(uj.pin) > 0) {
+			return len(ui.pin) > 0
+		}
+		return heaviest[order[i]] > heaviest[order[j]]
+	})
+
+	for _, uidx := range order {
+		var best *PlacementEstimate
+		bestHost := ""
+		for _, host := range pl.units[uidx].feasible {
+			if !pl.allowed(uidx, host) {
+				continue
+			}
+			pl.assign[uidx] = host
+			pe := pl.estimate()
+			if best == nil || pl.better(pe, best) {
+				best = pe
+				bestHost = host
+			}
+		}
+		if best == nil {
+			pf := pl.funcs[pl.units[uidx].members[0]]
+			return fmt.Errorf("function %s:%s cannot be placed without violating anti-affinity",
+				pf.ptnName, pf.label)
+		}
+		pl.assign[uidx] = bestHost
+	}
+	return nil
+}
+
+// localSearch repeatedly moves single units, and swaps pairs of units, between hosts
+// while doing so improves the estimate, up to the spec's limit on passes
+func (pl *placer) localSearch() {
+	maxIters := pl.spec.MaxIters
+	if maxIters <= 0 {
+		maxIters = 100
+	}
+
+	current := pl.estimate()
+	for iter := 0; iter < maxIters; iter++ {
+		improved := false
+
+		for uidx, pu := range pl.units {
+			if len(pu.pin) > 0 {
+				continue
+			}
+			home := pl.assign[uidx]
+			for _, host := range pu.feasible {
+				if host == home || !pl.allowed(uidx, host) {
+					continue
+				}
+				pl.assign[uidx] = host
+				pe := pl.estimate()
+				if pl.better(pe, current) {
+					current = pe
+					home = host
+					improved = true
+				} else {
+					pl.assign[uidx] = home
+				}
+			}
+		}
+
+		for u := range pl.units {
+			for v := u + 1; v < len(pl.units); v++ {
+				hu, hv := pl.assign[u], pl.assign[v]
+				if hu == hv || len(pl.units[u].pin) > 0 || len(pl.units[v].pin) > 0 {
+					continue
+				}
+				_, uFits := pl.units[u].cost[hv]
+				_, vFits := pl.units[v].cost[hu]
+				if !uFits || !vFits {
+					continue
+				}
+				pl.assign[u], pl.assign[v] = hv, hu
+				if pl.allowed(u, hv) && pl.allowed(v, hu) {
+					pe := pl.estimate()
+					if pl.better(pe, current) {
+						current = pe
+						improved = true
+						continue
+					}
+				}
+				pl.assign[u], pl.assign[v] = hu, hv
+			}
+		}
+
+		if !improved {
+			break
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package pces
+
+import (
+	"github.com/iti/mrnes"
+	"math"
+	"strings"
+	"testing"
+)
+
+// placedHosts returns the host each function of chain1 is mapped to
+func placedHosts(t *testing.T, cpmd *CompPatternMapDict) map[string]string {
+	t.Helper()
+	hosts := make(map[string]string)
+	for label, hostPri := range cpmd.Map["chain1"].FuncMap {
+		host, err := parseHostPri(hostPri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts[label] = host
+	}
+	return hosts
+}
+
+func TestPlaceFuncsConstraints(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(ps *PlacementSpec)
+		check func(t *testing.T, hosts map[string]string)
+	}{
+		{
+			name:  "every function placed, hash where it is timed",
+			setup: func(ps *PlacementSpec) {},
+			check: func(t *testing.T, hosts map[string]string) {
+				if len(hosts) != 4 {
+					t.Errorf("placed %d functions, want 4", len(hosts))
+				}
+				if hosts["hash"] == "hostC" {
+					t.Errorf("hash placed on hostC, which has no timing for it")
+				}
+			},
+		},
+		{
+			name:  "pin",
+			setup: func(ps *PlacementSpec) { ps.AddPin("chain1:src", "hostC") },
+			check: func(t *testing.T, hosts map[string]string) {
+				if hosts["src"] != "hostC" {
+					t.Errorf("pinned src placed on %s, want hostC", hosts["src"])
+				}
+			},
+		},
+		{
+			name: "colocate with a pinned function",
+			setup: func(ps *PlacementSpec) {
+				ps.AddColocate([]string{"chain1:proc", "chain1:sink"})
+				ps.AddPin("chain1:sink", "hostA")
+			},
+			check: func(t *testing.T, hosts map[string]string) {
+				if hosts["proc"] != "hostA" || hosts["sink"] != "hostA" {
+					t.Errorf("co-located proc and sink placed on %s and %s, want hostA", hosts["proc"], hosts["sink"])
+				}
+			},
+		},
+		{
+			name: "anti-affinity",
+			setup: func(ps *PlacementSpec) {
+				ps.Objective = "latency"
+				ps.AddAntiAffinity([]string{"chain1:src", "chain1:proc", "chain1:sink"})
+			},
+			check: func(t *testing.T, hosts map[string]string) {
+				if hosts["src"] == hosts["proc"] || hosts["src"] == hosts["sink"] || hosts["proc"] == hosts["sink"] {
+					t.Errorf("anti-affine functions share a host: %v", hosts)
+				}
+			},
+		},
+		{
+			name: "affinity keeps the chain together when it costs nothing",
+			setup: func(ps *PlacementSpec) {
+				ps.Objective = "latency"
+				ps.Hosts = []string{"hostA", "hostB"}
+				ps.AddAffinity([]string{"chain1:src", "chain1:sink"})
+			},
+			check: func(t *testing.T, hosts map[string]string) {
+				if hosts["src"] != hosts["proc"] || hosts["proc"] != hosts["hash"] || hosts["hash"] != hosts["sink"] {
+					t.Errorf("chain split between hosts with no benefit: %v", hosts)
+				}
+			},
+		},
+		{
+			name:  "candidate hosts",
+			setup: func(ps *PlacementSpec) { ps.Hosts = []string{"hostB"} },
+			check: func(t *testing.T, hosts map[string]string) {
+				for label, host := range hosts {
+					if host != "hostB" {
+						t.Errorf("%s placed on %s, not a candidate host", label, host)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpd, cpid, fel, _ := testModel(t)
+			spec := CreatePlacementSpec("p", "balance")
+			tc.setup(spec)
+			cpmd, pe, err := PlaceFuncs(cpd, cpid, fel, testTopo(), spec)
+			if err != nil {
+				t.Fatalf("PlaceFuncs: %v", err)
+			}
+			if pe == nil {
+				t.Fatal("PlaceFuncs returned no estimate")
+			}
+			tc.check(t, placedHosts(t, cpmd))
+		})
+	}
+}
+
+func TestPlaceFuncsInfeasible(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(ps *PlacementSpec)
+		errStr string
+	}{
+		{"unknown objective", func(ps *PlacementSpec) { ps.Objective = "cost" }, "not in {latency, balance}"},
+		{"pin of unknown function", func(ps *PlacementSpec) { ps.AddPin("chain1:nosuch", "hostA") }, "unknown function chain1:nosuch"},
+		{"pin to host not a candidate", func(ps *PlacementSpec) {
+			ps.Hosts = []string{"hostA"}
+			ps.AddPin("chain1:src", "hostB")
+		}, "not a candidate host"},
+		{"unknown candidate host", func(ps *PlacementSpec) { ps.Hosts = []string{"hostZ"} }, "hostZ not in topology"},
+		{"co-located functions pinned apart", func(ps *PlacementSpec) {
+			ps.AddColocate([]string{"chain1:src", "chain1:sink"})
+			ps.AddPin("chain1:src", "hostA")
+			ps.AddPin("chain1:sink", "hostB")
+		}, "co-located with a function pinned to"},
+		{"co-located and anti-affine", func(ps *PlacementSpec) {
+			ps.AddColocate([]string{"chain1:src", "chain1:sink"})
+			ps.AddAntiAffinity([]string{"chain1:src", "chain1:sink"})
+		}, "both to share and not to share"},
+		{"function pinned where it has no timing", func(ps *PlacementSpec) { ps.AddPin("chain1:hash", "hostC") },
+			"no candidate host has timings for every operation of chain1:hash"},
+		{"more anti-affine functions than hosts", func(ps *PlacementSpec) {
+			ps.Hosts = []string{"hostA", "hostB"}
+			ps.AddAntiAffinity([]string{"chain1:src", "chain1:proc", "chain1:sink"})
+		}, "without violating anti-affinity"},
+		{"non-positive capacity", func(ps *PlacementSpec) { ps.Capacity["hostA"] = 0.0 }, "capacity of host hostA must be positive"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpd, cpid, fel, _ := testModel(t)
+			spec := CreatePlacementSpec("p", "balance")
+			tc.setup(spec)
+			_, _, err := PlaceFuncs(cpd, cpid, fel, testTopo(), spec)
+			if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+				t.Errorf("PlaceFuncs error = %v, want one containing %q", err, tc.errStr)
+			}
+		})
+	}
+}
+
+func TestReadPlacementSpecDefaults(t *testing.T) {
+	ps, err := ReadPlacementSpec("", true, []byte("name: p\nobjective: latency\npin:\n  \"chain1:src\": hostA\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CreatePlacementSpec("p", "latency")
+	if ps.CommCost != want.CommCost || ps.Priority != want.Priority || ps.MaxIters != want.MaxIters {
+		t.Errorf("read spec has commcost %g priority %d maxiters %d, want the defaults %g %d %d",
+			ps.CommCost, ps.Priority, ps.MaxIters, want.CommCost, want.Priority, want.MaxIters)
+	}
+	if ps.Pin["chain1:src"] != "hostA" || ps.Capacity == nil {
+		t.Errorf("read spec has pin %v, capacity %v", ps.Pin, ps.Capacity)
+	}
+
+	ps, err = ReadPlacementSpec("", false, []byte(`{"name": "p", "objective": "balance", "priority": 3, "maxiters": 5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps.Priority != 3 || ps.MaxIters != 5 || ps.CommCost != want.CommCost {
+		t.Errorf("read spec has priority %d maxiters %d commcost %g, want 3 5 %g", ps.Priority, ps.MaxIters, ps.CommCost, want.CommCost)
+	}
+
+	_, err = ReadPlacementSpec("", false, []byte(`{"priority": 1.5}`))
+	if err == nil {
+		t.Errorf("spec with priority 1.5 read without error")
+	}
+}
+
+func TestFuncCost(t *testing.T) {
+	fel := CreateFuncExecList("times")
+	fel.AddTiming("crypt", "", "x86", 1000, 1.0e-3)
+	fel.AddTiming("crypt", "aes", "x86", 1000, 10.0e-3)
+	fel.AddTiming("crypt", "des", "x86", 1000, 20.0e-3)
+	fel.AddTiming("hash", "", "x86", 1000, 3.0e-3)
+	fel.AddTiming("crypt", "", "tesla", 1000, 0.1e-3)
+	tmTbl, _, err := fitTimingModels(fel, buildFuncExecTimeTbl(fel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostA, hostB := testTopo().Endpts[0], testTopo().Endpts[1]
+	tests := []struct {
+		name  string
+		cfg   string
+		endpt mrnes.EndptDesc
+		want  float64
+	}{
+		{"no operations", "msg2mc: {}", hostA, 0.0},
+		{"one operation", "timingcode: {req: crypt}", hostA, 1.0e-3},
+		{"operations averaged", "timingcode: {req: crypt, rsp: hash}", hostA, 2.0e-3},
+		{"params averaged", "timingcode: {req: crypt, rsp: crypt}\ntimingparam: {req: aes, rsp: des}", hostA, 15.0e-3},
+		{"param without timings takes those without a param", "timingcode: {req: crypt, rsp: crypt}\ntimingparam: {req: aes, rsp: rc4}",
+			hostA, 5.5e-3},
+		{"no timings on the model", "timingcode: {req: sign}", hostA, math.Inf(1)},
+		{"on the accelerator", "timingcode: {req: crypt}\naccelname: gpu", hostA, 0.1e-3},
+		{"accelerator missing", "timingcode: {req: crypt}\naccelname: gpu", hostB, math.Inf(1)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pl := &placer{spec: CreatePlacementSpec("p", "latency")}
+			pl.spec.PcktLen = 1000
+			pf := &placeFunc{ptnName: "chain1", label: "proc", ops: cfgOpCodes(tc.cfg)}
+			got := pl.funcCost(pf, tc.endpt, tmTbl)
+			if !(got == tc.want || closeTo(got, tc.want)) {
+				t.Errorf("funcCost = %g, want %g", got, tc.want)
+			}
+		})
+	}
+}
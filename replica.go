@@ -0,0 +1,131 @@
+package pces
+
+// file replica.go holds methods that create and remove run-time replicas of
+// comp pattern function instances, and select which replica receives a message
+
+import (
+	"fmt"
+	"github.com/iti/evt/evtm"
+	"github.com/iti/mrnes"
+)
+
+// nonReplicableClasses lists the function classes whose semantics prevent
+// replication.  start and bckgrndLd functions generate work on their own rather
+// than receive it, and srvReq holds state that spans a request and its return
+var nonReplicableClasses map[string]bool = map[string]bool{"start": true, "bckgrndLd": true, "srvReq": true}
+
+// replicable reports whether functions of the named class may be replicated
+func replicable(class string) bool {
+	return !nonReplicableClasses[class]
+}
+
+// NumReplicas returns the number of instances (primary included) serving the function
+func (cpfi *CmpPtnFuncInst) NumReplicas() int {
+	primary := cpfi.primary()
+	return 1 + len(primary.Replicas)
+}
+
+// primary returns the instance built from the model description
+func (cpfi *CmpPtnFuncInst) primary() *CmpPtnFuncInst {
+	if cpfi.Primary != nil {
+		return cpfi.Primary
+	}
+	return cpfi
+}
+
+// AddReplica creates a new instance of the function from the same Func and cfg
+// as the primary, runs it on the named host, and includes it among the
+// instances that receive messages directed to the function's label
+func (cpfi *CmpPtnFuncInst) AddReplica(evtMgr *evtm.EventManager, host string) (*CmpPtnFuncInst, error) {
+	primary := cpfi.primary()
+
+	if !replicable(primary.Class) {
+		return nil, fmt.Errorf("function %s of class %s cannot be replicated", primary.GlobalName(), primary.Class)
+	}
+
+	_, present := mrnes.EndptDevByName[host]
+	if !present {
+		return nil, fmt.Errorf("replica of %s requested on unrecognized host %s", primary.GlobalName(), host)
+	}
+
+	// replica indices are never re-used, so that trace names remain unique
+	primary.replicasMade += 1
+	idx := primary.replicasMade
+
+	fnc := &Func{Class: primary.Class, Label: primary.Label}
+	rep := newFuncInst(primary.PtnName, primary.CPID, fnc)
+	rep.Replica = idx
+	rep.Primary = primary
+	rep.Host = host
+	rep.Priority = primary.Priority
+	rep.IsService = primary.IsService
+
+	// the cfg is initialized once the replica is placed, as classes read the host as they do so
+	rep.initFuncInst(evtMgr, primary.cfgStr, primary.useYAML)
+
+	// the replica shares the primary's view of the graph
+	rep.OutEdges = make([]edgeStruct, len(primary.OutEdges))
+	copy(rep.OutEdges, primary.OutEdges)
+	for msgType, eidx := range primary.Msg2Idx {
+		rep.Msg2Idx[msgType] = eidx
+	}
+	copyDict(rep.Msg2MC, primary.Msg2MC)
+
+	fc := FuncClasses[rep.Class]
+	err := fc.ValidateCfg(rep)
+	if err != nil {
+		return nil, err
+	}
+
+	primary.Replicas = append(primary.Replicas, rep)
+	return rep, nil
+}
+
+// RemoveReplica withdraws the most recently added replica from the set of instances
+// that receive messages.  Work already given to it runs to completion.
+// The primary instance is never removed
+func (cpfi *CmpPtnFuncInst) RemoveReplica() (*CmpPtnFuncInst, error) {
+	primary := cpfi.primary()
+	if len(primary.Replicas) == 0 {
+		return nil, fmt.Errorf("function %s has no replicas to remove", primary.GlobalName())
+	}
+	last := len(primary.Replicas) - 1
+	rep := primary.Replicas[last]
+	primary.Replicas = primary.Replicas[:last]
+	return rep, nil
+}
+
+// replicaSet returns the primary instance followed by its active replicas
+func (cpfi *CmpPtnFuncInst) replicaSet() []*CmpPtnFuncInst {
+	primary := cpfi.primary()
+	return append([]*CmpPtnFuncInst{primary}, primary.Replicas...)
+}
+
+// selectReplica chooses which instance of a replicated function receives a message.
+// The instance with the least work in flight is chosen, ties broken in favor of one
+// on the sender's host, and then in order of creation
+func (cpfi *CmpPtnFuncInst) selectReplica(srcHost string) *CmpPtnFuncInst {
+	if len(cpfi.Replicas) == 0 {
+		return cpfi
+	}
+
+	var chosen *CmpPtnFuncInst
+	for _, rep := range cpfi.replicaSet() {
+		if rep.Migrating {
+			continue
+		}
+		if chosen == nil || rep.InFlight < chosen.InFlight {
+			chosen = rep
+			continue
+		}
+		if rep.InFlight == chosen.InFlight && rep.Host == srcHost && chosen.Host != srcHost {
+			chosen = rep
+		}
+	}
+
+	// every instance being migrated means the primary holds the message until it resumes
+	if chosen == nil {
+		return cpfi
+	}
+	return chosen
+}
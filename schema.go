@@ -0,0 +1,424 @@
+package pces
+
+// file schema.go generates JSON Schema descriptions of the pces input file formats, and of the
+// cfg of every registered function class, from the Go types that are deserialized from those files.
+// It also holds a validator that checks a document against these schemas and reports every problem
+// with the path of the field at fault, e.g. "initlist.chain1.cfg.proc.timingcode.req"
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// schemaDialect identifies the version of JSON Schema generated
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// A Schema is a JSON Schema, holding as much of the standard as is needed to describe the pces input formats.
+// AdditionalProperties is either false, for structs whose fields are all known, or the *Schema of map values
+type Schema struct {
+	Dialect              string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// schemaDocTypes gives the type deserialized from each kind of input file, indexed by the name of its command line flag
+var schemaDocTypes map[string]reflect.Type = map[string]reflect.Type{
+	"cp":        reflect.TypeOf(CompPatternDict{}),
+	"cpInit":    reflect.TypeOf(CPInitListDict{}),
+	"funcExec":  reflect.TypeOf(FuncExecList{}),
+	"map":       reflect.TypeOf(CompPatternMapDict{}),
+	"templates": reflect.TypeOf(TemplateDict{}),
+	"sharedCfg": reflect.TypeOf(SharedCfgGroupList{}),
+	"autoscale": reflect.TypeOf(AutoscalePolicyList{}),
+	"dvfs":      reflect.TypeOf(DVFSPolicyList{}),
+	"placement": reflect.TypeOf(PlacementSpec{}),
+	"bundle":    reflect.TypeOf(ExperimentBundle{}),
+}
+
+// SchemaKinds returns the kinds of input file for which schemas are generated
+func SchemaKinds() []string {
+	return sortedKeys(schemaDocTypes)
+}
+
+// GenerateSchema returns the schema of the kind of input file named.  The cfg strings
+// of a cpInit file are described in its $defs, one per registered function class
+func GenerateSchema(kind string) (*Schema, error) {
+	docType, present := schemaDocTypes[kind]
+	if !present {
+		return nil, fmt.Errorf("no schema for input file kind %s", kind)
+	}
+	s := schemaOf(docType)
+	s.Dialect = schemaDialect
+	s.ID = kind + ".schema.json"
+	s.Title = "pces " + kind + " file"
+
+	if kind == "cpInit" {
+		s.Defs = make(map[string]*Schema)
+		for _, class := range sortedKeys(FuncClasses) {
+			s.Defs[class], _ = ClassCfgSchema(class)
+			s.Defs[class].Dialect = ""
+			s.Defs[class].ID = ""
+		}
+	}
+	return s, nil
+}
+
+// ClassCfgSchema returns the schema of the cfg of a registered function class
+func ClassCfgSchema(class string) (*Schema, error) {
+	fc, present := FuncClasses[class]
+	if !present {
+		return nil, fmt.Errorf("no registered function class %s", class)
+	}
+	s := schemaOf(reflect.TypeOf(fc))
+	s.Dialect = schemaDialect
+	s.ID = "cfg-" + class + ".schema.json"
+	s.Title = "cfg of function class " + class
+	return s, nil
+}
+
+// schemaOf builds the schema of a Go type, naming struct fields as encoding/json and yaml.v3 do
+func schemaOf(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+		for idx := 0; idx < t.NumField(); idx++ {
+			field := t.Field(idx)
+			if !field.IsExported() {
+				continue
+			}
+			name := schemaFieldName(field)
+			if len(name) == 0 {
+				continue
+			}
+			s.Properties[name] = schemaOf(field.Type)
+		}
+
+		// the class of a function is one of those known
+		if t == reflect.TypeOf(Func{}) {
+			s.Properties["class"].Enum = sortedKeys(FuncClassNames)
+		}
+
+		// a cfg is written either as a serialized string or as a nested object
+		if t == reflect.TypeOf(CPInitList{}) {
+			s.Properties["cfg"].AdditionalProperties = &Schema{
+				Description: "cfg of the function's class, serialized or as an object; see $defs",
+				AnyOf:       []*Schema{{Type: "string"}, {Type: "object"}}}
+		}
+		return s
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaOf(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	}
+	// interfaces, and anything else, accept any value
+	return &Schema{}
+}
+
+// schemaFieldName returns the name under which a struct field is serialized, empty if it is not
+func schemaFieldName(field reflect.StructField) string {
+	for _, tagKey := range []string{"json", "yaml"} {
+		tag, present := field.Tag.Lookup(tagKey)
+		if !present {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			return ""
+		}
+		if len(name) > 0 {
+			return name
+		}
+	}
+	// yaml.v3 lower-cases untagged names, and encoding/json matches names without regard to case
+	return strings.ToLower(field.Name)
+}
+
+// A FieldError reports a problem with the value at a path within a document
+type FieldError struct {
+	Path string
+	Msg  string
+}
+
+// Error formats the path and the problem
+func (fe *FieldError) Error() string {
+	if len(fe.Path) == 0 {
+		return fe.Msg
+	}
+	return fe.Path + ": " + fe.Msg
+}
+
+// ValidateDocument checks a serialized input file of the named kind against its schema, returning a
+// FieldError for every problem found.  For cpInit files only the form of the cfgs is checked; their
+// content depends on the classes of the functions, which ValidateModelCfgs checks
+func ValidateDocument(kind string, dict []byte, useYAML bool) []error {
+	s, err := GenerateSchema(kind)
+	if err != nil {
+		return []error{err}
+	}
+	var doc any
+	if useYAML {
+		err = yaml.Unmarshal(dict, &doc)
+	} else {
+		err = json.Unmarshal(dict, &doc)
+	}
+	if err != nil {
+		return []error{&FieldError{Msg: err.Error()}}
+	}
+	return validateValue(s, doc, "")
+}
+
+// ValidateCfgString checks a serialized cfg against the schema of its function class, prefixing
+// the paths of the errors returned with path
+func ValidateCfgString(class, cfgStr, path string) []error {
+	s, err := ClassCfgSchema(class)
+	if err != nil {
+		return []error{&FieldError{Path: path, Msg: err.Error()}}
+	}
+	if len(strings.TrimSpace(cfgStr)) == 0 {
+		return []error{&FieldError{Path: path, Msg: "cfg is empty"}}
+	}
+
+	var doc any
+	if cfgStr[0] == '{' {
+		err = json.Unmarshal([]byte(cfgStr), &doc)
+	} else {
+		err = yaml.Unmarshal([]byte(cfgStr), &doc)
+	}
+	if err != nil {
+		return []error{&FieldError{Path: path, Msg: err.Error()}}
+	}
+	return validateValue(s, doc, path)
+}
+
+// ValidateModelCfgs checks the cfg of every function of every comp pattern against the schema of the function's class
+func ValidateModelCfgs(cpd *CompPatternDict, cpid *CPInitListDict) []error {
+	errs := []error{}
+	for _, ptnName := range sortedPtnNames(cpd) {
+		cpil, present := cpid.InitList[ptnName]
+		if !present {
+			continue
+		}
+		for _, fnc := range cpd.Patterns[ptnName].Funcs {
+			cfgStr, present := cpil.Cfg[fnc.Label]
+			if !present {
+				continue
+			}
+			path := "initlist." + ptnName + ".cfg." + fnc.Label
+			errs = append(errs, ValidateCfgString(fnc.Class, cfgStr, path)...)
+		}
+	}
+	return errs
+}
+
+// checkNativeCfgs applies ValidateModelCfgs to the cfgs that were written as nested objects.
+// Cfgs in the legacy serialized form are left to CreateCfg, which ignores unknown fields
+func checkNativeCfgs(cpd *CompPatternDict, cpid *CPInitListDict) error {
+	native := CreateCPInitListDict(cpid.DictName)
+	for name, cpil := range cpid.InitList {
+		ncpil := CreateCPInitList(name, cpil.CPType, cpil.UseYAML)
+		for label := range cpil.NativeCfg {
+			ncpil.Cfg[label] = cpil.Cfg[label]
+		}
+		native.InitList[name] = *ncpil
+	}
+	return ReportErrs(ValidateModelCfgs(cpd, native))
+}
+
+// cfgDecodeError builds the error reported when the cfg of a function class cannot be deserialized,
+// naming the fields at fault when the schema of the class finds them
+func cfgDecodeError(fc FuncClassCfg, cfgStr string, err error) error {
+	errs := ValidateCfgString(fc.FuncClassName(), cfgStr, "cfg")
+	if len(errs) == 0 {
+		return fmt.Errorf("%s cfg deserialization error: %s", fc.FuncClassName(), err.Error())
+	}
+	return fmt.Errorf("%s cfg deserialization error: %s", fc.FuncClassName(), ReportErrs(errs).Error())
+}
+
+// validateValue checks a deserialized value against a schema
+func validateValue(s *Schema, value any, path string) []error {
+	// absent values take their zero values, which always fit
+	if value == nil {
+		return nil
+	}
+
+	// a value fitting any of the alternatives fits; otherwise report against the first of matching type
+	if len(s.AnyOf) > 0 {
+		var firstErrs []error
+		for _, alt := range s.AnyOf {
+			altErrs := validateValue(alt, value, path)
+			if len(altErrs) == 0 {
+				return nil
+			}
+			if firstErrs == nil {
+				firstErrs = altErrs
+			}
+		}
+		return firstErrs
+	}
+
+	errs := []error{}
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return []error{&FieldError{Path: path, Msg: "expected an object, found " + valueKind(value)}}
+		}
+		keys := sortedKeys(obj)
+		for _, key := range keys {
+			subPath := key
+			if len(path) > 0 {
+				subPath = path + "." + key
+			}
+			prop, present := s.Properties[key]
+			if present {
+				errs = append(errs, validateValue(prop, obj[key], subPath)...)
+				continue
+			}
+			// as in JSON Schema, fields are open unless additionalProperties is false
+			addl, isSchema := s.AdditionalProperties.(*Schema)
+			if isSchema {
+				errs = append(errs, validateValue(addl, obj[key], subPath)...)
+				continue
+			}
+			if s.AdditionalProperties == false {
+				errs = append(errs, &FieldError{Path: subPath, Msg: "unknown field" + suggestField(key, s.Properties)})
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return []error{&FieldError{Path: path, Msg: "expected an array, found " + valueKind(value)}}
+		}
+		for idx, elem := range arr {
+			errs = append(errs, validateValue(s.Items, elem, fmt.Sprintf("%s[%d]", path, idx))...)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []error{&FieldError{Path: path, Msg: "expected a string, found " + valueKind(value)}}
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			errs = append(errs, &FieldError{Path: path, Msg: fmt.Sprintf("%q is not one of %s", str, strings.Join(s.Enum, ", "))})
+		}
+	case "integer":
+		if !isInteger(value) {
+			return []error{&FieldError{Path: path, Msg: "expected an integer, found " + valueKind(value)}}
+		}
+	case "number":
+		_, isFloat := value.(float64)
+		if !isInteger(value) && !isFloat {
+			return []error{&FieldError{Path: path, Msg: "expected a number, found " + valueKind(value)}}
+		}
+	case "boolean":
+		_, ok := value.(bool)
+		if !ok {
+			return []error{&FieldError{Path: path, Msg: "expected a boolean, found " + valueKind(value)}}
+		}
+	}
+	return errs
+}
+
+// isInteger is true if the deserialized value is a whole number
+func isInteger(value any) bool {
+	switch v := value.(type) {
+	case int, int64, uint64:
+		return true
+	case float64:
+		return v == float64(int64(v))
+	}
+	return false
+}
+
+// valueKind names the JSON type of a deserialized value
+func valueKind(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case int, int64, uint64:
+		return "an integer"
+	case float64:
+		return "a number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// suggestField names a known field that differs from an unknown one only in case or separators
+func suggestField(key string, props map[string]*Schema) string {
+	norm := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+	for _, name := range sortedKeys(props) {
+		if norm(name) == norm(key) {
+			return fmt.Sprintf(" (did you mean %s?)", name)
+		}
+	}
+	return ""
+}
+
+// WriteSchemaFiles writes the schema of every kind of input file, and of the cfg of every registered
+// function class, as indented json to files in the named directory, returning their names
+func WriteSchemaFiles(dir string) ([]string, error) {
+	written := []string{}
+	schemas := []*Schema{}
+	for _, kind := range SchemaKinds() {
+		s, err := GenerateSchema(kind)
+		if err != nil {
+			return written, err
+		}
+		schemas = append(schemas, s)
+	}
+	for _, class := range sortedKeys(FuncClasses) {
+		s, err := ClassCfgSchema(class)
+		if err != nil {
+			return written, err
+		}
+		schemas = append(schemas, s)
+	}
+
+	for _, s := range schemas {
+		bytes, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return written, err
+		}
+		filename := filepath.Join(dir, s.ID)
+		err = os.WriteFile(filename, append(bytes, '\n'), 0644)
+		if err != nil {
+			return written, err
+		}
+		written = append(written, filename)
+	}
+	sort.Strings(written)
+	return written, nil
+}
@@ -0,0 +1,92 @@
+package pces
+
+import (
+	"strings"
+	"testing"
+)
+
+// errStrings returns the messages of a list of errors
+func errStrings(errs []error) []string {
+	strs := make([]string, len(errs))
+	for idx, err := range errs {
+		strs[idx] = err.Error()
+	}
+	return strs
+}
+
+// hasPrefixes is true if got holds as many strings as want, each beginning with the string of want in its place
+func hasPrefixes(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for idx := range got {
+		if !strings.HasPrefix(got[idx], want[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestValidateDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		kind string
+		doc  string
+		want []string
+	}{
+		{"valid", "funcExec", "listname: t\ntimes:\n  crypt:\n    - {cpumodel: x86, pcktlen: 1000, exectime: 1.0e-3}", []string{}},
+		{"unknown field", "funcExec", "listname: t\ntimes:\n  crypt:\n    - {cpumodel: x86, pcktlength: 1000}",
+			[]string{"times.crypt[0].pcktlength: unknown field"}},
+		{"unknown field near a known one", "funcExec", "listname: t\ntimes:\n  crypt:\n    - {CPU_Model: x86}",
+			[]string{"times.crypt[0].CPU_Model: unknown field (did you mean cpumodel?)"}},
+		{"integer expected", "funcExec", "times:\n  crypt:\n    - {pcktlen: 1000.5}",
+			[]string{"times.crypt[0].pcktlen: expected an integer, found a number"}},
+		{"number expected", "funcExec", "times:\n  crypt:\n    - {exectime: fast}",
+			[]string{"times.crypt[0].exectime: expected a number, found a string"}},
+		{"array expected", "funcExec", "times:\n  crypt: {cpumodel: x86}",
+			[]string{"times.crypt: expected an array, found an object"}},
+		{"unregistered class", "cp", "patterns:\n  chain1:\n    funcs:\n      - {class: nosuch, label: proc}",
+			[]string{`patterns.chain1.funcs[0].class: "nosuch" is not one of`}},
+		{"problems reported together", "map", "map:\n  chain1:\n    funcmap: {proc: [hostA]}\n    extra: 1",
+			[]string{"map.chain1.extra: unknown field", "map.chain1.funcmap.proc: expected a string, found an array"}},
+		{"unknown kind", "topo", "name: t", []string{"no schema for input file kind topo"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := errStrings(ValidateDocument(tc.kind, []byte(tc.doc), true))
+			if !hasPrefixes(got, tc.want) {
+				t.Errorf("ValidateDocument = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateModelCfgs(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  string
+		want []string
+	}{
+		{"valid", "timingcode: {req: crypt}", []string{}},
+		{"valid json", `{"timingcode": {"req": "crypt"}}`, []string{}},
+		{"unknown field", "timingcode: {req: crypt}\ntimingcodes: {rsp: hash}",
+			[]string{"initlist.chain1.cfg.proc.timingcodes: unknown field"}},
+		{"map value of the wrong type", "timingcode: {req: [crypt]}",
+			[]string{"initlist.chain1.cfg.proc.timingcode.req: expected a string, found an array"}},
+		{"field of the wrong type", "timingcode: {req: crypt}\nthreads: two",
+			[]string{"initlist.chain1.cfg.proc.threads: expected an integer, found a string"}},
+		{"empty", " ", []string{"initlist.chain1.cfg.proc: cfg is empty"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpd, cpid, _, _ := testModel(t)
+			cpid.InitList["chain1"].Cfg["proc"] = tc.cfg
+			got := errStrings(ValidateModelCfgs(cpd, cpid))
+			if !hasPrefixes(got, tc.want) {
+				t.Errorf("ValidateModelCfgs = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"golang.org/x/exp/slices"
 	"math"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
 // cmdlineParams defines the parameters recognized
@@ -21,25 +23,34 @@ func cmdlineParams() *cmdline.CmdParser {
 	// keep them here so that all the programs that build templates can use the same arguments file
 	// create an argument parser
 	cp := cmdline.NewCmdParser()
-	cp.AddFlag(cmdline.StringFlag, "exprmnt", true)     // string name of experiment being run
-	cp.AddFlag(cmdline.StringFlag, "inputLib", true)    // directory where model parameters are read from
-	cp.AddFlag(cmdline.StringFlag, "outputLib", true)   // directory where measurements and traces are stored
-	cp.AddFlag(cmdline.StringFlag, "cp", true)          //
-	cp.AddFlag(cmdline.StringFlag, "cpInit", true)      //
-	cp.AddFlag(cmdline.StringFlag, "funcExec", true)    // name of input file holding descriptions of functional timings
-	cp.AddFlag(cmdline.StringFlag, "devExec", true)     // name of input file holding descriptions of device timings
-	cp.AddFlag(cmdline.StringFlag, "map", true)         // file with mapping of comp pattern functions to hosts
-	cp.AddFlag(cmdline.StringFlag, "exp", true)         // name of file used for run-time experiment parameters
-	cp.AddFlag(cmdline.StringFlag, "topo", true)        // name of output file used for topo templates
-	cp.AddFlag(cmdline.StringFlag, "experiments", true) // name of input file describing experiment parameters
-	cp.AddFlag(cmdline.StringFlag, "trace", false)      // path to output file of trace records
-	cp.AddFlag(cmdline.IntFlag, "rngseed", false)       // RNG seed
-	cp.AddFlag(cmdline.FloatFlag, "stop", false)        // run the simulation until this time (in seconds)
-	cp.AddFlag(cmdline.BoolFlag, "json", false)         // input/output files in YAML, or JSON
-	cp.AddFlag(cmdline.StringFlag, "csv", true)         // name of file where measurements will be written
-	cp.AddFlag(cmdline.BoolFlag, "verbose", false)      // measure output is terse
-	cp.AddFlag(cmdline.StringFlag, "tunits", true)      // units used in reporting time
-	cp.AddFlag(cmdline.BoolFlag, "container", false)    // name of file where measurements will be written
+	cp.AddFlag(cmdline.StringFlag, "exprmnt", true)      // string name of experiment being run
+	cp.AddFlag(cmdline.StringFlag, "inputLib", true)     // directory where model parameters are read from
+	cp.AddFlag(cmdline.StringFlag, "outputLib", true)    // directory where measurements and traces are stored
+	cp.AddFlag(cmdline.StringFlag, "cp", true)           //
+	cp.AddFlag(cmdline.StringFlag, "cpInit", true)       //
+	cp.AddFlag(cmdline.StringFlag, "funcExec", true)     // name of input file holding descriptions of functional timings
+	cp.AddFlag(cmdline.StringFlag, "devExec", true)      // name of input file holding descriptions of device timings
+	cp.AddFlag(cmdline.StringFlag, "map", true)          // file with mapping of comp pattern functions to hosts
+	cp.AddFlag(cmdline.StringFlag, "exp", true)          // name of file used for run-time experiment parameters
+	cp.AddFlag(cmdline.StringFlag, "topo", true)         // name of output file used for topo templates
+	cp.AddFlag(cmdline.StringFlag, "experiments", true)  // name of input file describing experiment parameters
+	cp.AddFlag(cmdline.StringFlag, "trace", false)       // path to output file of trace records
+	cp.AddFlag(cmdline.IntFlag, "rngseed", false)        // RNG seed
+	cp.AddFlag(cmdline.FloatFlag, "stop", false)         // run the simulation until this time (in seconds)
+	cp.AddFlag(cmdline.BoolFlag, "json", false)          // input/output files in YAML, or JSON
+	cp.AddFlag(cmdline.StringFlag, "csv", true)          // name of file where measurements will be written
+	cp.AddFlag(cmdline.BoolFlag, "verbose", false)       // measure output is terse
+	cp.AddFlag(cmdline.BoolFlag, "stochastic", false)    // draw function execution times from their distributions
+	cp.AddFlag(cmdline.BoolFlag, "failNegative", false)  // stop when a function execution time is estimated negative
+	cp.AddFlag(cmdline.BoolFlag, "clampNegative", false) // take a function execution time estimated negative as zero
+	cp.AddFlag(cmdline.StringFlag, "tunits", true)       // units used in reporting time
+	cp.AddFlag(cmdline.BoolFlag, "container", false)     // name of file where measurements will be written
+	cp.AddFlag(cmdline.StringFlag, "autoscale", false)   // name of input file holding autoscaling policies
+	cp.AddFlag(cmdline.StringFlag, "scaleCSV", false)    // name of csv file where autoscaled replica counts are written
+	cp.AddFlag(cmdline.StringFlag, "templates", false)   // name of input file holding comp pattern templates
+	cp.AddFlag(cmdline.StringFlag, "sharedCfg", false)   // name of input file holding shared cfg groups
+	cp.AddFlag(cmdline.StringFlag, "dvfs", false)        // name of input file holding host DVFS policies
+	cp.AddFlag(cmdline.StringFlag, "cpuAcct", false)     // name of csv or json file where per-function CPU use is written
 	return cp
 }
 
@@ -49,6 +60,8 @@ var useTrace bool
 var termination float64
 var traceFile string
 var csvFile string
+var autoscaleCSVFile string
+var cpuAcctFile string
 var cp *cmdline.CmdParser
 var ExprmntName string
 var TimeUnits string
@@ -114,6 +127,9 @@ func ReadSimArgs() (*cmdline.CmdParser, *evtm.EventManager) {
 	}
 
 	MsrVerbose = cp.GetVar("verbose").(bool)
+	StochasticExecTimes = cp.GetVar("stochastic").(bool)
+	FailOnNegativeExecTime = cp.GetVar("failNegative").(bool)
+	ClampNegativeExecTime = cp.GetVar("clampNegative").(bool)
 
 	// make sure these directories exist
 	dirs := []string{inputDir}
@@ -124,8 +140,8 @@ func ReadSimArgs() (*cmdline.CmdParser, *evtm.EventManager) {
 
 	// check for access to input files
 	fullpathmap := make(map[string]string)
-	inFiles := []string{"cp", "cpInit", "funcExec", "devExec", "exp", "topo", "map", "experiments"}
-	optionalFiles := []string{"experiments"}
+	inFiles := []string{"cp", "cpInit", "funcExec", "devExec", "exp", "topo", "map", "experiments", "autoscale", "templates", "sharedCfg", "dvfs"}
+	optionalFiles := []string{"experiments", "autoscale", "templates", "sharedCfg", "dvfs"}
 
 	fullpath := []string{}
 	errs := []error{}
@@ -138,8 +154,22 @@ func ReadSimArgs() (*cmdline.CmdParser, *evtm.EventManager) {
 			continue
 		}
 		basefile := cp.GetVar(filename).(string)
-		fullfile := filepath.Join(inputDir, basefile)
-		fullpath = append(fullpath, fullfile)
+		if !slices.Contains(bundleLayeredDocs, filename) {
+			fullfile := filepath.Join(inputDir, basefile)
+			fullpath = append(fullpath, fullfile)
+			fullpathmap[filename] = fullfile
+			syn[filename] = fullfile
+			continue
+		}
+
+		// the cp, cpInit, and funcExec flags may name a comma-separated base file and overlays
+		layers := []string{}
+		for _, layer := range LayerFiles(basefile) {
+			fullLayer := filepath.Join(inputDir, layer)
+			fullpath = append(fullpath, fullLayer)
+			layers = append(layers, fullLayer)
+		}
+		fullfile := strings.Join(layers, ",")
 
 		fullpathmap[filename] = fullfile
 		syn[filename] = fullfile
@@ -183,6 +213,36 @@ func ReadSimArgs() (*cmdline.CmdParser, *evtm.EventManager) {
 		outputFiles = append(outputFiles, csvFile)
 	}
 
+	if cp.IsLoaded("cpuAcct") {
+		cpuAcctFile = cp.GetVar("cpuAcct").(string)
+		err = checkCPUAcctFile(cpuAcctFile)
+		if err != nil {
+			panic(err)
+		}
+		if !container {
+			cpuAcctFile = filepath.Join(outputDir, cpuAcctFile)
+		} else {
+			baseFile := filepath.Base(cpuAcctFile)
+			cpuAcctFile = filepath.Join("/tmp/extern/output", baseFile)
+		}
+		outputFiles = append(outputFiles, cpuAcctFile)
+	}
+
+	if cp.IsLoaded("scaleCSV") {
+		autoscaleCSVFile = cp.GetVar("scaleCSV").(string)
+		err = checkAutoscaleCSVFile(autoscaleCSVFile)
+		if err != nil {
+			panic(err)
+		}
+		if !container {
+			autoscaleCSVFile = filepath.Join(outputDir, autoscaleCSVFile)
+		} else {
+			baseFile := filepath.Base(autoscaleCSVFile)
+			autoscaleCSVFile = filepath.Join("/tmp/extern/output", baseFile)
+		}
+		outputFiles = append(outputFiles, autoscaleCSVFile)
+	}
+
 	_, err = CheckOutputFiles(outputFiles)
 	if err != nil {
 		panic(err)
@@ -197,6 +257,88 @@ func ReadSimArgs() (*cmdline.CmdParser, *evtm.EventManager) {
 	return cp, evtMgr
 }
 
+// ReadSimBundle is an alternative to ReadSimArgs that takes the input files and run settings
+// of the experiment from the experiment bundle in the named file rather than from the command line
+func ReadSimBundle(filename string) *evtm.EventManager {
+	ext := path.Ext(filename)
+	useYAML := (ext == ".yaml") || (ext == ".yml")
+
+	eb, err := ReadExperimentBundle(filename, useYAML, []byte{})
+	if err != nil {
+		panic(err)
+	}
+	return LoadSimBundle(eb)
+}
+
+// LoadSimBundle takes the input files and run settings of the experiment from an experiment
+// bundle, which may have been built in memory.  Inlined documents are written to the bundle's OutputLib
+func LoadSimBundle(eb *ExperimentBundle) *evtm.EventManager {
+	bsyn, err := eb.BuildSyn(eb.OutputLib)
+	if err != nil {
+		panic(err)
+	}
+	for key, filename := range bsyn {
+		syn[key] = filename
+	}
+
+	ExprmntName = eb.Exprmnt
+	ExprmntsFile = syn["experiments"]
+	TimeUnits = eb.TimeUnits
+	MsrVerbose = eb.Verbose
+	StochasticExecTimes = eb.Stochastic
+	FailOnNegativeExecTime = eb.FailNegative
+	ClampNegativeExecTime = eb.ClampNegative
+
+	// a zero stop time leaves termination at the largest possible time
+	termination = math.MaxFloat64
+	if eb.Stop > 0.0 {
+		termination = eb.Stop
+	}
+
+	outputFiles := make([]string, 0)
+	if len(eb.Trace) > 0 {
+		useTrace = true
+		traceFile = eb.Trace
+		if !filepath.IsAbs(traceFile) {
+			traceFile = filepath.Join(eb.OutputLib, traceFile)
+		}
+		outputFiles = append(outputFiles, traceFile)
+	}
+
+	csvFile = eb.CSV
+	if !filepath.IsAbs(csvFile) {
+		csvFile = filepath.Join(eb.OutputLib, csvFile)
+	}
+	outputFiles = append(outputFiles, csvFile)
+
+	if len(eb.CPUAcct) > 0 {
+		cpuAcctFile = eb.CPUAcct
+		if !filepath.IsAbs(cpuAcctFile) {
+			cpuAcctFile = filepath.Join(eb.OutputLib, cpuAcctFile)
+		}
+		outputFiles = append(outputFiles, cpuAcctFile)
+	}
+
+	if len(eb.ScaleCSV) > 0 {
+		autoscaleCSVFile = eb.ScaleCSV
+		if !filepath.IsAbs(autoscaleCSVFile) {
+			autoscaleCSVFile = filepath.Join(eb.OutputLib, autoscaleCSVFile)
+		}
+		outputFiles = append(outputFiles, autoscaleCSVFile)
+	}
+
+	_, err = CheckOutputFiles(outputFiles)
+	if err != nil {
+		panic(err)
+	}
+
+	if eb.RngSeed != 0 {
+		rngstream.SetRngStreamMasterSeed(uint64(eb.RngSeed))
+		GlobalSeed = int64(eb.RngSeed)
+	}
+	return evtMgr
+}
+
 // RunExperiment is called from the main simulation program to read in 
 // model files and start the simulation.  Its two arguments are pointers to callback
 // functions, expCntrl being called after the model is built but before events are executed,
@@ -223,10 +365,68 @@ func RunExperiment(expCntrl evtm.EventHandlerFunction, expCmplt evtm.EventHandle
 		panic(err)
 	}
 
+	// if autoscaling policies were given, start the autoscalers they describe
+	if len(syn["autoscale"]) > 0 {
+		ext := path.Ext(syn["autoscale"])
+		useYAML := (ext == ".yaml") || (ext == ".yml")
+		aspl, err := ReadAutoscalePolicyList(syn["autoscale"], useYAML, []byte{})
+		if err != nil {
+			panic(err)
+		}
+		err = StartAutoscalers(evtMgr, aspl)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// if DVFS policies were given, start the governors of host frequency they describe
+	if len(syn["dvfs"]) > 0 {
+		ext := path.Ext(syn["dvfs"])
+		useYAML := (ext == ".yaml") || (ext == ".yml")
+		dpl, err := ReadDVFSPolicyList(syn["dvfs"], useYAML, []byte{})
+		if err != nil {
+			panic(err)
+		}
+		err = StartDVFS(evtMgr, dpl)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	// call function expControl to find start functions and run them
 	expCntrl(evtMgr, nil, nil)
 	evtMgr.Run(termination)
 
 	// call function expComplete to complete the experiment, write out measurements
 	expCmplt(evtMgr, &csvFile, &ExprmntName)
+
+	// report the functions moved between hosts
+	ReportMigrations()
+
+	// and the replicas added and removed by autoscalers, with their counts over time if asked for
+	ReportAutoscale()
+	if len(autoscaleCSVFile) > 0 {
+		err = SaveAutoscaleCSV(autoscaleCSVFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// note the results that rest on execution times estimated away from measured packet lengths
+	ReportTimingLookups()
+
+	// and the changes in host frequency made by DVFS governors
+	ReportDVFS(evtMgr.CurrentSeconds())
+
+	// and the speedup of operations run on several cores
+	ReportParallelism()
+
+	// if asked for, the CPU used by each function, by host
+	if len(cpuAcctFile) > 0 {
+		ReportCPUAccounts(evtMgr.CurrentSeconds())
+		err = SaveCPUAccounts(cpuAcctFile, evtMgr.CurrentSeconds())
+		if err != nil {
+			panic(err)
+		}
+	}
 }
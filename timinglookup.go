@@ -0,0 +1,108 @@
+package pces
+
+// file timinglookup.go holds the recording, while the simulation runs, of execution time lookups
+// whose packet length was not measured.  Every such lookup is counted by operation, model, and param,
+// with the furthest it lay from a measured packet length, so that the end-of-run report shows
+// which results rest on interpolated or extrapolated timings
+
+import (
+	"fmt"
+)
+
+// kinds of execution time lookup
+const (
+	lookupMeasured = iota
+	lookupInterpolated
+	lookupExtrapolated
+)
+
+// an execTimeLookup is the execution time estimated for a packet length, with whether the packet length
+// was measured, lies between measured lengths, or beyond them, and its distance from the nearest
+type execTimeLookup struct {
+	value    float64
+	kind     int
+	distance int
+}
+
+// FailOnNegativeExecTime selects whether a lookup whose estimated execution time is negative
+// stops the simulation
+var FailOnNegativeExecTime bool = false
+
+// ClampNegativeExecTime selects whether an estimated execution time that is negative is taken as
+// zero.  Otherwise it is used as estimated
+var ClampNegativeExecTime bool = false
+
+// A TimingLookupRecord counts the execution time lookups of an operation on a model with a param.
+//
+//	Lookups      - all lookups
+//	Interpolated - lookups of a packet length between measured lengths
+//	Extrapolated - lookups of a packet length outside the range measured
+//	Negative     - lookups whose estimate was negative
+//	MaxDistance  - the furthest, in bytes, a looked-up packet length lay from a measured one
+//	MaxPcktLen   - a packet length at that distance
+type TimingLookupRecord struct {
+	Op           string
+	Model        string
+	Param        string
+	Lookups      int
+	Interpolated int
+	Extrapolated int
+	Negative     int
+	MaxDistance  int
+	MaxPcktLen   int
+}
+
+// TimingLookups holds a record for every operation, model, and param whose execution time has been
+// looked up, in the order of their first lookup
+var TimingLookups []*TimingLookupRecord = make([]*TimingLookupRecord, 0)
+
+var timingLookupIdx map[[3]string]int = make(map[[3]string]int)
+
+// recordTimingLookup counts a lookup of the execution time of an operation on a model with a param
+func recordTimingLookup(op, model, param string, pcktLen int, etl execTimeLookup) {
+	key := [3]string{op, model, param}
+	idx, present := timingLookupIdx[key]
+	if !present {
+		idx = len(TimingLookups)
+		timingLookupIdx[key] = idx
+		TimingLookups = append(TimingLookups, &TimingLookupRecord{Op: op, Model: model, Param: param})
+	}
+	rec := TimingLookups[idx]
+	rec.Lookups += 1
+	switch etl.kind {
+	case lookupInterpolated:
+		rec.Interpolated += 1
+	case lookupExtrapolated:
+		rec.Extrapolated += 1
+	}
+	if etl.value < 0.0 {
+		rec.Negative += 1
+	}
+	if etl.distance > rec.MaxDistance {
+		rec.MaxDistance, rec.MaxPcktLen = etl.distance, pcktLen
+	}
+}
+
+// ReportTimingLookups prints, for every operation, model, and param some of whose execution time lookups
+// were not of a measured packet length, how many were interpolated, extrapolated, or negative,
+// and the furthest any lay from a measured packet length
+func ReportTimingLookups() {
+	for _, rec := range TimingLookups {
+		if rec.Interpolated == 0 && rec.Extrapolated == 0 {
+			continue
+		}
+		paramStr := ""
+		if len(rec.Param) > 0 {
+			paramStr = fmt.Sprintf(" with param %s", rec.Param)
+		}
+		negative := ""
+		if rec.Negative > 0 {
+			negative = fmt.Sprintf(", %d negative", rec.Negative)
+			if ClampNegativeExecTime {
+				negative += " taken as zero"
+			}
+		}
+		fmt.Printf("Timing of %s on %s%s: %d of %d lookups interpolated, %d extrapolated%s, furthest %d bytes from a measurement at packet length %d\n",
+			rec.Op, rec.Model, paramStr, rec.Interpolated, rec.Lookups, rec.Extrapolated, negative, rec.MaxDistance, rec.MaxPcktLen)
+	}
+}
@@ -0,0 +1,70 @@
+package pces
+
+import (
+	"testing"
+)
+
+func TestFittedTimingLookup(t *testing.T) {
+	tm := new(piecewiseLinear)
+	err := tm.Fit([]int{100, 400}, []float64{1.0e-3, 4.0e-3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := &fittedTiming{model: tm, pcktLens: []int{100, 400}}
+
+	tests := []struct {
+		name     string
+		pcktLen  int
+		value    float64
+		kind     int
+		distance int
+	}{
+		{"zero is the shortest measured", 0, 1.0e-3, lookupMeasured, 0},
+		{"below the range", 40, 0.4e-3, lookupExtrapolated, 60},
+		{"at the shortest", 100, 1.0e-3, lookupMeasured, 0},
+		{"nearer the shortest", 150, 1.5e-3, lookupInterpolated, 50},
+		{"nearer the longest", 300, 3.0e-3, lookupInterpolated, 100},
+		{"at the longest", 400, 4.0e-3, lookupMeasured, 0},
+		{"above the range", 1000, 10.0e-3, lookupExtrapolated, 600},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			etl := ft.lookup(tc.pcktLen)
+			if !closeTo(etl.value, tc.value) || etl.kind != tc.kind || etl.distance != tc.distance {
+				t.Errorf("lookup(%d) = %+v, want value %g kind %d distance %d",
+					tc.pcktLen, etl, tc.value, tc.kind, tc.distance)
+			}
+			if got := ft.estimate(tc.pcktLen); got != etl.value {
+				t.Errorf("estimate(%d) = %g, lookup gives %g", tc.pcktLen, got, etl.value)
+			}
+		})
+	}
+}
+
+func TestFittedTimingNegativeUnclamped(t *testing.T) {
+	// times that fall with packet length extrapolate below zero
+	tm := new(piecewiseLinear)
+	err := tm.Fit([]int{100, 200}, []float64{2.0e-3, 1.0e-3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := &fittedTiming{model: tm, pcktLens: []int{100, 200}}
+
+	etl := ft.lookup(1000)
+	if !closeTo(etl.value, -7.0e-3) || etl.kind != lookupExtrapolated {
+		t.Errorf("lookup(1000) = %+v, want value -7e-3 extrapolated", etl)
+	}
+
+	saved := ClampNegativeExecTime
+	defer func() { ClampNegativeExecTime = saved }()
+
+	ClampNegativeExecTime = false
+	if got := clampExecTime(etl.value); got != etl.value {
+		t.Errorf("clampExecTime without -clampNegative = %g, want %g", got, etl.value)
+	}
+	ClampNegativeExecTime = true
+	if got := clampExecTime(etl.value); got != 0.0 {
+		t.Errorf("clampExecTime with -clampNegative = %g, want 0", got)
+	}
+}
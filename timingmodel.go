@@ -0,0 +1,407 @@
+package pces
+
+// file timingmodel.go holds the models that estimate the execution time of an operation for
+// any packet length from the timings measured at a few.  The model used for an operation is
+// selected in the funcExec file; each is fitted once, per CPU model and param, when the model
+// is built, and the quality of each fit may be reported
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A TimingModel estimates execution times as a function of packet length
+type TimingModel interface {
+	// Fit fits the model to measured execution times, given in order of increasing packet length
+	Fit(pcktLens []int, times []float64) error
+
+	// Estimate returns the execution time the fitted model gives for a packet length
+	Estimate(pcktLen int) float64
+}
+
+// TimingModelKinds maps the kind of a timing model named in a funcExec file to a function
+// that creates one from its description
+var TimingModelKinds map[string]func(TimingModelDesc) TimingModel = map[string]func(TimingModelDesc) TimingModel{
+	"linear":       func(tmd TimingModelDesc) TimingModel { return new(piecewiseLinear) },
+	"leastsquares": func(tmd TimingModelDesc) TimingModel { return new(leastSquares) },
+	"polynomial":   createPolynomial,
+	"loglinear":    func(tmd TimingModelDesc) TimingModel { return new(logLinear) },
+	"step":         func(tmd TimingModelDesc) TimingModel { return new(stepModel) },
+}
+
+// RegisterTimingModel makes a timing model of the given kind available for selection in funcExec files.
+// A kind already registered is not replaced.  Return of bool allows call to RegisterTimingModel
+// as part of a variable assignment outside of a function body
+func RegisterTimingModel(kind string, create func(TimingModelDesc) TimingModel) bool {
+	_, present := TimingModelKinds[kind]
+	if present {
+		return true
+	}
+	TimingModelKinds[kind] = create
+	return true
+}
+
+// piecewiseLinear interpolates linearly between neighboring measurements and extrapolates
+// along the line through the two measurements nearest, as pces always has
+type piecewiseLinear struct {
+	fmap map[int]float64
+}
+
+func (pwl *piecewiseLinear) Fit(pcktLens []int, times []float64) error {
+	pwl.fmap = make(map[int]float64)
+	for idx, pl := range pcktLens {
+		pwl.fmap[pl] = times[idx]
+	}
+	return nil
+}
+
+func (pwl *piecewiseLinear) Estimate(pcktLen int) float64 {
+	return interpolateExecTime(pwl.fmap, pcktLen)
+}
+
+// leastSquares fits one line to all the measurements.  A single measurement gives the line through it and
+// the origin, or when made at packet length zero, a time independent of packet length
+type leastSquares struct {
+	intercept, slope float64
+}
+
+func (ls *leastSquares) Fit(pcktLens []int, times []float64) error {
+	if len(pcktLens) == 1 && pcktLens[0] == 0 {
+		ls.intercept, ls.slope = times[0], 0.0
+		return nil
+	}
+	if len(pcktLens) == 1 {
+		ls.intercept, ls.slope = 0.0, times[0]/float64(pcktLens[0])
+		return nil
+	}
+	coefs, err := polyFit(pcktLens, times, 1)
+	if err != nil {
+		return err
+	}
+	ls.intercept, ls.slope = coefs[0], coefs[1]
+	return nil
+}
+
+func (ls *leastSquares) Estimate(pcktLen int) float64 {
+	return ls.intercept + ls.slope*float64(pcktLen)
+}
+
+// polynomial fits by least squares a polynomial of the given degree in packet length
+type polynomial struct {
+	degree int
+	coefs  []float64
+}
+
+func createPolynomial(tmd TimingModelDesc) TimingModel {
+	poly := new(polynomial)
+	poly.degree = tmd.Degree
+	if poly.degree == 0 {
+		poly.degree = 2
+	}
+	return poly
+}
+
+func (poly *polynomial) Fit(pcktLens []int, times []float64) error {
+	if len(pcktLens) <= poly.degree {
+		return fmt.Errorf("polynomial of degree %d needs at least %d timings, has %d", poly.degree, poly.degree+1, len(pcktLens))
+	}
+	coefs, err := polyFit(pcktLens, times, poly.degree)
+	poly.coefs = coefs
+	return err
+}
+
+func (poly *polynomial) Estimate(pcktLen int) float64 {
+	value := 0.0
+	for idx := len(poly.coefs) - 1; idx >= 0; idx-- {
+		value = value*float64(pcktLen) + poly.coefs[idx]
+	}
+	return value
+}
+
+// logLinear fits by least squares a line in the logarithm of packet length, for operations whose
+// cost grows with the log of the amount of data (e.g. searches of sorted data)
+type logLinear struct {
+	intercept, slope float64
+}
+
+func (ll *logLinear) Fit(pcktLens []int, times []float64) error {
+	if len(pcktLens) < 2 {
+		return fmt.Errorf("loglinear model needs at least 2 timings, has %d", len(pcktLens))
+	}
+	if pcktLens[0] < 1 {
+		return fmt.Errorf("loglinear model needs positive packet lengths, has %d", pcktLens[0])
+	}
+	n := float64(len(pcktLens))
+	sumX, sumX2, sumY, sumXY := 0.0, 0.0, 0.0, 0.0
+	for idx, pl := range pcktLens {
+		x := math.Log(float64(pl))
+		sumX += x
+		sumX2 += x * x
+		sumY += times[idx]
+		sumXY += x * times[idx]
+	}
+	ll.slope = (n*sumXY - sumX*sumY) / (n*sumX2 - sumX*sumX)
+	ll.intercept = (sumY - ll.slope*sumX) / n
+	return nil
+}
+
+func (ll *logLinear) Estimate(pcktLen int) float64 {
+	return ll.intercept + ll.slope*math.Log(math.Max(1.0, float64(pcktLen)))
+}
+
+// stepModel gives a packet the execution time measured at the smallest packet length at least as long,
+// or beyond the longest measured, the time measured there
+type stepModel struct {
+	pcktLens []int
+	times    []float64
+}
+
+func (sm *stepModel) Fit(pcktLens []int, times []float64) error {
+	sm.pcktLens, sm.times = pcktLens, times
+	return nil
+}
+
+func (sm *stepModel) Estimate(pcktLen int) float64 {
+	idx := sort.SearchInts(sm.pcktLens, pcktLen)
+	return sm.times[min(idx, len(sm.times)-1)]
+}
+
+// polyFit returns the coefficients, lowest order first, of the polynomial of the given degree
+// that fits the measurements with least squared error.  Packet lengths are scaled by the longest
+// to keep the normal equations well conditioned
+func polyFit(pcktLens []int, times []float64, degree int) ([]float64, error) {
+	scale := float64(pcktLens[len(pcktLens)-1])
+	if scale == 0.0 {
+		scale = 1.0
+	}
+	size := degree + 1
+
+	// normal equations: sum over the measurements of x^(i+j) c_j = sum of x^i y
+	ata := make([][]float64, size)
+	atb := make([]float64, size)
+	for row := range ata {
+		ata[row] = make([]float64, size)
+	}
+	for idx, pl := range pcktLens {
+		x := float64(pl) / scale
+		powers := make([]float64, size)
+		powers[0] = 1.0
+		for k := 1; k < size; k++ {
+			powers[k] = powers[k-1] * x
+		}
+		for row := 0; row < size; row++ {
+			for col := 0; col < size; col++ {
+				ata[row][col] += powers[row] * powers[col]
+			}
+			atb[row] += powers[row] * times[idx]
+		}
+	}
+
+	coefs, err := solveLinear(ata, atb)
+	if err != nil {
+		return nil, err
+	}
+	for k := range coefs {
+		coefs[k] /= math.Pow(scale, float64(k))
+	}
+	return coefs, nil
+}
+
+// solveLinear solves the square system a x = b by Gaussian elimination with partial pivoting
+func solveLinear(a [][]float64, b []float64) ([]float64, error) {
+	size := len(b)
+	for col := 0; col < size; col++ {
+		pivot := col
+		for row := col + 1; row < size; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("timings do not determine a fit of degree %d", size-1)
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := col + 1; row < size; row++ {
+			factor := a[row][col] / a[col][col]
+			for k := col; k < size; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+			b[row] -= factor * b[col]
+		}
+	}
+
+	x := make([]float64, size)
+	for row := size - 1; row >= 0; row-- {
+		sum := b[row]
+		for k := row + 1; k < size; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+	return x, nil
+}
+
+// a fittedTiming is a timing model fitted to the timings of an operation on a CPU model with a param,
+// with the packet lengths timed, in increasing order
+type fittedTiming struct {
+	model    TimingModel
+	pcktLens []int
+}
+
+// estimate returns the execution time for a packet length.  A packet length of zero (no message)
+// is taken as the shortest measured.  The estimate is returned as the model gives it, even if negative
+func (ft *fittedTiming) estimate(pcktLen int) float64 {
+	return ft.lookup(pcktLen).value
+}
+
+// lookup estimates the execution time for a packet length as estimate does, and describes
+// how far the estimate rests on the measured timings
+func (ft *fittedTiming) lookup(pcktLen int) execTimeLookup {
+	if pcktLen == 0 {
+		pcktLen = ft.pcktLens[0]
+	}
+	etl := execTimeLookup{value: ft.model.Estimate(pcktLen)}
+
+	last := len(ft.pcktLens) - 1
+	switch {
+	case pcktLen < ft.pcktLens[0]:
+		etl.kind, etl.distance = lookupExtrapolated, ft.pcktLens[0]-pcktLen
+	case pcktLen > ft.pcktLens[last]:
+		etl.kind, etl.distance = lookupExtrapolated, pcktLen-ft.pcktLens[last]
+	default:
+		idx := sort.SearchInts(ft.pcktLens, pcktLen)
+		if ft.pcktLens[idx] != pcktLen {
+			etl.kind = lookupInterpolated
+			etl.distance = min(ft.pcktLens[idx]-pcktLen, pcktLen-ft.pcktLens[idx-1])
+		}
+	}
+	return etl
+}
+
+// timingModelTbl holds the fitted timing models, with the same keys as an execTimeTbl
+type timingModelTbl map[string]map[string]map[string]*fittedTiming
+
+var funcTimingModelTbl timingModelTbl = make(timingModelTbl)
+
+// lookup returns the fitted timing model of an operation on a hardware model with the given param,
+// selecting among params as execTimeTbl.lookup does
+func (tmt timingModelTbl) lookup(op, model, param string) (*fittedTiming, bool) {
+	params, present := tmt[op][model]
+	if !present {
+		return nil, false
+	}
+	return lookupParam(params, param)
+}
+
+// A TimingFit reports how closely the timing model of an operation on a CPU model
+// with a param reproduces the timings it was fitted to.
+//
+//	Points    - the number of timings
+//	RMSE      - root mean square difference between estimated and measured times (seconds)
+//	MaxRelErr - the largest difference relative to the measured time
+//	R2        - the coefficient of determination, 1 for a model that reproduces every timing
+type TimingFit struct {
+	Op        string  `json:"op" yaml:"op"`
+	CPUModel  string  `json:"cpumodel" yaml:"cpumodel"`
+	Param     string  `json:"param,omitempty" yaml:"param,omitempty"`
+	Kind      string  `json:"kind" yaml:"kind"`
+	Points    int     `json:"points" yaml:"points"`
+	RMSE      float64 `json:"rmse" yaml:"rmse"`
+	MaxRelErr float64 `json:"maxrelerr" yaml:"maxrelerr"`
+	R2        float64 `json:"r2" yaml:"r2"`
+}
+
+// FitTimings fits the timing model selected for each operation to its timings and reports the
+// quality of every fit.  The error reports every timing model that could not be fitted
+func FitTimings(fel *FuncExecList) ([]TimingFit, error) {
+	_, fits, err := fitTimingModels(fel, buildFuncExecTimeTbl(fel))
+	return fits, err
+}
+
+// timingModelDesc returns the description of the timing model selected for an operation
+func (fel *FuncExecList) timingModelDesc(op string) TimingModelDesc {
+	tmd, present := fel.Models[op]
+	if !present || len(tmd.Kind) == 0 {
+		tmd.Kind = "linear"
+	}
+	return tmd
+}
+
+// fitTimingModels fits the timing model selected for each operation to the timings of the
+// operation on each CPU model, for each param, and returns them with the quality of each fit
+func fitTimingModels(fel *FuncExecList, et execTimeTbl) (timingModelTbl, []TimingFit, error) {
+	tmt := make(timingModelTbl)
+	fits := []TimingFit{}
+	errs := []error{}
+
+	for _, op := range sortedKeys(fel.Models) {
+		_, present := TimingModelKinds[fel.timingModelDesc(op).Kind]
+		if !present {
+			errs = append(errs, fmt.Errorf("timing model of %s has unrecognized kind %s", op, fel.Models[op].Kind))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, ReportErrs(errs)
+	}
+
+	for _, op := range sortedKeys(et) {
+		tmd := fel.timingModelDesc(op)
+		tmt[op] = make(map[string]map[string]*fittedTiming)
+		for _, model := range sortedKeys(et[op]) {
+			tmt[op][model] = make(map[string]*fittedTiming)
+			for _, param := range sortedKeys(et[op][model]) {
+				fmap := et[op][model][param]
+				pls := make([]int, 0, len(fmap))
+				for pl := range fmap {
+					pls = append(pls, pl)
+				}
+				sort.Ints(pls)
+				times := make([]float64, len(pls))
+				for idx, pl := range pls {
+					times[idx] = fmap[pl]
+				}
+
+				tm := TimingModelKinds[tmd.Kind](tmd)
+				err := tm.Fit(pls, times)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("timing model of %s on %s with param %q: %s", op, model, param, err.Error()))
+					continue
+				}
+				ft := &fittedTiming{model: tm, pcktLens: pls}
+				tmt[op][model][param] = ft
+				fits = append(fits, fitQuality(op, model, param, tmd.Kind, ft, pls, times))
+			}
+		}
+	}
+	return tmt, fits, ReportErrs(errs)
+}
+
+// fitQuality compares the estimates of a fitted timing model with the timings it was fitted to
+func fitQuality(op, model, param, kind string, ft *fittedTiming, pls []int, times []float64) TimingFit {
+	fit := TimingFit{Op: op, CPUModel: model, Param: param, Kind: kind, Points: len(pls)}
+	mean := 0.0
+	for _, t := range times {
+		mean += t
+	}
+	mean /= float64(len(times))
+
+	ssRes, ssTot := 0.0, 0.0
+	for idx, pl := range pls {
+		diff := ft.estimate(pl) - times[idx]
+		ssRes += diff * diff
+		ssTot += (times[idx] - mean) * (times[idx] - mean)
+		if times[idx] > 0.0 {
+			fit.MaxRelErr = math.Max(fit.MaxRelErr, math.Abs(diff)/times[idx])
+		}
+	}
+	fit.RMSE = math.Sqrt(ssRes / float64(len(pls)))
+	switch {
+	case ssTot > 0.0:
+		fit.R2 = 1.0 - ssRes/ssTot
+	case ssRes == 0.0:
+		fit.R2 = 1.0
+	}
+	return fit
+}
@@ -0,0 +1,172 @@
+package pces
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTimingModelFits(t *testing.T) {
+	tests := []struct {
+		name     string
+		tmd      TimingModelDesc
+		pcktLens []int
+		times    []float64
+		at       map[int]float64 // expected estimates by packet length
+	}{
+		{
+			name:     "linear interpolates and extrapolates along the nearest segment",
+			tmd:      TimingModelDesc{Kind: "linear"},
+			pcktLens: []int{100, 200, 400},
+			times:    []float64{1.0, 2.0, 3.0},
+			at:       map[int]float64{50: 0.5, 100: 1.0, 300: 2.5, 400: 3.0, 600: 4.0},
+		},
+		{
+			name:     "leastsquares reproduces a line",
+			tmd:      TimingModelDesc{Kind: "leastsquares"},
+			pcktLens: []int{100, 500, 1000},
+			times:    []float64{1.2e-3, 2.0e-3, 3.0e-3},
+			at:       map[int]float64{0: 1.0e-3, 750: 2.5e-3, 2000: 5.0e-3},
+		},
+		{
+			name:     "leastsquares through the origin from one timing",
+			tmd:      TimingModelDesc{Kind: "leastsquares"},
+			pcktLens: []int{1000},
+			times:    []float64{2.0e-3},
+			at:       map[int]float64{500: 1.0e-3, 3000: 6.0e-3},
+		},
+		{
+			name:     "polynomial of default degree reproduces a quadratic",
+			tmd:      TimingModelDesc{Kind: "polynomial"},
+			pcktLens: []int{10, 20, 30, 40},
+			times:    []float64{1.11, 1.24, 1.39, 1.56},
+			at:       map[int]float64{0: 1.0, 25: 1.3125, 50: 1.75},
+		},
+		{
+			name:     "polynomial of degree 1",
+			tmd:      TimingModelDesc{Kind: "polynomial", Degree: 1},
+			pcktLens: []int{0, 100},
+			times:    []float64{1.0, 2.0},
+			at:       map[int]float64{50: 1.5, 300: 4.0},
+		},
+		{
+			name:     "loglinear reproduces a line in the log of packet length",
+			tmd:      TimingModelDesc{Kind: "loglinear"},
+			pcktLens: []int{1, 10, 100},
+			times:    []float64{2.0, 2.0 + 3.0*math.Log(10.0), 2.0 + 3.0*math.Log(100.0)},
+			at:       map[int]float64{1000: 2.0 + 3.0*math.Log(1000.0)},
+		},
+		{
+			name:     "step takes the next longest timing, and the longest beyond it",
+			tmd:      TimingModelDesc{Kind: "step"},
+			pcktLens: []int{100, 200},
+			times:    []float64{1.0, 2.0},
+			at:       map[int]float64{50: 1.0, 100: 1.0, 150: 2.0, 300: 2.0},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tm := TimingModelKinds[tc.tmd.Kind](tc.tmd)
+			err := tm.Fit(tc.pcktLens, tc.times)
+			if err != nil {
+				t.Fatalf("Fit: %v", err)
+			}
+			for _, pl := range sortedInts(tc.at) {
+				got := tm.Estimate(pl)
+				if !closeTo(got, tc.at[pl]) {
+					t.Errorf("Estimate(%d) = %g, want %g", pl, got, tc.at[pl])
+				}
+			}
+
+			// every model here passes through its timings, so the fit is exact
+			ft := &fittedTiming{model: tm, pcktLens: tc.pcktLens}
+			fit := fitQuality("op", "x86", "", tc.tmd.Kind, ft, tc.pcktLens, tc.times)
+			if fit.Points != len(tc.pcktLens) || fit.RMSE > 1e-9 || !closeTo(fit.R2, 1.0) {
+				t.Errorf("fitQuality = %+v, want exact fit of %d points", fit, len(tc.pcktLens))
+			}
+		})
+	}
+}
+
+func TestTimingModelFitErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		tmd      TimingModelDesc
+		pcktLens []int
+		times    []float64
+		errStr   string
+	}{
+		{"polynomial with too few timings", TimingModelDesc{Kind: "polynomial", Degree: 2},
+			[]int{100, 200}, []float64{1.0, 2.0}, "needs at least 3 timings"},
+		{"loglinear with one timing", TimingModelDesc{Kind: "loglinear"},
+			[]int{100}, []float64{1.0}, "needs at least 2 timings"},
+		{"loglinear at packet length zero", TimingModelDesc{Kind: "loglinear"},
+			[]int{0, 100}, []float64{1.0, 2.0}, "needs positive packet lengths"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := TimingModelKinds[tc.tmd.Kind](tc.tmd).Fit(tc.pcktLens, tc.times)
+			if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+				t.Errorf("Fit error = %v, want one containing %q", err, tc.errStr)
+			}
+		})
+	}
+}
+
+func TestFitQualityOfInexactFit(t *testing.T) {
+	fel := CreateFuncExecList("fits")
+	fel.AddTiming("crypt", "", "x86", 100, 1.0)
+	fel.AddTiming("crypt", "", "x86", 200, 3.0)
+	fel.AddTiming("crypt", "", "x86", 300, 3.0)
+	err := fel.SetTimingModel("crypt", "leastsquares", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fits, err := FitTimings(fel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fits) != 1 {
+		t.Fatalf("got %d fits, want 1", len(fits))
+	}
+
+	// the least squares line is 1/3 + pcktLen/100, missing each timing by 1/3 or 2/3
+	fit := fits[0]
+	if fit.Op != "crypt" || fit.CPUModel != "x86" || fit.Kind != "leastsquares" || fit.Points != 3 {
+		t.Errorf("fit identifies %+v", fit)
+	}
+	if want := math.Sqrt(2.0 / 9.0); !closeTo(fit.RMSE, want) {
+		t.Errorf("RMSE = %g, want %g", fit.RMSE, want)
+	}
+	if want := 0.75; !closeTo(fit.R2, want) {
+		t.Errorf("R2 = %g, want %g", fit.R2, want)
+	}
+	if want := 1.0 / 3.0; !closeTo(fit.MaxRelErr, want) {
+		t.Errorf("MaxRelErr = %g, want %g", fit.MaxRelErr, want)
+	}
+}
+
+func TestFitTimingModelsUnknownKind(t *testing.T) {
+	fel := CreateFuncExecList("fits")
+	fel.AddTiming("crypt", "", "x86", 100, 1.0)
+	fel.Models = map[string]TimingModelDesc{"crypt": {Kind: "spline"}}
+
+	_, err := FitTimings(fel)
+	if err == nil || !strings.Contains(err.Error(), "unrecognized kind spline") {
+		t.Errorf("FitTimings error = %v, want unrecognized kind", err)
+	}
+}
+
+// sortedInts returns the keys of an int-indexed map, sorted
+func sortedInts[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,376 @@
+package pces
+
+// file upgrade.go holds the versioning of the model description formats, and the upgrades that
+// bring the cp, cpInit, funcExec, and map files of an older format to the current one.  Upgrades work on the
+// document as read from file rather than on the Go structs, so that fields whose names the structs
+// no longer recognize, and which deserialization would silently drop, can be found and carried over
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ModelFormatVersion is the version of the model description formats that this version of pces reads and writes.
+//
+//	1 - (or no version given) the formats before versioning
+//	2 - version field; srvReq cfgs name their response message map op2msg; map entries are "host,priority"
+//	    with integer priority; timings name their operation identifier
+const ModelFormatVersion int = 2
+
+// upgradeKinds lists the kinds of file that carry a format version
+var upgradeKinds []string = []string{"cp", "cpInit", "funcExec", "map"}
+
+// an upgradeStep brings a document of one kind from version n to n+1, recording what it changed in the log
+type upgradeStep func(doc map[string]any, classes map[string]map[string]string, log *upgradeLog)
+
+// upgradeSteps holds, for each kind of file, the step that upgrades from the version that indexes it
+var upgradeSteps map[string]map[int]upgradeStep = map[string]map[int]upgradeStep{
+	"cp":       {1: upgradeCP1},
+	"cpInit":   {1: upgradeCPInit1},
+	"funcExec": {1: upgradeFuncExec1},
+	"map":      {1: upgradeMap1},
+}
+
+// upgradeLog gathers descriptions of the transformations applied to a document
+type upgradeLog struct {
+	notes []string
+}
+
+// add records a transformation of the value at the given path
+func (ul *upgradeLog) add(path, format string, args ...any) {
+	ul.notes = append(ul.notes, path+": "+fmt.Sprintf(format, args...))
+}
+
+// checkFormatVersion is called when a model description is read.  A file written by a newer
+// pces is an error, a file of an older format draws a warning that names the migration command
+func checkFormatVersion(kind, filename string, version int) error {
+	if version > ModelFormatVersion {
+		return fmt.Errorf("%s %s has format version %d, newer than the version %d this pces reads",
+			kind, filename, version, ModelFormatVersion)
+	}
+	if version < ModelFormatVersion {
+		if version == 0 {
+			version = 1
+		}
+		fmt.Printf("warning: %s %s has format version %d, current is %d; upgrade it with 'pces migrate'\n",
+			kind, filename, version, ModelFormatVersion)
+	}
+	return nil
+}
+
+// UpgradeDocument brings a serialized cp, cpInit, funcExec, or map file to the current format version,
+// returning the upgraded document, serialized as the input was, and a description of every transformation
+// applied.  A document at the current version is returned unchanged.  cpd, which may be nil, supplies the
+// classes of functions, needed for the upgrades of cfgs that depend on class; a cfg whose class it does not
+// give is noted in the description.  Key order and comments of the input are not preserved
+func UpgradeDocument(kind string, dict []byte, useYAML bool, cpd *CompPatternDict) ([]byte, []string, error) {
+	_, present := upgradeSteps[kind]
+	if !present {
+		return nil, nil, fmt.Errorf("files of kind %s are not versioned", kind)
+	}
+
+	var raw any
+	var err error
+	if useYAML {
+		err = yaml.Unmarshal(dict, &raw)
+	} else {
+		err = json.Unmarshal(dict, &raw)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, ok := raw.(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s document is not an object", kind)
+	}
+
+	version := 1
+	if doc["version"] != nil {
+		if !isInteger(doc["version"]) {
+			return nil, nil, fmt.Errorf("%s document has version that is not an integer", kind)
+		}
+		version = toInt(doc["version"])
+	}
+	if version > ModelFormatVersion {
+		return nil, nil, fmt.Errorf("%s document has format version %d, newer than the current version %d",
+			kind, version, ModelFormatVersion)
+	}
+	if version == ModelFormatVersion {
+		return dict, nil, nil
+	}
+
+	classes := make(map[string]map[string]string)
+	if cpd != nil {
+		for ptnName, cpt := range cpd.Patterns {
+			classes[ptnName] = make(map[string]string)
+			for _, fnc := range cpt.Funcs {
+				classes[ptnName][fnc.Label] = fnc.Class
+			}
+		}
+	}
+
+	log := new(upgradeLog)
+	for ; version < ModelFormatVersion; version++ {
+		upgradeSteps[kind][version](doc, classes, log)
+	}
+	doc["version"] = ModelFormatVersion
+	log.add("version", "set to %d", ModelFormatVersion)
+
+	var bytes []byte
+	if useYAML {
+		bytes, err = yaml.Marshal(doc)
+	} else {
+		bytes, err = json.MarshalIndent(doc, "", "\t")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes, log.notes, nil
+}
+
+// toInt converts a deserialized whole number to int
+func toInt(value any) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case uint64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// renameKeys walks a document against its schema, renaming fields the schema does not know
+// to the known field they match but for case and separators, e.g. "TimingCode" to "timingcode".
+// A field is not renamed if the document already holds the field it would be renamed to
+func renameKeys(s *Schema, value any, path string, log *upgradeLog) {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			subPath := joinPath(path, key)
+			prop, present := s.Properties[key]
+			if !present && len(s.Properties) > 0 {
+				target := matchField(key, s.Properties)
+				_, taken := v[target]
+				if len(target) > 0 && !taken {
+					v[target] = v[key]
+					delete(v, key)
+					log.add(subPath, "renamed to %s", target)
+					key, subPath, prop, present = target, joinPath(path, target), s.Properties[target], true
+				}
+			}
+			if present {
+				renameKeys(prop, v[key], subPath, log)
+				continue
+			}
+			addl, isSchema := s.AdditionalProperties.(*Schema)
+			if isSchema {
+				renameKeys(addl, v[key], subPath, log)
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for idx, elem := range v {
+				renameKeys(s.Items, elem, fmt.Sprintf("%s[%d]", path, idx), log)
+			}
+		}
+	}
+}
+
+// matchField returns the one known field name matching key but for case and separators, empty if there is none
+func matchField(key string, props map[string]*Schema) string {
+	norm := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+	match := ""
+	for name := range props {
+		if norm(name) == norm(key) {
+			if len(match) > 0 {
+				return ""
+			}
+			match = name
+		}
+	}
+	return match
+}
+
+// joinPath extends a field path with a key
+func joinPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+// upgradeCP1 renames fields to those of the current schema, and corrects the case of function class names
+func upgradeCP1(doc map[string]any, classes map[string]map[string]string, log *upgradeLog) {
+	s, _ := GenerateSchema("cp")
+	renameKeys(s, doc, "", log)
+
+	patterns, _ := doc["patterns"].(map[string]any)
+	for _, ptnName := range sortedKeys(patterns) {
+		ptn, _ := patterns[ptnName].(map[string]any)
+		funcs, _ := ptn["funcs"].([]any)
+		for idx, fnc := range funcs {
+			fncMap, _ := fnc.(map[string]any)
+			class, isStr := fncMap["class"].(string)
+			if !isStr || FuncClassNames[class] {
+				continue
+			}
+			for known := range FuncClassNames {
+				if strings.EqualFold(known, class) {
+					fncMap["class"] = known
+					log.add(fmt.Sprintf("patterns.%s.funcs[%d].class", ptnName, idx), "%s corrected to %s", class, known)
+					break
+				}
+			}
+		}
+	}
+}
+
+// upgradeCPInit1 renames fields to those of the current schema, inside cfgs as well as out.  Within the cfg
+// of a srvReq function, msg2msg becomes op2msg; a cfg whose class is not known is noted, as that rename cannot be applied.
+// Cfgs keep the form, serialized or nested object, they were written in
+func upgradeCPInit1(doc map[string]any, classes map[string]map[string]string, log *upgradeLog) {
+	s, _ := GenerateSchema("cpInit")
+	renameKeys(s, doc, "", log)
+
+	// the fields of any class, for cfgs whose class is not known
+	anyClass := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, class := range sortedKeys(FuncClasses) {
+		cs, _ := ClassCfgSchema(class)
+		for name, prop := range cs.Properties {
+			anyClass.Properties[name] = prop
+		}
+	}
+
+	initList, _ := doc["initlist"].(map[string]any)
+	for _, ptnName := range sortedKeys(initList) {
+		cpil, _ := initList[ptnName].(map[string]any)
+		cfgs, _ := cpil["cfg"].(map[string]any)
+		for _, label := range sortedKeys(cfgs) {
+			path := "initlist." + ptnName + ".cfg." + label
+
+			// a serialized cfg is upgraded as an object and serialized again in its original form
+			var cfg any = cfgs[label]
+			cfgStr, serialized := cfg.(string)
+			if serialized {
+				if len(strings.TrimSpace(cfgStr)) == 0 {
+					continue
+				}
+				err := yaml.Unmarshal([]byte(cfgStr), &cfg)
+				if err != nil {
+					log.add(path, "left as is, cannot be parsed: %s", err.Error())
+					continue
+				}
+			}
+			cfgMap, isMap := cfg.(map[string]any)
+			if !isMap {
+				continue
+			}
+			class := classes[ptnName][label]
+			cs := anyClass
+			if len(class) > 0 {
+				cs, _ = ClassCfgSchema(class)
+			} else {
+				log.add(path, "function class not known (no cp file given), upgrades of srvReq cfgs such as msg2msg to op2msg not applied")
+			}
+			before := len(log.notes)
+			if class == "srvReq" {
+				_, hasOp2Msg := cfgMap["op2msg"]
+				msg2msg, hasMsg2Msg := cfgMap["msg2msg"]
+				if hasMsg2Msg && !hasOp2Msg {
+					cfgMap["op2msg"] = msg2msg
+					delete(cfgMap, "msg2msg")
+					log.add(path+".msg2msg", "renamed to op2msg, the field srvReq reads")
+				}
+			}
+			if cs != nil {
+				renameKeys(cs, cfgMap, path, log)
+			}
+
+			if serialized && len(log.notes) > before {
+				var bytes []byte
+				var err error
+				if strings.TrimSpace(cfgStr)[0] == '{' {
+					bytes, err = json.Marshal(cfgMap)
+				} else {
+					bytes, err = yaml.Marshal(cfgMap)
+				}
+				if err == nil {
+					cfgs[label] = string(bytes)
+				}
+			}
+		}
+	}
+}
+
+// upgradeFuncExec1 renames fields to those of the current schema, and gives every timing
+// the identifier of the operation it is listed under
+func upgradeFuncExec1(doc map[string]any, classes map[string]map[string]string, log *upgradeLog) {
+	s, _ := GenerateSchema("funcExec")
+	renameKeys(s, doc, "", log)
+
+	times, _ := doc["times"].(map[string]any)
+	for _, op := range sortedKeys(times) {
+		timings, _ := times[op].([]any)
+		for idx, timing := range timings {
+			timingMap, _ := timing.(map[string]any)
+			if timingMap == nil {
+				continue
+			}
+			ident, _ := timingMap["identifier"].(string)
+			if ident != op {
+				timingMap["identifier"] = op
+				if len(ident) == 0 {
+					log.add(fmt.Sprintf("times.%s[%d].identifier", op, idx), "set to %s", op)
+				} else {
+					log.add(fmt.Sprintf("times.%s[%d].identifier", op, idx), "%s changed to %s, the operation it is listed under", ident, op)
+				}
+			}
+		}
+	}
+}
+
+// upgradeMap1 renames fields to those of the current schema, and rewrites every map entry
+// in the form "host,priority", priority an integer (1 if none was given)
+func upgradeMap1(doc map[string]any, classes map[string]map[string]string, log *upgradeLog) {
+	s, _ := GenerateSchema("map")
+	renameKeys(s, doc, "", log)
+
+	maps, _ := doc["map"].(map[string]any)
+	for _, ptnName := range sortedKeys(maps) {
+		cpm, _ := maps[ptnName].(map[string]any)
+		funcMap, _ := cpm["funcmap"].(map[string]any)
+		for _, label := range sortedKeys(funcMap) {
+			hostPri, isStr := funcMap[label].(string)
+			if !isStr {
+				continue
+			}
+			path := "map." + ptnName + ".funcmap." + label
+			pieces := strings.Split(hostPri, ",")
+			host := strings.TrimSpace(pieces[0])
+			pri := 1
+			if len(pieces) > 1 {
+				priF, err := strconv.ParseFloat(strings.TrimSpace(pieces[1]), 64)
+				if err != nil {
+					log.add(path, "left as is, priority %q is not a number", pieces[1])
+					continue
+				}
+				pri = int(math.Round(priF))
+			}
+			upgraded := host + "," + strconv.Itoa(pri)
+			if upgraded != hostPri {
+				funcMap[label] = upgraded
+				log.add(path, "%q rewritten as %q", hostPri, upgraded)
+			}
+		}
+	}
+}
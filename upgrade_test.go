@@ -0,0 +1,120 @@
+package pces
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUpgradeDocument(t *testing.T) {
+	srvReqCfg := "initlist:\n  chain1:\n    cfg:\n      hash: \"msg2msg: {req: rsp}\\nsrvop: lookup\\n\"\n"
+	tests := []struct {
+		name   string
+		kind   string
+		doc    string
+		withCP bool
+		notes  []string
+		has    []string
+	}{
+		{
+			name: "cp fields renamed and classes corrected",
+			kind: "cp",
+			doc:  "patterns:\n  chain1:\n    CPType: chain\n    funcs:\n      - {class: ProcessPckt, label: proc}\n",
+			notes: []string{"patterns.chain1.CPType: renamed to cptype",
+				"patterns.chain1.funcs[0].class: ProcessPckt corrected to processPckt", "version: set to 2"},
+			has: []string{"cptype: chain", "class: processPckt"},
+		},
+		{
+			name:   "cpInit srvReq msg2msg renamed",
+			kind:   "cpInit",
+			doc:    srvReqCfg,
+			withCP: true,
+			notes:  []string{"initlist.chain1.cfg.hash.msg2msg: renamed to op2msg, the field srvReq reads", "version: set to 2"},
+			has:    []string{"op2msg"},
+		},
+		{
+			name: "cpInit class not known",
+			kind: "cpInit",
+			doc:  srvReqCfg,
+			notes: []string{"initlist.chain1.cfg.hash: function class not known (no cp file given), " +
+				"upgrades of srvReq cfgs such as msg2msg to op2msg not applied", "version: set to 2"},
+			has: []string{"msg2msg"},
+		},
+		{
+			name:   "cpInit fields renamed within a nested cfg",
+			kind:   "cpInit",
+			doc:    "initlist:\n  chain1:\n    cfg:\n      proc: {TimingCode: {req: crypt}}\n",
+			withCP: true,
+			notes:  []string{"initlist.chain1.cfg.proc.TimingCode: renamed to timingcode", "version: set to 2"},
+			has:    []string{"timingcode:"},
+		},
+		{
+			name: "funcExec identifiers set",
+			kind: "funcExec",
+			doc: "times:\n  crypt:\n    - {cpumodel: x86, pcktlen: 1000, exectime: 0.001}\n" +
+				"    - {identifier: encrypt, cpumodel: arm, pcktlen: 1000, exectime: 0.002}\n",
+			notes: []string{"times.crypt[0].identifier: set to crypt",
+				"times.crypt[1].identifier: encrypt changed to crypt, the operation it is listed under", "version: set to 2"},
+		},
+		{
+			name: "map entries given integer priority",
+			kind: "map",
+			doc:  "map:\n  chain1:\n    funcmap: {proc: hostA, src: \"hostA,1.6\", sink: \"hostB,2\", hash: \"hostA,high\"}\n",
+			notes: []string{`map.chain1.funcmap.hash: left as is, priority "high" is not a number`,
+				`map.chain1.funcmap.proc: "hostA" rewritten as "hostA,1"`,
+				`map.chain1.funcmap.src: "hostA,1.6" rewritten as "hostA,2"`, "version: set to 2"},
+			has: []string{"hostA,1", "hostA,2", "hostB,2"},
+		},
+		{
+			name:  "current version unchanged",
+			kind:  "map",
+			doc:   "version: 2\nmap:\n  chain1:\n    funcmap: {proc: hostA}\n",
+			notes: []string{},
+			has:   []string{"proc: hostA}"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cpd *CompPatternDict
+			if tc.withCP {
+				cpd, _, _, _ = testModel(t)
+				cpd.Patterns["chain1"].Funcs[2].Class = "srvReq"
+			}
+			upgraded, notes, err := UpgradeDocument(tc.kind, []byte(tc.doc), true, cpd)
+			if err != nil {
+				t.Fatalf("UpgradeDocument: %v", err)
+			}
+			if strings.Join(notes, "\n") != strings.Join(tc.notes, "\n") {
+				t.Errorf("UpgradeDocument notes = %q, want %q", notes, tc.notes)
+			}
+			for _, str := range tc.has {
+				if !strings.Contains(string(upgraded), str) {
+					t.Errorf("upgraded document does not hold %q:\n%s", str, upgraded)
+				}
+			}
+		})
+	}
+}
+
+func TestUpgradeDocumentErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   string
+		doc    string
+		errStr string
+	}{
+		{"kind not versioned", "topo", "name: t\n", "files of kind topo are not versioned"},
+		{"newer version", "cp", "version: 3\n", "cp document has format version 3, newer than the current version 2"},
+		{"version not an integer", "cp", "version: 1.5\n", "cp document has version that is not an integer"},
+		{"not an object", "map", "- hostA\n", "map document is not an object"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := UpgradeDocument(tc.kind, []byte(tc.doc), true, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.errStr) {
+				t.Errorf("UpgradeDocument error = %v, want one containing %q", err, tc.errStr)
+			}
+		})
+	}
+}
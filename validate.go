@@ -0,0 +1,203 @@
+package pces
+
+// file validate.go holds checks of a CompPatternMapDict against the comp patterns it maps,
+// the mrnes endpoints that have been loaded, and the function timings, made before the
+// simulation model is built so that errors are reported together rather than as run-time panics
+
+import (
+	"fmt"
+	"github.com/iti/mrnes"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidateCompPatternMap checks that every function of every comp pattern in cpd is mapped by cpmd
+// to an endpoint known to mrnes with a well-formed priority, and that the CPU model of that endpoint (or
+// the model of the accelerator the function names) has timings in fel for every op code the function's
+// cfg can use.  Members of the shared cfg groups of ssgl (which may be nil) use the cfg of their group.
+// mrnes.EndptDevByName must have been populated already.  All problems found are returned together in one error
+func ValidateCompPatternMap(cpd *CompPatternDict, cpid *CPInitListDict, ssgl *SharedCfgGroupList, fel *FuncExecList,
+	cpmd *CompPatternMapDict) error {
+
+	errs := checkMapStructure(cpd, cpmd)
+	etTbl := buildFuncExecTimeTbl(fel)
+
+	for _, ptnName := range sortedPtnNames(cpd) {
+		cpm, present := cpmd.Map[ptnName]
+		if !present {
+			continue
+		}
+		for _, fnc := range cpd.Patterns[ptnName].Funcs {
+			funcName := ptnName + ":" + fnc.Label
+
+			// malformed entries have been reported already
+			host, err := parseHostPri(cpm.FuncMap[fnc.Label])
+			if err != nil {
+				continue
+			}
+
+			endpt, present := mrnes.EndptDevByName[host]
+			if !present {
+				errs = append(errs, fmt.Errorf("function %s mapped to host %s, which is not an endpoint of the topology",
+					funcName, host))
+				continue
+			}
+
+			cfgStr := funcCfgStr(cpid, ssgl, ptnName, fnc.Label)
+			errs = append(errs, checkHostTimings(funcName, cfgOpCodes(cfgStr), host, endpt.EndptModel,
+				endpt.EndptAccelModel, etTbl)...)
+		}
+	}
+
+	return ReportErrs(errs)
+}
+
+// funcCfgStr returns the cfg of a function, that of its shared cfg group in ssgl if it belongs to one
+func funcCfgStr(cpid *CPInitListDict, ssgl *SharedCfgGroupList, ptnName, label string) string {
+	if ssgl != nil {
+		gfid := GlobalFuncID{CmpPtnName: ptnName, Label: label}
+		for _, ssg := range ssgl.Groups {
+			if slices.Contains(ssg.Instances, gfid) {
+				return ssg.CfgStr
+			}
+		}
+	}
+	cpil, present := cpid.InitList[ptnName]
+	if !present {
+		return ""
+	}
+	return cpil.Cfg[label]
+}
+
+// checkMapStructure checks the map against the comp patterns alone: every pattern has
+// an entry, every function is mapped by a well-formed entry, and no entry names a pattern or
+// function that does not exist
+func checkMapStructure(cpd *CompPatternDict, cpmd *CompPatternMapDict) []error {
+	errs := []error{}
+
+	for _, ptnName := range sortedPtnNames(cpd) {
+		cpm, present := cpmd.Map[ptnName]
+		if !present {
+			errs = append(errs, fmt.Errorf("comp pattern %s has no entry in the map", ptnName))
+			continue
+		}
+
+		labels := make(map[string]bool)
+		for _, fnc := range cpd.Patterns[ptnName].Funcs {
+			labels[fnc.Label] = true
+			funcName := ptnName + ":" + fnc.Label
+
+			hostPri, present := cpm.FuncMap[fnc.Label]
+			if !present {
+				errs = append(errs, fmt.Errorf("function %s is not mapped to a host", funcName))
+				continue
+			}
+
+			_, err := parseHostPri(hostPri)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("function %s: %s", funcName, err.Error()))
+			}
+		}
+
+		// entries for labels the pattern does not have are most likely misspellings
+		mapped := make([]string, 0, len(cpm.FuncMap))
+		for label := range cpm.FuncMap {
+			mapped = append(mapped, label)
+		}
+		sort.Strings(mapped)
+		for _, label := range mapped {
+			if !labels[label] {
+				errs = append(errs, fmt.Errorf("map for comp pattern %s names function %s, which the pattern does not have",
+					ptnName, label))
+			}
+		}
+	}
+
+	mappedPtns := make([]string, 0, len(cpmd.Map))
+	for ptnName := range cpmd.Map {
+		mappedPtns = append(mappedPtns, ptnName)
+	}
+	sort.Strings(mappedPtns)
+	for _, ptnName := range mappedPtns {
+		_, present := cpd.Patterns[ptnName]
+		if !present {
+			errs = append(errs, fmt.Errorf("map names comp pattern %s, which is not defined", ptnName))
+		}
+	}
+	return errs
+}
+
+// parseHostPri splits a FuncMap value of the form "host" or "host,priority", checking that
+// the host is given and that the priority, if present, is an integer
+func parseHostPri(hostPri string) (string, error) {
+	pieces := strings.Split(hostPri, ",")
+	host := strings.TrimSpace(pieces[0])
+	if len(host) == 0 {
+		return "", fmt.Errorf("map entry %q names no host", hostPri)
+	}
+	if len(pieces) > 2 {
+		return "", fmt.Errorf("map entry %q is not of the form host,priority", hostPri)
+	}
+	if len(pieces) == 2 {
+		_, err := strconv.Atoi(strings.TrimSpace(pieces[1]))
+		if err != nil {
+			return "", fmt.Errorf("map entry %q has priority that is not an integer", hostPri)
+		}
+	}
+	return host, nil
+}
+
+// checkHostTimings returns an error for every op code of the function that has no timing
+// on the model of the host's CPU, or of the accelerator that the op runs on.  accelModels maps
+// the names of the host's accelerators to their models
+func checkHostTimings(funcName string, fo funcOps, host, cpuModel string, accelModels map[string]string,
+	etTbl execTimeTbl) []error {
+
+	errs := []error{}
+
+	for _, op := range fo.hostOps {
+		_, present := etTbl[op][cpuModel]
+		if !present {
+			errs = append(errs, fmt.Errorf("function %s on host %s uses op %s, which has no timing for CPU model %s",
+				funcName, host, op, cpuModel))
+			continue
+		}
+		errs = append(errs, checkParamTimings(funcName, fo, op, cpuModel, etTbl)...)
+	}
+
+	if len(fo.accelOps) == 0 {
+		return errs
+	}
+	accelModel, present := accelModels[fo.accel]
+	if !present {
+		errs = append(errs, fmt.Errorf("function %s uses accelerator %s, which host %s does not have",
+			funcName, fo.accel, host))
+		return errs
+	}
+	for _, op := range fo.accelOps {
+		_, present := etTbl[op][accelModel]
+		if !present {
+			errs = append(errs, fmt.Errorf("function %s on host %s uses op %s, which has no timing for accelerator %s model %s",
+				funcName, host, op, fo.accel, accelModel))
+			continue
+		}
+		errs = append(errs, checkParamTimings(funcName, fo, op, accelModel, etTbl)...)
+	}
+	return errs
+}
+
+// checkParamTimings returns an error for every param the function's cfg gives for an op
+// that selects no timing of the op on the model
+func checkParamTimings(funcName string, fo funcOps, op, model string, etTbl execTimeTbl) []error {
+	errs := []error{}
+	for _, param := range fo.opParams(op) {
+		_, present := etTbl.lookup(op, model, param)
+		if !present {
+			errs = append(errs, fmt.Errorf("function %s uses op %s with param %q, which has no timing for model %s",
+				funcName, op, param, model))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,133 @@
+package pces
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHostPri(t *testing.T) {
+	tests := []struct {
+		hostPri string
+		host    string
+		ok      bool
+	}{
+		{"hostA", "hostA", true},
+		{"hostA,1", "hostA", true},
+		{" hostA , 3 ", "hostA", true},
+		{"hostA,-2", "hostA", true},
+		{"hostA,1.5", "", false},
+		{"hostA,high", "", false},
+		{"hostA,1,2", "", false},
+		{",1", "", false},
+		{"", "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.hostPri, func(t *testing.T) {
+			host, err := parseHostPri(tc.hostPri)
+			if (err == nil) != tc.ok {
+				t.Fatalf("parseHostPri(%q) error = %v, want ok %v", tc.hostPri, err, tc.ok)
+			}
+			if host != tc.host {
+				t.Errorf("parseHostPri(%q) = %q, want %q", tc.hostPri, host, tc.host)
+			}
+		})
+	}
+}
+
+func TestAddMappingPriorityParses(t *testing.T) {
+	// the map entries written by placement must pass the map's validation
+	cpm := CreateCompPatternMap("chain1")
+	err := cpm.AddMapping("proc", "hostA", float64(CreatePlacementSpec("p", "latency").Priority), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := parseHostPri(cpm.FuncMap["proc"])
+	if err != nil || host != "hostA" {
+		t.Errorf("parseHostPri(%q) = %q, %v", cpm.FuncMap["proc"], host, err)
+	}
+}
+
+func TestValidateCompPatternMap(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(cpid *CPInitListDict, cpmd *CompPatternMapDict, fel *FuncExecList, ssgl *SharedCfgGroupList)
+		errStr []string
+	}{
+		{name: "valid", setup: func(cpid *CPInitListDict, cpmd *CompPatternMapDict, fel *FuncExecList, ssgl *SharedCfgGroupList) {}},
+		{
+			name: "host not an endpoint",
+			setup: func(cpid *CPInitListDict, cpmd *CompPatternMapDict, fel *FuncExecList, ssgl *SharedCfgGroupList) {
+				cpmd.Map["chain1"].FuncMap["proc"] = "hostZ,1"
+			},
+			errStr: []string{"chain1:proc mapped to host hostZ, which is not an endpoint"},
+		},
+		{
+			name: "no timing on the host's CPU model",
+			setup: func(cpid *CPInitListDict, cpmd *CompPatternMapDict, fel *FuncExecList, ssgl *SharedCfgGroupList) {
+				cpmd.Map["chain1"].FuncMap["hash"] = "hostC,1"
+			},
+			errStr: []string{"chain1:hash on host hostC uses op hash, which has no timing for CPU model arm"},
+		},
+		{
+			name: "param without a timing",
+			setup: func(cpid *CPInitListDict, cpmd *CompPatternMapDict, fel *FuncExecList, ssgl *SharedCfgGroupList) {
+				cpid.InitList["chain1"].Cfg["proc"] = "timingcode: {req: crypt}\ntimingparam: {req: des}"
+				fel.Times["crypt"][0].Param = "aes"
+			},
+			errStr: []string{`chain1:proc uses op crypt with param "des", which has no timing for model x86`},
+		},
+		{
+			name: "malformed entries reported together",
+			setup: func(cpid *CPInitListDict, cpmd *CompPatternMapDict, fel *FuncExecList, ssgl *SharedCfgGroupList) {
+				cpmd.Map["chain1"].FuncMap["src"] = "hostA,1.5"
+				delete(cpmd.Map["chain1"].FuncMap, "sink")
+				cpmd.Map["chain1"].FuncMap["tap"] = "hostA,1"
+			},
+			errStr: []string{"chain1:src: map entry \"hostA,1.5\" has priority that is not an integer",
+				"chain1:sink is not mapped to a host", "names function tap, which the pattern does not have"},
+		},
+		{
+			name: "pattern missing from the map, map of unknown pattern",
+			setup: func(cpid *CPInitListDict, cpmd *CompPatternMapDict, fel *FuncExecList, ssgl *SharedCfgGroupList) {
+				cpmd.Map["chain2"] = cpmd.Map["chain1"]
+				delete(cpmd.Map, "chain1")
+			},
+			errStr: []string{"comp pattern chain1 has no entry in the map", "map names comp pattern chain2, which is not defined"},
+		},
+		{
+			name: "shared cfg group checked in place of the member's own cfg",
+			setup: func(cpid *CPInitListDict, cpmd *CompPatternMapDict, fel *FuncExecList, ssgl *SharedCfgGroupList) {
+				ssg := CreateSharedCfgGroup("signers", "processPckt")
+				ssg.AddInstance("chain1", "proc")
+				ssg.AddCfg("timingcode: {req: sign}")
+				ssgl.Groups = append(ssgl.Groups, *ssg)
+			},
+			errStr: []string{"chain1:proc on host hostA uses op sign, which has no timing for CPU model x86"},
+		},
+	}
+
+	loadTestTopo(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpd, cpid, fel, cpmd := testModel(t)
+			ssgl := CreateSharedCfgGroupList(true)
+			tc.setup(cpid, cpmd, fel, ssgl)
+			err := ValidateCompPatternMap(cpd, cpid, ssgl, fel, cpmd)
+			if len(tc.errStr) == 0 {
+				if err != nil {
+					t.Errorf("ValidateCompPatternMap: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ValidateCompPatternMap gave no error, want %q", tc.errStr)
+			}
+			for _, errStr := range tc.errStr {
+				if !strings.Contains(err.Error(), errStr) {
+					t.Errorf("ValidateCompPatternMap error = %v, want one containing %q", err, errStr)
+				}
+			}
+		})
+	}
+}